@@ -4,28 +4,38 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/component/auth"
 	"github.com/robfig/cron/v3"
 	"github.com/twj0/subcheck/app/monitor"
 	"github.com/twj0/subcheck/assets"
 	"github.com/twj0/subcheck/check"
-	plat "github.com/twj0/subcheck/check/platform"
 	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/gateway"
+	"github.com/twj0/subcheck/geoip"
+	"github.com/twj0/subcheck/hooks"
 	"github.com/twj0/subcheck/ipcheck"
+	"github.com/twj0/subcheck/notify"
 	proxyutils "github.com/twj0/subcheck/proxy"
 	"github.com/twj0/subcheck/save"
+	"github.com/twj0/subcheck/save/method"
 	"github.com/twj0/subcheck/storage"
 	"github.com/twj0/subcheck/utils"
+	"github.com/twj0/subcheck/webhook"
 )
 
 // App 结构体用于管理应用程序状态
@@ -40,7 +50,13 @@ type App struct {
 	done       chan struct{} // 用于结束ticker goroutine的信号
 	cron       *cron.Cron    // crontab调度器
 	ipCron     *cron.Cron    // IP质量检测调度器（每月）
+	geoCron    *cron.Cron    // GeoIP数据库更新调度器
 	version    string
+	gateway    *gateway.Pool     // 本地代理网关的节点池
+	gwListener *gateway.Listener // 本地代理网关的入站
+	health     *healthMonitor    // 已发布节点的存活探测
+	runID      atomic.Int64      // 最近一次检测的记录 ID
+	saveMu     sync.Mutex        // 串行化完整检测与健康监控生成订阅文件
 }
 
 // initIPCron 初始化每月IP质量检测任务
@@ -70,6 +86,31 @@ func (app *App) initIPCron() error {
 	return nil
 }
 
+// initGeoIPCron 初始化GeoIP数据库定时更新任务
+func (app *App) initGeoIPCron() error {
+	if app.geoCron != nil {
+		app.geoCron.Stop()
+		app.geoCron = nil
+	}
+	spec := config.GlobalConfig.GeoIP.UpdateCron
+	if spec == "" {
+		return nil
+	}
+	app.geoCron = cron.New()
+	_, err := app.geoCron.AddFunc(spec, func() {
+		if err := geoip.Update(); err != nil {
+			slog.Error(fmt.Sprintf("GeoIP数据库更新失败: %v", err))
+		}
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to parse GeoIP update cron: %v", err))
+		return err
+	}
+	app.geoCron.Start()
+	slog.Info("GeoIP update task started", "cron", spec)
+	return nil
+}
+
 // triggerIPCheck 触发一次IP质量检测
 func (app *App) triggerIPCheck() {
 	if !config.GlobalConfig.IpCheck.Enabled {
@@ -100,28 +141,15 @@ func (app *App) triggerIPCheck() {
 			slog.Error(fmt.Sprintf("获取TopN代理失败: %v", err))
 			return
 		}
-		rate := config.GlobalConfig.IpCheck.RatePerMin
-		interval := time.Duration(0)
-		if rate > 0 {
-			interval = time.Minute / time.Duration(rate)
-		}
+		script := strings.EqualFold(config.GlobalConfig.IpCheck.Engine, "script")
 		conc := config.GlobalConfig.IpCheck.Concurrent
 		if conc <= 0 {
 			conc = 3
 		}
+		// 限速由 ipcheck 的全局限速器控制，与主检测共用
 		sem := make(chan struct{}, conc)
-		var ticker *time.Ticker
-		if interval > 0 {
-			ticker = time.NewTicker(interval)
-			defer ticker.Stop()
-		}
 		var wg sync.WaitGroup
-		for idx, js := range items {
-			if interval > 0 && ticker != nil {
-				if idx > 0 {
-					<-ticker.C
-				}
-			}
+		for _, js := range items {
 			var m map[string]any
 			if err := json.Unmarshal([]byte(js), &m); err != nil {
 				continue
@@ -134,41 +162,41 @@ func (app *App) triggerIPCheck() {
 				if pc == nil {
 					return
 				}
-				country, ip := proxyutils.GetProxyCountry(pc.Client)
-				if ip == "" {
-					return
-				}
-				risk, err := plat.CheckIPRisk(pc.Client, ip)
-				if err != nil {
+				defer pc.Close()
+				info := proxyutils.GetProxyInfo(pc.Client)
+				if info.IP == "" {
 					return
 				}
-				var score int
-				if len(risk) > 0 && risk[len(risk)-1] == '%' {
-					fmt.Sscanf(risk, "%d%%", &score)
+				name, _ := mp["name"].(string)
+				// 每个节点单独计时，ip.sh 完整检测一个节点需要几分钟
+				nodeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				kind := ipcheck.KindFull
+				if script {
+					kind = ipcheck.KindScript
 				}
-				level := func(s int) string {
-					switch {
-					case s <= 10:
-						return "VeryLow"
-					case s <= 25:
-						return "Low"
-					case s <= 50:
-						return "Medium"
-					case s <= 75:
-						return "High"
-					default:
-						if s > 0 {
-							return "VeryHigh"
+				_, err := ipcheck.Lookup(nodeCtx, info.IP, kind, func(ctx context.Context) (*ipcheck.Report, error) {
+					if script {
+						res, err := ipcheck.RunProxy(ctx, pc.Proxy())
+						if err != nil {
+							return nil, err
+						}
+						rep := ipcheck.NewScriptReport(res)
+						rep.Node = name
+						if rep.IP == "" {
+							rep.IP = info.IP
 						}
-						return "Unknown"
+						return rep, nil
 					}
-				}(score)
-				if storage.DB != nil {
-					_, _ = storage.DB.Exec(`
-						INSERT INTO ip_quality_results (
-							subscription_id, ip_address, fraud_score, risk_level, is_proxy, is_vpn, is_tor, country_code
-						) VALUES (NULL, ?, ?, ?, NULL, NULL, NULL, ?)
-					`, ip, score, level, country)
+					rep, err := checkIPQuality(ctx, pc.Client, info)
+					if err != nil {
+						return nil, err
+					}
+					rep.Node = name
+					return rep, nil
+				})
+				if err != nil {
+					slog.Debug(fmt.Sprintf("节点 %s IP质量检测失败: %v", name, err))
 				}
 			}(m)
 		}
@@ -177,6 +205,25 @@ func (app *App) triggerIPCheck() {
 		return
 	}
 
+	if !strings.EqualFold(config.GlobalConfig.IpCheck.Engine, "script") {
+		// 检测本机出口
+		client := &http.Client{Timeout: 30 * time.Second}
+		info := proxyutils.GetProxyInfo(client)
+		if info.IP == "" {
+			slog.Error("IP quality check failed: 获取本机出口IP失败")
+			return
+		}
+		rep, err := ipcheck.Lookup(ctx, info.IP, ipcheck.KindFull, func(ctx context.Context) (*ipcheck.Report, error) {
+			return checkIPQuality(ctx, client, info)
+		})
+		if err != nil {
+			slog.Error(fmt.Sprintf("IP quality check failed: %v", err))
+			return
+		}
+		logIPQuality(rep)
+		return
+	}
+
 	res, err := ipcheck.Run(ctx, "")
 	if err != nil {
 		slog.Error(fmt.Sprintf("IP quality check failed: %v", err))
@@ -187,21 +234,32 @@ func (app *App) triggerIPCheck() {
 		return
 	}
 
-	core := ipcheck.ExtractCore(res)
-	if storage.DB != nil {
-		_, err := storage.DB.Exec(`
-			INSERT INTO ip_quality_results (
-				subscription_id, ip_address, fraud_score, risk_level, is_proxy, is_vpn, is_tor, country_code
-			) VALUES (NULL, ?, ?, ?, ?, ?, ?, ?)
-		`, core.IP, core.FraudScore, core.RiskLevel, core.IsProxy, core.IsVPN, core.IsTor, core.CountryCode)
-		if err != nil {
-			slog.Error(fmt.Sprintf("Failed to save IP quality check result: %v", err))
-		} else {
-			slog.Info("IP quality check completed and saved")
-		}
-	} else {
-		slog.Warn("Database not initialized, result not saved")
+	rep := ipcheck.NewScriptReport(res)
+	if err := ipcheck.Save(ctx, rep); err != nil {
+		slog.Error(fmt.Sprintf("Failed to save IP quality check result: %v", err))
+		return
 	}
+	logIPQuality(rep)
+}
+
+// checkIPQuality 查询所有接口，接口都没有返回国家时使用出口IP查询的结果
+func checkIPQuality(ctx context.Context, client *http.Client, info proxyutils.IPInfo) (*ipcheck.Report, error) {
+	rep, err := ipcheck.Check(ctx, client, info.IP)
+	if err != nil {
+		return nil, err
+	}
+	if rep.CountryCode == "" {
+		rep.CountryCode = info.Country
+	}
+	return rep, nil
+}
+
+func logIPQuality(rep *ipcheck.Report) {
+	if rep.Cached {
+		slog.Info("IP quality check skipped, using cached result", "ip", rep.IP, "score", rep.FraudScore)
+		return
+	}
+	slog.Info("IP quality check completed and saved", "ip", rep.IP, "score", rep.FraudScore, "providers", len(rep.Providers))
 }
 
 // New 创建新的应用实例
@@ -214,6 +272,7 @@ func New(version string) *App {
 		checkChan:  make(chan struct{}),
 		done:       make(chan struct{}),
 		version:    version,
+		health:     &healthMonitor{},
 	}
 }
 
@@ -274,6 +333,16 @@ func (app *App) Initialize() error {
 		return fmt.Errorf("Database migration failed: %w", err)
 	}
 
+	// 恢复之前测试成功的节点
+	if config.GlobalConfig.KeepSuccessProxies {
+		app.loadKeptProxies()
+	}
+	// 恢复上一次发布的节点，首次检测完成前 /api/sub 与健康监控使用
+	if results := app.restoreResults(); len(results) > 0 {
+		slog.Info(fmt.Sprintf("恢复上一次发布的节点，数量: %d", len(results)))
+		app.health.publish(results)
+	}
+
 	// 初始化IP质量检测cron（每月执行一次）
 	if config.GlobalConfig.IpCheck.Enabled {
 		if err := app.initIPCron(); err != nil {
@@ -281,6 +350,27 @@ func (app *App) Initialize() error {
 		}
 	}
 
+	// 加载离线GeoIP数据库，失败时回退到在线查询
+	if config.GlobalConfig.GeoIP.Enabled {
+		if err := geoip.Init(); err != nil {
+			slog.Warn(fmt.Sprintf("GeoIP数据库加载失败，将使用在线查询: %v", err))
+		}
+		if err := app.initGeoIPCron(); err != nil {
+			return fmt.Errorf("Failed to initialize GeoIP update task: %w", err)
+		}
+	}
+
+	// 启动本地代理网关，节点池在检测完成后填充
+	if config.GlobalConfig.Gateway.Enabled {
+		if err := app.initGateway(); err != nil {
+			return fmt.Errorf("Failed to start proxy gateway: %w", err)
+		}
+	}
+
+	if config.GlobalConfig.HealthMonitor.Enabled {
+		app.initHealthMonitor()
+	}
+
 	// 设置信号处理器
 	utils.SetupSignalHandler(&check.ForceClose)
 	return nil
@@ -299,6 +389,12 @@ func (app *App) Run() {
 		if app.ipCron != nil {
 			app.ipCron.Stop()
 		}
+		if app.geoCron != nil {
+			app.geoCron.Stop()
+		}
+		if app.gwListener != nil {
+			_ = app.gwListener.Close()
+		}
 		_ = storage.Close()
 	}()
 
@@ -395,6 +491,10 @@ func (app *App) triggerCheck() {
 
 	if err := app.checkProxies(); err != nil {
 		slog.Error(fmt.Sprintf("Failed to check proxies: %v", err))
+		notify.Send(notify.RunFailed, notify.Data{Error: err.Error()})
+		webhook.Send(webhook.Payload{Event: webhook.RunEnd, RunID: app.runID.Load(), Error: err.Error()})
+		webhook.Wait()
+		hooks.Wait()
 		os.Exit(1)
 	}
 
@@ -417,53 +517,222 @@ func (app *App) triggerCheck() {
 
 // checkProxies 执行代理检测
 func (app *App) checkProxies() error {
+	// 上一次的检测后脚本可能还在读取输出文件，结束后再开始新的检测
+	hooks.Wait()
 	slog.Info("Preparing to check proxies", "progress display", config.GlobalConfig.PrintProgress)
+	started := time.Now()
+	runID := app.startRun(started)
+	webhook.Send(webhook.Payload{Event: webhook.RunStart, Time: started, RunID: runID})
 
+	check.PreCheckHook = func(proxies []map[string]any) ([]map[string]any, error) {
+		return hooks.PreCheck(runID, proxies)
+	}
 	results, err := check.Check()
+	if errors.Is(err, hooks.ErrVetoed) {
+		slog.Warn(fmt.Sprintf("%v，跳过本次检测", err))
+		app.finishRun(runID, storage.RunVetoed)
+		webhook.Send(webhook.Payload{Event: webhook.RunEnd, RunID: runID, Duration: time.Since(started).Seconds(), Error: err.Error()})
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to check proxies: %w", err)
 	}
-	// 将成功的节点添加到全局中，暂时内存保存
+	// 将成功的节点保存到数据库，下次检测时前置
 	if config.GlobalConfig.KeepSuccessProxies {
-		for _, result := range results {
-			if result.Proxy != nil {
-				config.GlobalProxies = append(config.GlobalProxies, result.Proxy)
-			}
-		}
+		app.saveKeptProxies(results)
 	}
 
 	// 入库速度测试结果和IP纯净度结果（简版，无订阅ID关联）
+	// 复用的结果同样入库并标记为复用，不延长增量检测的有效期
 	for _, r := range results {
-		var ip sql.NullString
-		if r.IP != "" {
-			ip = sql.NullString{String: r.IP, Valid: true}
+		exit := storage.ExitInfo{IP: r.IP, Country: r.Country}
+		if r.IPStack != "" {
+			exit = storage.ExitInfo{IP: r.IPv4, Country: r.IPv4Country, IPv6: r.IPv6, IPv6Country: r.IPv6Country, Stack: r.IPStack}
 		}
 		var pjs sql.NullString
 		if b, err := json.Marshal(r.Proxy); err == nil {
 			pjs = sql.NullString{String: string(b), Valid: true}
 		}
-		_ = storage.SaveSpeedResult(context.Background(), sql.NullInt64{}, fmt.Sprint(r.Proxy["name"]), sql.NullInt64{}, float64(r.SpeedKBps), sql.NullFloat64{}, ip, pjs)
-
-		// 保存IP纯净度结果（如果有）
-		if r.IPRisk != "" && r.IP != "" {
-			// 解析IPRisk字符串，格式可能是 "Low" 或包含更多信息
-			riskLevel := sql.NullString{String: r.IPRisk, Valid: true}
-			// 这里可以根据实际情况解析更详细的信息
-			_ = storage.SaveIPQualityResult(context.Background(), sql.NullInt64{}, r.IP, sql.NullInt64{}, riskLevel, sql.NullBool{}, sql.NullBool{}, sql.NullBool{}, sql.NullString{String: r.Country, Valid: r.Country != ""})
+		id, err := storage.SaveSpeedResult(context.Background(), sql.NullInt64{}, fmt.Sprint(r.Proxy["name"]), sql.NullInt64{}, float64(r.SpeedKBps), sql.NullFloat64{}, exit, pjs)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("保存测速结果失败: %v", err))
+			continue
+		}
+		if js, err := check.ResultJSON(r); err == nil {
+			_ = storage.SaveSpeedResultFingerprint(context.Background(), id, r.Fingerprint, js, r.Reused)
 		}
+
+		// IP纯净度结果在检测时已经入库(ipcheck.Lookup)
 	}
 
 	slog.Info("检测完成")
-	save.SaveConfig(results)
-	utils.SendNotify(len(results))
+	app.saveMu.Lock()
+	outputs, err := save.SaveConfig(results)
+	if err == nil {
+		// 拒绝发布时网关、健康监控与 /api/sub 继续使用上一版本的节点
+		app.updateGateway(results)
+		app.health.publish(results)
+	}
+	app.saveMu.Unlock()
+	files := webhook.Files(outputs)
+	if len(files) > 0 {
+		webhook.Send(webhook.Payload{Event: webhook.Saved, RunID: runID, Files: files})
+	}
+	diff := app.recordRun(runID, started, results)
+	subs := check.SubResults()
+	duration := time.Since(started).Round(time.Second)
+	notify.SendRun(notify.Data{
+		Time:          time.Now(),
+		Duration:      duration,
+		Total:         int(check.ProxyCount.Load()),
+		Available:     len(results),
+		Diff:          diff,
+		Subscriptions: subs,
+	})
+	webhook.Send(webhook.Payload{
+		Event:         webhook.RunEnd,
+		RunID:         runID,
+		Total:         int(check.ProxyCount.Load()),
+		Available:     len(results),
+		Duration:      duration.Seconds(),
+		Subscriptions: webhook.Subscriptions(subs),
+		Files:         files,
+		TopNodes:      save.TopNodes(results, config.GlobalConfig.Webhooks.TopN),
+	})
 	utils.UpdateSubs()
 
-	// 执行回调脚本
-	utils.ExecuteCallback(len(results))
+	// 在后台执行检测后脚本
+	var outputDir string
+	if ls, err := method.NewLocalSaver(); err == nil {
+		outputDir = ls.OutputPath
+	}
+	hooks.PostCheck(hooks.PostCheckInfo{
+		RunID:     runID,
+		Started:   started,
+		Duration:  duration,
+		Total:     int(check.ProxyCount.Load()),
+		Results:   results,
+		Files:     outputs,
+		OutputDir: outputDir,
+		Traffic:   check.TotalBytes.Load(),
+	})
+
+	return nil
+}
+
+// saveKeptProxies 更新数据库中保留的节点，并作为下次检测前置的节点
+func (app *App) saveKeptProxies(results []check.Result) {
+	passed := make([]storage.KeptProxy, 0, len(results))
+	for _, r := range results {
+		if r.Proxy == nil {
+			continue
+		}
+		b, err := json.Marshal(r.Proxy)
+		if err != nil {
+			continue
+		}
+		fp := r.Fingerprint
+		if fp == "" {
+			fp = proxyutils.Fingerprint(r.Proxy)
+		}
+		passed = append(passed, storage.KeptProxy{Fingerprint: fp, NodeName: fmt.Sprint(r.Proxy["name"]), ProxyJSON: string(b)})
+	}
+	dropped, err := storage.SaveKeptProxies(context.Background(), passed, config.GlobalConfig.KeepSuccessMaxMissed)
+	if err != nil {
+		slog.Error(fmt.Sprintf("保存保留节点失败: %v", err))
+		// 数据库不可用时仍在内存中保留本次的节点
+		for _, r := range results {
+			if r.Proxy != nil {
+				config.GlobalProxies = append(config.GlobalProxies, r.Proxy)
+			}
+		}
+		return
+	}
+	if dropped > 0 {
+		slog.Info(fmt.Sprintf("%d 个保留节点连续 %d 次检测未通过，已不再保留", dropped, config.GlobalConfig.KeepSuccessMaxMissed))
+	}
+	app.loadKeptProxies()
+}
+
+// loadKeptProxies 从数据库读取保留的节点
+func (app *App) loadKeptProxies() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	list, err := storage.ListKeptProxies(ctx)
+	if err != nil {
+		slog.Error(fmt.Sprintf("读取保留节点失败: %v", err))
+		return
+	}
+	proxies := make([]map[string]any, 0, len(list))
+	for _, p := range list {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(p.ProxyJSON), &m); err != nil {
+			continue
+		}
+		proxies = append(proxies, m)
+	}
+	config.GlobalProxies = proxies
+	slog.Info(fmt.Sprintf("已加载保留的节点: %d", len(proxies)))
+}
 
+// initGateway 启动本地代理网关与两次检测之间的健康检查
+func (app *App) initGateway() error {
+	cfg := config.GlobalConfig.Gateway
+	app.gateway = gateway.NewPool(cfg.Policy)
+	var authenticator auth.Authenticator
+	if cfg.Password != "" {
+		authenticator = gateway.PasswordAuth(cfg.Password)
+	} else {
+		// 不需要认证时 SOCKS5 客户端不会发送用户名，只有 HTTP 代理能带上 user-country-xx
+		slog.Warn("代理网关未设置密码，按国家选择节点(user-country-xx)只对 HTTP 代理生效，SOCKS5 需要设置 gateway.password")
+	}
+	l, err := gateway.Listen(cfg.Listen, app.gateway.Select, authenticator)
+	if err != nil {
+		return err
+	}
+	app.gwListener = l
+	slog.Info(fmt.Sprintf("代理网关已启动: %s, 策略: %s", l.Address(), cfg.Policy))
+
+	if cfg.HealthCheckInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.HealthCheckInterval) * time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				// 完整检测期间节点池会被整体替换，跳过健康检查
+				if app.checking.Load() {
+					continue
+				}
+				timeout := time.Duration(config.GlobalConfig.Timeout) * time.Millisecond
+				app.gateway.HealthCheck(context.Background(), config.GlobalConfig.AliveTestUrl, timeout)
+				slog.Debug(fmt.Sprintf("代理网关健康检查完成，可用节点: %d", app.gateway.Len()))
+			}
+		}()
+	}
 	return nil
 }
 
+// updateGateway 用本次检测通过的节点替换网关的节点池
+func (app *App) updateGateway(results []check.Result) {
+	if app.gateway == nil {
+		return
+	}
+	nodes := make([]gateway.Node, 0, len(results))
+	for _, r := range results {
+		p, err := adapter.ParseProxy(r.Proxy)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("代理网关创建节点失败: %v", err))
+			continue
+		}
+		country := r.Country
+		if country == "" {
+			country = r.IPv4Country
+		}
+		nodes = append(nodes, gateway.Node{Proxy: p, Country: country, Latency: r.Latency})
+	}
+	app.gateway.Update(nodes)
+	slog.Info(fmt.Sprintf("代理网关节点池已更新，可用节点: %d", len(nodes)))
+}
+
 func TempLog() string {
 	return filepath.Join(os.TempDir(), "subcheck.log")
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/save"
 	"github.com/twj0/subcheck/utils"
 	"gopkg.in/yaml.v3"
 )
@@ -41,6 +42,9 @@ func (app *App) loadConfig() error {
 	if err := yaml.Unmarshal(yamlFile, config.GlobalConfig); err != nil {
 		return fmt.Errorf("解析配置文件失败: %w", err)
 	}
+	if err := save.ValidateOutputs(config.GlobalConfig.Outputs); err != nil {
+		return fmt.Errorf("outputs 配置无效: %w", err)
+	}
 
 	slog.Info("配置文件读取成功")
 	return nil
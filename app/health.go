@@ -0,0 +1,221 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/constant"
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	proxyutils "github.com/twj0/subcheck/proxy"
+	"github.com/twj0/subcheck/save"
+	"github.com/twj0/subcheck/webhook"
+)
+
+// NodeHealth 已发布节点的滚动健康状态
+type NodeHealth struct {
+	Fingerprint string    `json:"fingerprint"`
+	Name        string    `json:"name"`
+	Alive       bool      `json:"alive"`
+	Latency     int       `json:"latency"` // 最近一次成功探测的延迟(毫秒)
+	Fails       int       `json:"fails"`   // 连续失败次数
+	LastCheck   time.Time `json:"lastCheck"`
+}
+
+// healthMonitor 在两次完整检测之间对已发布的节点做存活探测
+type healthMonitor struct {
+	mu      sync.Mutex
+	results []check.Result
+	proxies []constant.Proxy
+	status  map[string]*NodeHealth // 按节点指纹记录，名称每次检测都会重新生成
+	gen     int                    // 每次完整检测发布后递增
+}
+
+// publish 记录本次完整检测发布的节点，重置健康状态
+func (h *healthMonitor) publish(results []check.Result) {
+	proxies := make([]constant.Proxy, len(results))
+	status := make(map[string]*NodeHealth, len(results))
+	for i, r := range results {
+		fp := fingerprint(r)
+		status[fp] = &NodeHealth{Fingerprint: fp, Name: fmt.Sprint(r.Proxy["name"]), Alive: true, Latency: r.Latency, LastCheck: time.Now()}
+		p, err := adapter.ParseProxy(r.Proxy)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("健康监控创建节点失败: %v", err))
+			continue
+		}
+		proxies[i] = p
+	}
+
+	h.mu.Lock()
+	h.results = results
+	h.proxies = proxies
+	h.status = status
+	h.gen++
+	h.mu.Unlock()
+}
+
+// Status 返回所有已发布节点的健康状态
+func (h *healthMonitor) Status() []NodeHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]NodeHealth, 0, len(h.results))
+	for _, r := range h.results {
+		if s, ok := h.status[fingerprint(r)]; ok {
+			list = append(list, *s)
+		}
+	}
+	return list
+}
+
+// Results 返回当前发布的节点，已剔除健康监控移除的节点
+func (h *healthMonitor) Results() []check.Result {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.results
+}
+
+// probe 对所有已发布节点做一次存活探测，移除连续失败达到阈值的节点
+// 返回剩余的节点与是否有节点被移除
+func (h *healthMonitor) probe(ctx context.Context, url string, timeout time.Duration, concurrent, threshold int) ([]check.Result, bool, int) {
+	h.mu.Lock()
+	results := h.results
+	proxies := h.proxies
+	gen := h.gen
+	h.mu.Unlock()
+
+	type probeResult struct {
+		delay uint16
+		err   error
+	}
+	probes := make([]probeResult, len(results))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrent)
+	for i, p := range proxies {
+		if p == nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p constant.Proxy) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			tctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			delay, err := p.URLTest(tctx, url, nil)
+			probes[i] = probeResult{delay: delay, err: err}
+		}(i, p)
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// 探测期间完整检测已发布了新结果，丢弃本次探测
+	if h.gen != gen {
+		return h.results, false, h.gen
+	}
+	now := time.Now()
+	kept := make([]check.Result, 0, len(results))
+	keptProxies := make([]constant.Proxy, 0, len(results))
+	for i, r := range results {
+		s := h.status[fingerprint(r)]
+		if s != nil && proxies[i] != nil {
+			s.LastCheck = now
+			if probes[i].err != nil {
+				s.Alive = false
+				s.Fails++
+			} else {
+				s.Alive = true
+				s.Fails = 0
+				s.Latency = int(probes[i].delay)
+			}
+			if s.Fails >= threshold {
+				slog.Info(fmt.Sprintf("节点 %s 连续 %d 次存活探测失败，已从订阅中移除", s.Name, s.Fails))
+				delete(h.status, s.Fingerprint)
+				continue
+			}
+		}
+		kept = append(kept, r)
+		keptProxies = append(keptProxies, proxies[i])
+	}
+	removed := len(kept) != len(results)
+	h.results = kept
+	h.proxies = keptProxies
+	return kept, removed, gen
+}
+
+// generation 返回当前发布的版本，每次完整检测发布后递增
+func (h *healthMonitor) generation() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.gen
+}
+
+// saveHealthResults 重新生成移除失效节点后的订阅文件，与完整检测共用 saveMu，
+// 探测期间开始了完整检测或完整检测已发布新结果时，订阅文件由完整检测生成
+func (app *App) saveHealthResults(results []check.Result, gen int) {
+	app.saveMu.Lock()
+	defer app.saveMu.Unlock()
+	if app.checking.Load() || app.health.generation() != gen {
+		return
+	}
+	slog.Info(fmt.Sprintf("健康监控移除了失效节点，剩余可用节点: %d，重新生成订阅文件", len(results)))
+	outputs, _ := save.SaveConfig(results)
+	if files := webhook.Files(outputs); len(files) > 0 {
+		webhook.Send(webhook.Payload{Event: webhook.Saved, RunID: app.runID.Load(), Files: files})
+	}
+}
+
+// fingerprint 返回检测结果的节点指纹
+func fingerprint(r check.Result) string {
+	if r.Fingerprint != "" {
+		return r.Fingerprint
+	}
+	return proxyutils.Fingerprint(r.Proxy)
+}
+
+// initHealthMonitor 启动两次完整检测之间的存活探测
+func (app *App) initHealthMonitor() {
+	interval := config.GlobalConfig.HealthMonitor.Interval
+	if interval <= 0 {
+		interval = 5
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			// 完整检测会重新发布节点，跳过本次探测
+			if app.checking.Load() {
+				continue
+			}
+			app.runHealthMonitor()
+		}
+	}()
+}
+
+// runHealthMonitor 探测一次已发布的节点，有节点被移除时重新生成订阅文件，
+// 可用节点低于 min-available 时触发完整检测
+func (app *App) runHealthMonitor() {
+	cfg := config.GlobalConfig.HealthMonitor
+	threshold := cfg.FailThreshold
+	if threshold <= 0 {
+		threshold = 2
+	}
+	concurrent := cfg.Concurrent
+	if concurrent <= 0 {
+		concurrent = 20
+	}
+	timeout := time.Duration(config.GlobalConfig.Timeout) * time.Millisecond
+
+	results, removed, gen := app.health.probe(context.Background(), config.GlobalConfig.AliveTestUrl, timeout, concurrent, threshold)
+	if removed {
+		app.saveHealthResults(results, gen)
+	}
+	if cfg.MinAvailable > 0 && len(results) < cfg.MinAvailable {
+		slog.Warn(fmt.Sprintf("可用节点 %d 低于 %d，触发完整检测", len(results), cfg.MinAvailable))
+		app.TriggerCheck()
+	}
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/save"
+	"github.com/twj0/subcheck/storage"
+)
+
+// maxRuns 数据库中保留的检测记录数量
+const maxRuns = 200
+
+// startRun 记录检测开始，返回检测记录 ID，数据库不可用时为 0
+func (app *App) startRun(started time.Time) int64 {
+	app.runID.Store(0)
+	if storage.DB == nil {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id, err := storage.StartRun(ctx, started)
+	if err != nil {
+		slog.Error(fmt.Sprintf("保存检测记录失败: %v", err))
+		return 0
+	}
+	app.runID.Store(id)
+	return id
+}
+
+// finishRun 结束没有检测结果的记录，如被 pre-check 脚本否决的检测
+func (app *App) finishRun(runID int64, status string) {
+	if storage.DB == nil || runID == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := storage.FinishRun(ctx, runID, status, time.Now()); err != nil {
+		slog.Error(fmt.Sprintf("保存检测记录失败: %v", err))
+	}
+}
+
+// recordRun 保存本次检测结果并与上一次检测比较，首次检测或数据库不可用时返回 nil
+func (app *App) recordRun(runID int64, started time.Time, results []check.Result) *save.RunDiff {
+	if storage.DB == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	snap := save.Snapshot(results)
+	run := storage.Run{
+		ID:         runID,
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+		Total:      int(check.ProxyCount.Load()),
+		Available:  len(results),
+	}
+	if b, err := json.Marshal(snap); err == nil {
+		run.Snapshot = string(b)
+	}
+
+	var diff *save.RunDiff
+	prev, err := storage.LatestRun(ctx)
+	if err != nil {
+		slog.Error(fmt.Sprintf("查询上一次检测记录失败: %v", err))
+	} else if prev != nil && prev.Snapshot != "" {
+		var prevSnap map[string]save.NodeState
+		if err := json.Unmarshal([]byte(prev.Snapshot), &prevSnap); err == nil {
+			diff = save.DiffSnapshots(prevSnap, snap)
+			if b, err := json.Marshal(diff); err == nil {
+				run.Diff = string(b)
+			}
+		}
+	}
+
+	if _, err := storage.SaveRun(ctx, run, maxRuns); err != nil {
+		slog.Error(fmt.Sprintf("保存检测记录失败: %v", err))
+	}
+	return diff
+}
+
+// restoreResults 根据最近一次检测的快照恢复发布的节点，供重启后首次检测完成前使用
+// 没有记录或数据库不可用时返回 nil
+func (app *App) restoreResults() []check.Result {
+	if storage.DB == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	run, err := storage.LatestRun(ctx)
+	if err != nil {
+		slog.Error(fmt.Sprintf("查询上一次检测记录失败: %v", err))
+		return nil
+	}
+	if run == nil || run.Snapshot == "" {
+		return nil
+	}
+	var snap map[string]save.NodeState
+	if err := json.Unmarshal([]byte(run.Snapshot), &snap); err != nil {
+		slog.Error(fmt.Sprintf("解析上一次检测快照失败: %v", err))
+		return nil
+	}
+	results := make([]check.Result, 0, len(snap))
+	for fp := range snap {
+		js, err := storage.QueryLatestResultJSON(ctx, fp)
+		if err != nil || js == "" {
+			continue
+		}
+		var r check.Result
+		if err := json.Unmarshal([]byte(js), &r); err != nil || r.Proxy == nil {
+			continue
+		}
+		r.Fingerprint = fp
+		results = append(results, r)
+	}
+	// 快照不保留顺序，按速度排序
+	less, _ := save.ParseSort("speed")
+	sort.SliceStable(results, func(i, j int) bool { return less(results[i], results[j]) })
+	return results
+}
+
+// listRuns 查询最近的检测记录
+func (app *App) listRuns(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	items, err := storage.ListRuns(ctx, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+// getRunDiff 查询检测记录与上一次检测的差异，首次检测的 diff 为 null
+func (app *App) getRunDiff(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	run, err := storage.GetRun(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if run == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var diff *save.RunDiff
+	if run.Diff != "" {
+		diff = &save.RunDiff{}
+		if err := json.Unmarshal([]byte(run.Diff), diff); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	resp := gin.H{
+		"id":         run.ID,
+		"status":     run.Status,
+		"startedAt":  run.StartedAt,
+		"finishedAt": run.FinishedAt,
+		"total":      run.Total,
+		"available":  run.Available,
+		"diff":       diff,
+	}
+	if diff != nil {
+		resp["summary"] = diff.Summary()
+	}
+	c.JSON(http.StatusOK, resp)
+}
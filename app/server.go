@@ -4,11 +4,15 @@ import (
 	"bufio"
 	"context"
 	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +20,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/twj0/subcheck/check"
 	"github.com/twj0/subcheck/config"
+	proxyutils "github.com/twj0/subcheck/proxy"
+	"github.com/twj0/subcheck/save"
 	"github.com/twj0/subcheck/save/method"
 	"github.com/twj0/subcheck/storage"
 	"gopkg.in/yaml.v3"
@@ -31,17 +37,28 @@ func (app *App) initHttpServer() error {
 		return fmt.Errorf("获取http监听目录失败: %w", err)
 	}
 
+	// 只信任本机反向代理的 X-Forwarded-For，避免伪造来源 IP 绕过分享令牌的 IP 白名单
+	if err := router.SetTrustedProxies([]string{"127.0.0.1", "::1"}); err != nil {
+		return fmt.Errorf("设置可信代理失败: %w", err)
+	}
+
 	// 静态文件路由 - 订阅服务相关，始终启用
+	// 开启 share-token-required 后需要携带分享令牌
+	sub := router.Group("/", app.shareTokenMiddleware())
 	// 最初不应该不带路径，现在保持兼容
-	router.StaticFile("/all.yaml", saver.OutputPath+"/all.yaml")
-	router.StaticFile("/all.txt", saver.OutputPath+"/all.txt")
-	router.StaticFile("/base64.txt", saver.OutputPath+"/base64.txt")
-	router.StaticFile("/mihomo.yaml", saver.OutputPath+"/mihomo.yaml")
-	router.StaticFile("/ACL4SSR_Online_Full.yaml", saver.OutputPath+"/ACL4SSR_Online_Full.yaml")
+	sub.StaticFile("/all.yaml", saver.OutputPath+"/all.yaml")
+	sub.StaticFile("/all.txt", saver.OutputPath+"/all.txt")
+	sub.StaticFile("/base64.txt", saver.OutputPath+"/base64.txt")
+	sub.StaticFile("/mihomo.yaml", saver.OutputPath+"/mihomo.yaml")
+	sub.StaticFile("/links.txt", saver.OutputPath+"/links.txt")
+	sub.StaticFile("/sing-box.json", saver.OutputPath+"/sing-box.json")
+	sub.StaticFile("/ACL4SSR_Online_Full.yaml", saver.OutputPath+"/ACL4SSR_Online_Full.yaml")
 	// CM佬用的布丁狗
-	router.StaticFile("/bdg.yaml", saver.OutputPath+"/bdg.yaml")
+	sub.StaticFile("/bdg.yaml", saver.OutputPath+"/bdg.yaml")
 
-	router.Static("/sub/", saver.OutputPath)
+	sub.Group("/sub", hideHistory()).Static("/", saver.OutputPath)
+	// 动态订阅，使用 sub-token 或允许 sub 输出的分享令牌认证
+	router.GET("/api/sub", app.getSub)
 
 	// 根据配置决定是否启用Web控制面板
 	if config.GlobalConfig.EnableWebUI {
@@ -67,6 +84,7 @@ func (app *App) initHttpServer() error {
 
 			// 状态相关API
 			api.GET("/status", app.getStatus)
+			api.GET("/status/nodes", app.getNodeHealth)
 			api.POST("/trigger-check", app.triggerCheckHandler)
 			api.POST("/test/ip-quality", app.triggerIPQualityHandler)
 			api.POST("/force-close", app.forceCloseHandler)
@@ -78,14 +96,37 @@ func (app *App) initHttpServer() error {
 
 			// 数据查询API
 			api.GET("/results/ip-quality", app.getIPQualityResults)
+			api.GET("/results/ip-quality/:id", app.getIPQualityResult)
 			api.GET("/results/speed", app.getSpeedResults)
 			api.GET("/results/dashboard", app.getDashboardStats)
+			api.GET("/ip-providers", app.getIPProviderStats)
+
+			// 保留节点API
+			api.GET("/kept-proxies", app.listKeptProxies)
+			api.DELETE("/kept-proxies", app.purgeKeptProxies)
+			api.DELETE("/kept-proxies/:fingerprint", app.deleteKeptProxy)
 
 			// 订阅管理API
 			api.GET("/subscriptions", app.listSubscriptions)
 			api.POST("/subscriptions", app.createSubscription)
 			api.PUT("/subscriptions/:id", app.updateSubscription)
 			api.DELETE("/subscriptions/:id", app.deleteSubscription)
+
+			// 分享令牌API
+			api.GET("/share-tokens", app.listShareTokens)
+			api.POST("/share-tokens", app.createShareToken)
+			api.DELETE("/share-tokens/:id", app.deleteShareToken)
+
+			// 检测记录API
+			api.GET("/runs", app.listRuns)
+			api.GET("/runs/:id/diff", app.getRunDiff)
+
+			// webhook 投递记录
+			api.GET("/webhooks/deliveries", app.listWebhookDeliveries)
+
+			// 输出历史版本API
+			api.GET("/output/history", app.listOutputHistory)
+			api.POST("/output/rollback/:id", app.rollbackOutput)
 		}
 
 		// 配置页面
@@ -106,6 +147,9 @@ func (app *App) initHttpServer() error {
 		router.GET("/admin/subscriptions", func(c *gin.Context) {
 			c.HTML(http.StatusOK, "subscriptions.html", gin.H{})
 		})
+		router.GET("/admin/share-tokens", func(c *gin.Context) {
+			c.HTML(http.StatusOK, "share_tokens.html", gin.H{})
+		})
 	} else {
 		slog.Info("Web控制面板已禁用")
 	}
@@ -135,6 +179,70 @@ func (app *App) authMiddleware(key string) gin.HandlerFunc {
 	}
 }
 
+// getSub 按查询参数筛选最新的检测结果并转换为指定格式的订阅
+// token 既不是 sub-token 也不是允许 sub 输出的分享令牌时返回 404
+func (app *App) getSub(c *gin.Context) {
+	token := config.GlobalConfig.SubToken
+	if (token == "" || subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(token)) != 1) && !app.checkShareToken(c, "sub") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	q := save.SubQuery{
+		Target:    c.Query("target"),
+		Countries: splitQuery(c.Query("country")),
+		Platforms: splitQuery(strings.ToLower(c.Query("platform"))),
+		Types:     splitQuery(c.Query("type")),
+		Sort:      c.Query("sort"),
+		MaxRisk:   -1,
+	}
+	for key, dst := range map[string]*int{"min-speed": &q.MinSpeed, "max-risk": &q.MaxRisk, "limit": &q.Limit} {
+		if v := c.Query(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("参数 %s 无效: %s", key, v)})
+				return
+			}
+			*dst = n
+		}
+	}
+
+	data, contentType, err := save.Render(app.health.Results(), q)
+	if errors.Is(err, save.ErrNoProxies) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// hideHistory 历史版本保存在输出目录下，不通过 /sub/ 对外提供
+func hideHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 与文件服务一样先清理路径，避免 /sub/x/../history/ 绕过
+		p := strings.TrimPrefix(path.Clean("/"+c.Param("filepath")), "/")
+		if p == method.HistoryDirName || strings.HasPrefix(p, method.HistoryDirName+"/") {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Next()
+	}
+}
+
+// splitQuery 拆分逗号分隔的查询参数
+func splitQuery(v string) []string {
+	var list []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
 // getConfig 获取配置文件内容
 func (app *App) getConfig(c *gin.Context) {
 	configData, err := os.ReadFile(app.configPath)
@@ -164,6 +272,15 @@ func (app *App) updateConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("YAML格式错误: %v", err)})
 		return
 	}
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(req.Content), &cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("配置格式错误: %v", err)})
+		return
+	}
+	if err := save.ValidateOutputs(cfg.Outputs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("outputs 配置无效: %v", err)})
+		return
+	}
 
 	// 写入新配置
 	if err := os.WriteFile(app.configPath, []byte(req.Content), 0644); err != nil {
@@ -177,13 +294,23 @@ func (app *App) updateConfig(c *gin.Context) {
 
 // getStatus 获取应用状态
 func (app *App) getStatus(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	status := gin.H{
 		"checking":   app.checking.Load(),
 		"ipChecking": app.ipChecking.Load(),
 		"proxyCount": check.ProxyCount.Load(),
 		"available":  check.Available.Load(),
 		"progress":   check.Progress.Load(),
-	})
+		"reused":     check.Reused.Load(),
+	}
+	if app.gateway != nil {
+		status["gatewayNodes"] = app.gateway.Len()
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// getNodeHealth 已发布节点的健康状态
+func (app *App) getNodeHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": app.health.Status()})
 }
 
 // triggerCheckHandler 手动触发检测
@@ -243,6 +370,74 @@ func (app *App) getIPQualityResults(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "page": page, "pageSize": size})
 }
 
+// getIPQualityResult 查询单条检测结果，包含每个接口的结果与完整报告
+func (app *App) getIPQualityResult(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	item, err := storage.GetIPQualityResult(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	providers, err := storage.QueryIPQualityProviderResults(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var report json.RawMessage
+	if item.ReportJSON.Valid && json.Valid([]byte(item.ReportJSON.String)) {
+		report = json.RawMessage(item.ReportJSON.String)
+	}
+	item.ReportJSON = sql.NullString{}
+	c.JSON(http.StatusOK, gin.H{"item": item, "providers": providers, "report": report})
+}
+
+// listKeptProxies 列出 keep-success-proxies 保留的节点
+func (app *App) listKeptProxies(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	items, err := storage.ListKeptProxies(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+// deleteKeptProxy 删除一个保留的节点
+func (app *App) deleteKeptProxy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	if err := storage.DeleteKeptProxy(ctx, c.Param("fingerprint")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	app.loadKeptProxies()
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
+
+// purgeKeptProxies 清空保留的节点
+func (app *App) purgeKeptProxies(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	n, err := storage.PurgeKeptProxies(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	config.GlobalProxies = make([]map[string]any, 0)
+	c.JSON(http.StatusOK, gin.H{"message": "已清空", "deleted": n})
+}
+
 func (app *App) getSpeedResults(c *gin.Context) {
 	page, _ := strconv.Atoi(c.Query("page"))
 	size, _ := strconv.Atoi(c.Query("page_size"))
@@ -281,6 +476,11 @@ func (app *App) getDashboardStats(c *gin.Context) {
 	c.JSON(http.StatusOK, d)
 }
 
+// getIPProviderStats 出口IP查询接口的成功率与当前排序
+func (app *App) getIPProviderStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": proxyutils.GetProviderStats()})
+}
+
 func (app *App) listSubscriptions(c *gin.Context) {
 	page, _ := strconv.Atoi(c.Query("page"))
 	size, _ := strconv.Atoi(c.Query("page_size"))
@@ -353,6 +553,45 @@ func (app *App) deleteSubscription(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
+// listOutputHistory 列出订阅文件的历史版本
+func (app *App) listOutputHistory(c *gin.Context) {
+	items, err := save.ListGenerations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+// rollbackOutput 将订阅文件回滚到指定历史版本，检测进行中时拒绝，避免被本次检测结果覆盖
+func (app *App) rollbackOutput(c *gin.Context) {
+	if app.checking.Load() {
+		c.JSON(http.StatusConflict, gin.H{"error": "检测进行中，请稍后再回滚"})
+		return
+	}
+	app.saveMu.Lock()
+	g, err := save.Rollback(c.Param("id"))
+	app.saveMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "generation": g})
+}
+
+// listWebhookDeliveries 查询最近的 webhook 投递记录
+func (app *App) listWebhookDeliveries(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	items, err := storage.ListWebhookDeliveries(ctx, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
 func ReadLastNLines(filePath string, n int) ([]string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/storage"
+)
+
+// shareTokenMiddleware 需要分享令牌时，订阅文件必须携带有效的 ?token= 才能访问，
+// 否则返回 404，避免暴露订阅地址的存在
+func (app *App) shareTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !shareTokenRequired(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		output := outputName(c.Request.URL.Path)
+		// 本机的 sub-store 通过 mihomo-overwrite-url 拉取模板，模板中不含节点
+		if output == "clash_template.yaml" && net.ParseIP(c.RemoteIP()).IsLoopback() {
+			c.Next()
+			return
+		}
+		if !app.checkShareToken(c, output) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Next()
+	}
+}
+
+// shareTokenRequired 是否要求分享令牌，share-token-required 未设置时创建了任一分享令牌即要求，
+// 查询失败时按要求处理
+func shareTokenRequired(ctx context.Context) bool {
+	if v := config.GlobalConfig.ShareTokenRequired; v != nil {
+		return *v
+	}
+	if storage.DB == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	n, err := storage.CountShareTokens(ctx)
+	if err != nil {
+		slog.Error(fmt.Sprintf("查询分享令牌失败: %v", err))
+		return true
+	}
+	return n > 0
+}
+
+// outputName 订阅文件相对输出目录的路径，/sub/jp.yaml 与 /jp.yaml 都为 jp.yaml，
+// 子目录中的文件保留目录，不能使用只允许同名文件的令牌访问
+func outputName(urlPath string) string {
+	p := path.Clean("/" + urlPath)
+	if p == "/sub" || strings.HasPrefix(p, "/sub/") {
+		p = strings.TrimPrefix(p, "/sub")
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// checkShareToken 校验请求携带的分享令牌能否访问指定输出，通过时记录本次访问
+func (app *App) checkShareToken(c *gin.Context, output string) bool {
+	token := c.Query("token")
+	if token == "" || storage.DB == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	t, err := storage.GetShareToken(ctx, token)
+	if err != nil {
+		slog.Error(fmt.Sprintf("查询分享令牌失败: %v", err))
+		return false
+	}
+	if t == nil {
+		return false
+	}
+	if t.ExpiresAt.Valid && time.Now().After(t.ExpiresAt.Time) {
+		return false
+	}
+	if len(t.Outputs) > 0 && !slices.Contains(t.Outputs, output) {
+		return false
+	}
+	ip := c.ClientIP()
+	if len(t.IPAllowlist) > 0 && !ipAllowed(ip, t.IPAllowlist) {
+		slog.Debug(fmt.Sprintf("分享令牌 %s 拒绝来自 %s 的访问", t.Name, ip))
+		return false
+	}
+	if err := storage.RecordShareTokenAccess(ctx, t.ID, ip, c.Request.UserAgent()); err != nil {
+		slog.Debug(fmt.Sprintf("记录分享令牌访问失败: %v", err))
+	}
+	return true
+}
+
+// ipAllowed 判断 IP 是否在允许列表中，列表项可以是单个 IP 或 CIDR
+func ipAllowed(ip string, allowlist []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowlist {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// listShareTokens 查询所有分享令牌
+func (app *App) listShareTokens(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	items, err := storage.ListShareTokens(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+}
+
+// createShareToken 创建分享令牌，令牌随机生成
+func (app *App) createShareToken(c *gin.Context) {
+	var req struct {
+		Name          string   `json:"name"`
+		Outputs       []string `json:"outputs"`
+		IPAllowlist   []string `json:"ipAllowlist"`
+		ExpiresInDays int      `json:"expiresInDays"` // 0 为永不过期
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	t := storage.ShareToken{Name: strings.TrimSpace(req.Name)}
+	if t.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名称不能为空"})
+		return
+	}
+	for _, o := range req.Outputs {
+		if o = strings.TrimSpace(o); o != "" {
+			t.Outputs = append(t.Outputs, o)
+		}
+	}
+	for _, entry := range req.IPAllowlist {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的 IP 或 CIDR: %s", entry)})
+			return
+		}
+		t.IPAllowlist = append(t.IPAllowlist, entry)
+	}
+	if req.ExpiresInDays > 0 {
+		t.ExpiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays).UTC(), Valid: true}
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	t.Token = hex.EncodeToString(buf)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	id, err := storage.CreateShareToken(ctx, t)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "token": t.Token})
+}
+
+// deleteShareToken 吊销分享令牌
+func (app *App) deleteShareToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	if err := storage.DeleteShareToken(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -8,8 +8,9 @@ import (
 	"math"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,6 +22,7 @@ import (
 	"github.com/metacubex/mihomo/constant"
 	"github.com/twj0/subcheck/check/platform"
 	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/ipcheck"
 	proxyutils "github.com/twj0/subcheck/proxy"
 )
 
@@ -37,9 +39,23 @@ type Result struct {
 	Gemini     bool
 	TikTok     string
 	IP         string
-	IPRisk     string
+	IPRisk     string          // 风险分数，如 12%
+	Risk       *ipcheck.Report // IP风险检测的完整结果
 	Country    string
+	City       string
+	ASN        string
+	ISP        string
 	SpeedKBps  int
+	Latency    int // 延迟测试耗时(毫秒)
+	// 双栈检测结果，需开启 ip-stack
+	IPv4        string
+	IPv4Country string
+	IPv6        string
+	IPv6Country string
+	IPStack     string // v4/v6/dual
+	// 增量检测
+	Fingerprint string // 节点连接参数的指纹
+	Reused      bool   // 结果复用自 TTL 内的完整检测，本次只做了存活探测
 }
 
 // ProxyChecker 处理代理检测的主要结构体
@@ -56,12 +72,16 @@ type ProxyChecker struct {
 var Progress atomic.Uint32
 var Available atomic.Uint32
 var ProxyCount atomic.Uint32
+var Reused atomic.Uint32
 var TotalBytes atomic.Uint64
 
 var ForceClose atomic.Bool
 
 var Bucket *ratelimit.Bucket
 
+// PreCheckHook 去重后、检测前调用，可以修改节点列表，返回错误时取消本次检测
+var PreCheckHook func(proxies []map[string]any) ([]map[string]any, error)
+
 // NewProxyChecker 创建新的检测器实例
 func NewProxyChecker(proxyCount int) *ProxyChecker {
 	threadCount := config.GlobalConfig.Concurrent
@@ -87,6 +107,7 @@ func Check() ([]Result, error) {
 	ProxyCount.Store(0)
 	Available.Store(0)
 	Progress.Store(0)
+	Reused.Store(0)
 
 	TotalBytes.Store(0)
 
@@ -100,15 +121,23 @@ func Check() ([]Result, error) {
 	if err != nil {
 		return nil, fmt.Errorf("获取节点失败: %w", err)
 	}
+	recordOriginalNames(proxies, tmp)
 	proxies = append(proxies, tmp...)
 	slog.Info(fmt.Sprintf("获取节点数量: %d", len(proxies)))
 
-	// 重置全局节点
-	config.GlobalProxies = make([]map[string]any, 0)
-
 	proxies = proxyutils.DeduplicateProxies(proxies)
 	slog.Info(fmt.Sprintf("去重后节点数量: %d", len(proxies)))
 
+	// 检测前脚本否决时保留之前测试成功的节点
+	if PreCheckHook != nil {
+		if proxies, err = PreCheckHook(proxies); err != nil {
+			return nil, err
+		}
+	}
+
+	// 重置全局节点
+	config.GlobalProxies = make([]map[string]any, 0)
+
 	checker := NewProxyChecker(len(proxies))
 	return checker.run(proxies)
 }
@@ -163,6 +192,10 @@ func (pc *ProxyChecker) run(proxies []map[string]any) ([]Result, error) {
 		slog.Warn(fmt.Sprintf("达到节点数量限制: %d", config.GlobalConfig.SuccessLimit))
 	}
 	slog.Info(fmt.Sprintf("可用节点数量: %d", len(pc.results)))
+	if config.GlobalConfig.Incremental.Enabled {
+		reused := int(Reused.Load())
+		slog.Info(fmt.Sprintf("增量检测: 复用 %d 个节点的结果，完整检测 %d 个节点", reused, len(pc.results)-reused))
+	}
 	slog.Info(fmt.Sprintf("测试总消耗流量: %.3fGB", float64(TotalBytes.Load())/1024/1024/1024))
 
 	// 检查订阅成功率并发出警告
@@ -185,7 +218,8 @@ func (pc *ProxyChecker) worker(wg *sync.WaitGroup) {
 // checkProxy 检测单个代理
 func (pc *ProxyChecker) checkProxy(proxy map[string]any) *Result {
 	res := &Result{
-		Proxy: proxy,
+		Proxy:       proxy,
+		Fingerprint: proxyutils.Fingerprint(proxy),
 	}
 
 	if os.Getenv("SUB_CHECK_SKIP") != "" {
@@ -200,10 +234,24 @@ func (pc *ProxyChecker) checkProxy(proxy map[string]any) *Result {
 	}
 	defer httpClient.Close()
 
+	start := time.Now()
 	google, err := platform.CheckAlive(httpClient.Client)
 	if err != nil || !google {
 		return nil
 	}
+	res.Latency = int(time.Since(start).Milliseconds())
+
+	// 最近完整检测通过的节点只做存活探测，复用测速与流媒体结果
+	if prev := lastResult(res.Fingerprint); prev != nil {
+		prev.Proxy = proxy
+		prev.Fingerprint = res.Fingerprint
+		prev.Latency = res.Latency
+		prev.Reused = true
+		pc.updateProxyName(prev, httpClient, prev.SpeedKBps)
+		pc.incrementAvailable()
+		Reused.Add(1)
+		return prev
+	}
 
 	var speed int
 	if config.GlobalConfig.SpeedTestUrl != "" {
@@ -214,6 +262,13 @@ func (pc *ProxyChecker) checkProxy(proxy map[string]any) *Result {
 		res.SpeedKBps = speed
 	}
 
+	if config.GlobalConfig.IPStack.Enabled {
+		stack := proxyutils.GetProxyStack(httpClient.Client)
+		res.IPv4, res.IPv4Country = stack.IPv4.IP, stack.IPv4.Country
+		res.IPv6, res.IPv6Country = stack.IPv6.IP, stack.IPv6.Country
+		res.IPStack = stack.Stack()
+	}
+
 	if config.GlobalConfig.MediaCheck {
 		// 遍历需要检测的平台
 		for _, plat := range config.GlobalConfig.Platforms {
@@ -242,15 +297,33 @@ func (pc *ProxyChecker) checkProxy(proxy map[string]any) *Result {
 					res.Gemini = true
 				}
 			case "iprisk":
-				country, ip := proxyutils.GetProxyCountry(httpClient.Client)
-				if ip == "" {
+				info := proxyutils.GetProxyInfo(httpClient.Client)
+				if info.IP == "" {
 					break
 				}
-				res.IP = ip
-				res.Country = country
-				risk, err := platform.CheckIPRisk(httpClient.Client, ip)
+				res.IP = info.IP
+				res.Country = info.Country
+				res.City, res.ASN, res.ISP = info.City, info.ASN, info.ISP
+				// 同一出口IP复用缓存，等待限速超过1分钟的节点跳过风险检测
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				rep, err := ipcheck.Lookup(ctx, info.IP, ipcheck.KindChain, func(ctx context.Context) (*ipcheck.Report, error) {
+					risk, err := ipcheck.CheckChain(ctx, httpClient.Client, info.IP)
+					if err != nil {
+						return nil, err
+					}
+					rep := ipcheck.NewReport(info.IP, risk)
+					if rep.CountryCode == "" {
+						rep.CountryCode = info.Country
+					}
+					return rep, nil
+				})
+				cancel()
 				if err == nil {
-					res.IPRisk = risk
+					res.Risk = rep
+					// 没有接口给出分数时不显示风险分数
+					if rep.FraudScore >= 0 {
+						res.IPRisk = fmt.Sprintf("%d%%", rep.FraudScore)
+					}
 				} else {
 					// 失败的可能性高，所以放上日志
 					slog.Debug(fmt.Sprintf("查询IP风险失败: %v", err))
@@ -268,93 +341,6 @@ func (pc *ProxyChecker) checkProxy(proxy map[string]any) *Result {
 	return res
 }
 
-func (pc *ProxyChecker) updateProxyName(res *Result, httpClient *ProxyClient, speed int) {
-	// 以节点IP查询位置重命名节点
-	if config.GlobalConfig.RenameNode {
-		if res.Country != "" {
-			res.Proxy["name"] = config.GlobalConfig.NodePrefix + proxyutils.Rename(res.Country)
-		} else {
-			country, ip := proxyutils.GetProxyCountry(httpClient.Client)
-			res.Proxy["name"] = config.GlobalConfig.NodePrefix + proxyutils.Rename(country)
-			if res.IP == "" && ip != "" {
-				res.IP = ip
-			}
-		}
-	}
-
-	name, ok := res.Proxy["name"].(string)
-	if !ok {
-		name = "Unknown"
-	}
-	name = strings.TrimSpace(name)
-
-	var tags []string
-	// 获取速度
-	if config.GlobalConfig.SpeedTestUrl != "" {
-		name = regexp.MustCompile(`\s*\|(?:\s*[\d.]+[KM]B/s)`).ReplaceAllString(name, "")
-		var speedStr string
-		if speed < 1024 {
-			speedStr = fmt.Sprintf("%dKB/s", speed)
-		} else {
-			speedStr = fmt.Sprintf("%.1fMB/s", float64(speed)/1024)
-		}
-		tags = append(tags, speedStr)
-	}
-
-	if config.GlobalConfig.MediaCheck {
-		// 移除已有的标记（IPRisk和平台标记）
-		name = regexp.MustCompile(`\s*\|(?:NF|D\+|GPT⁺|GPT|GM|YT-[^|]+|TK-[^|]+|\d+%)`).ReplaceAllString(name, "")
-	}
-
-	// 按用户输入顺序定义
-	for _, plat := range config.GlobalConfig.Platforms {
-		switch plat {
-		case "openai":
-			if res.Openai {
-				tags = append(tags, "GPT⁺")
-			} else if res.OpenaiWeb {
-				tags = append(tags, "GPT")
-			}
-		case "netflix":
-			if res.Netflix {
-				tags = append(tags, "NF")
-			}
-		case "disney":
-			if res.Disney {
-				tags = append(tags, "D+")
-			}
-		case "gemini":
-			if res.Gemini {
-				tags = append(tags, "GM")
-			}
-		case "iprisk":
-			if res.IPRisk != "" {
-				tags = append(tags, res.IPRisk)
-			}
-		case "youtube":
-			if res.Youtube != "" {
-				tags = append(tags, fmt.Sprintf("YT-%s", res.Youtube))
-			}
-		case "tiktok":
-			if res.TikTok != "" {
-				tags = append(tags, fmt.Sprintf("TK-%s", res.TikTok))
-			}
-		}
-	}
-
-	if tag, ok := res.Proxy["sub_tag"].(string); ok && tag != "" {
-		tags = append(tags, tag)
-	}
-
-	// 将所有标记添加到名称中
-	if len(tags) > 0 {
-		name += "|" + strings.Join(tags, "|")
-	}
-
-	res.Proxy["name"] = name
-
-}
-
 // showProgress 显示进度条
 func (pc *ProxyChecker) showProgress(done chan bool) {
 	for {
@@ -422,6 +408,25 @@ func (pc *ProxyChecker) collectResults() {
 	}
 }
 
+// SubResult 订阅在最近一次检测中的获取结果与节点通过情况
+type SubResult struct {
+	proxyutils.SubStatus
+	Checked int // 去重后参与检测的节点数量
+	Passed  int // 检测通过的节点数量
+}
+
+var (
+	subResultsMu sync.Mutex
+	subResults   []SubResult
+)
+
+// SubResults 返回最近一次检测中各订阅的节点通过情况
+func SubResults() []SubResult {
+	subResultsMu.Lock()
+	defer subResultsMu.Unlock()
+	return slices.Clone(subResults)
+}
+
 // checkSubscriptionSuccessRate 检查订阅成功率并发出警告
 func (pc *ProxyChecker) checkSubscriptionSuccessRate(allProxies []map[string]any) {
 	// 统计每个订阅的节点总数和成功数
@@ -452,6 +457,16 @@ func (pc *ProxyChecker) checkSubscriptionSuccessRate(allProxies []map[string]any
 		}
 	}
 
+	statuses := proxyutils.SubStatuses()
+	list := make([]SubResult, 0, len(statuses))
+	for _, st := range statuses {
+		stats := subStats[st.URL]
+		list = append(list, SubResult{SubStatus: st, Checked: stats.total, Passed: stats.success})
+	}
+	subResultsMu.Lock()
+	subResults = list
+	subResultsMu.Unlock()
+
 	// 检查成功率并发出警告
 	for subUrl, stats := range subStats {
 		if stats.total > 0 {
@@ -497,10 +512,16 @@ func CreateClient(mapping map[string]any) *ProxyClient {
 			if port, err := strconv.ParseUint(port, 10, 16); err == nil {
 				u16Port = uint16(port)
 			}
-			return proxy.DialContext(ctx, &constant.Metadata{
+			metadata := &constant.Metadata{
 				Host:    host,
 				DstPort: u16Port,
-			})
+			}
+			// IP字面量按地址类型传给节点，否则会被当作域名，IPv6探测无法生效
+			if ip, err := netip.ParseAddr(host); err == nil {
+				metadata.Host = ""
+				metadata.DstIP = ip.Unmap()
+			}
+			return proxy.DialContext(ctx, metadata)
 		},
 		DisableKeepAlives: true,
 	}
@@ -518,6 +539,11 @@ func CreateClient(mapping map[string]any) *ProxyClient {
 	}
 }
 
+// Proxy 返回底层的 mihomo 节点，用于为节点启动本地入站
+func (pc *ProxyClient) Proxy() constant.Proxy {
+	return pc.proxy
+}
+
 // Close closes the proxy client and cleans up resources
 // 防止底层库有一些泄露，所以这里手动关闭
 func (pc *ProxyClient) Close() {
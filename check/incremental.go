@@ -0,0 +1,55 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/storage"
+)
+
+// lastResult 返回指纹在 incremental.ttl-hours 内最近一次完整检测的结果
+// 未开启增量检测、没有记录或记录已不满足当前测速要求时返回 nil
+func lastResult(fingerprint string) *Result {
+	cfg := config.GlobalConfig.Incremental
+	if !cfg.Enabled || cfg.TTLHours <= 0 || fingerprint == "" || storage.DB == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	js, err := storage.QueryRecentResultJSON(ctx, fingerprint, cfg.TTLHours)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("读取增量检测记录失败: %v", err))
+		return nil
+	}
+	if js == "" {
+		return nil
+	}
+	var res Result
+	if err := json.Unmarshal([]byte(js), &res); err != nil {
+		slog.Debug(fmt.Sprintf("解析增量检测记录失败: %v", err))
+		return nil
+	}
+	// 测速配置变化后，之前的速度可能已经不达标
+	if config.GlobalConfig.SpeedTestUrl != "" && (res.SpeedKBps <= 0 || res.SpeedKBps < config.GlobalConfig.MinSpeed) {
+		return nil
+	}
+	return &res
+}
+
+// ResultJSON 序列化完整检测的结果供增量检测复用，不保存 ip.sh 的原始报告
+func ResultJSON(res Result) (string, error) {
+	if res.Risk != nil {
+		risk := *res.Risk
+		risk.Raw = nil
+		res.Risk = &risk
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
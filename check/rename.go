@@ -0,0 +1,291 @@
+package check
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/twj0/subcheck/config"
+	proxyutils "github.com/twj0/subcheck/proxy"
+)
+
+var (
+	speedTagRe    = regexp.MustCompile(`\s*\|(?:\s*[\d.]+[KM]B/s)`)
+	platformTagRe = regexp.MustCompile(`\s*\|(?:NF|D\+|GPT⁺|GPT|GM|YT-[^|]+|TK-[^|]+|\d+%)`)
+)
+
+// RenameData 是 rename-template 中可以使用的字段
+type RenameData struct {
+	Name      string   // 原始节点名称
+	Prefix    string   // node-prefix
+	Country   string   // 国家代码，如 US
+	Flag      string   // 国旗 emoji
+	City      string   // 城市
+	ASN       string   // ASN，如 AS13335
+	ISP       string   // ASN 所属组织
+	IP        string   // 出口IP
+	Speed     string   // 格式化后的速度，如 1.2MB/s
+	SpeedKBps int      // 速度(KB/s)
+	Latency   int      // 延迟(毫秒)
+	Tags      []string // 平台标记，按 platforms 的顺序，如 NF、GPT⁺、YT-US
+	SubTag    string   // 订阅备注
+	Protocol  string   // 协议类型，如 vmess
+	Index     int      // 同一国家内的序号，从 1 开始
+	Stack     string   // 出口IP栈 v4/v6/dual，需开启 ip-stack
+	IPv4      string   // IPv4 出口
+	IPv6      string   // IPv6 出口
+}
+
+var renameFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// originalNames 按节点指纹记录原始名称，不写入代理map，避免输出到订阅文件
+// 重命名时总是基于原始名称，避免每次都用正则清理上一次追加的标记
+var (
+	originalNamesLock sync.Mutex
+	originalNames     = make(map[string]string)
+)
+
+var (
+	renameTmplLock sync.Mutex
+	renameTmplText string
+	renameTmpl     *template.Template
+)
+
+// getRenameTemplate 解析并缓存 rename-template，配置变化时重新解析
+func getRenameTemplate(text string) (*template.Template, error) {
+	renameTmplLock.Lock()
+	defer renameTmplLock.Unlock()
+
+	if renameTmpl != nil && renameTmplText == text {
+		return renameTmpl, nil
+	}
+	t, err := template.New("rename").Funcs(renameFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	renameTmpl, renameTmplText = t, text
+	return t, nil
+}
+
+// recordOriginalNames 记录本次从订阅获取的节点名称，保留节点沿用之前记录的原始名称，
+// 其余记录丢弃
+func recordOriginalNames(kept, fetched []map[string]any) {
+	originalNamesLock.Lock()
+	defer originalNamesLock.Unlock()
+
+	names := make(map[string]string, len(kept)+len(fetched))
+	for _, proxy := range kept {
+		fp := proxyutils.Fingerprint(proxy)
+		if name, ok := originalNames[fp]; ok {
+			names[fp] = name
+		}
+	}
+	for _, proxy := range fetched {
+		if name, ok := proxy["name"].(string); ok && name != "" {
+			names[proxyutils.Fingerprint(proxy)] = name
+		}
+	}
+	originalNames = names
+}
+
+// originalName 获取节点的原始名称，没有记录的节点以当前名称作为原始名称
+func originalName(res *Result) string {
+	originalNamesLock.Lock()
+	defer originalNamesLock.Unlock()
+
+	// 旧版本保存的节点带有原始名称字段，取出后从代理map中移除
+	if name, ok := res.Proxy[proxyutils.OriginalNameKey].(string); ok {
+		delete(res.Proxy, proxyutils.OriginalNameKey)
+		if name != "" {
+			originalNames[res.Fingerprint] = name
+			return name
+		}
+	}
+	if name, ok := originalNames[res.Fingerprint]; ok && res.Fingerprint != "" {
+		return name
+	}
+	name, ok := res.Proxy["name"].(string)
+	if !ok {
+		name = "Unknown"
+	}
+	// 重启后保留的节点没有记录，只能清理掉之前追加的标记
+	name = speedTagRe.ReplaceAllString(name, "")
+	name = platformTagRe.ReplaceAllString(name, "")
+	name = strings.TrimSpace(name)
+	if res.Fingerprint != "" {
+		originalNames[res.Fingerprint] = name
+	}
+	return name
+}
+
+// formatSpeed 将 KB/s 格式化为可读的速度
+func formatSpeed(speed int) string {
+	if speed < 1024 {
+		return fmt.Sprintf("%dKB/s", speed)
+	}
+	return fmt.Sprintf("%.1fMB/s", float64(speed)/1024)
+}
+
+// platformTags 按用户输入的平台顺序生成标记
+func platformTags(res *Result) []string {
+	var tags []string
+	for _, plat := range config.GlobalConfig.Platforms {
+		switch plat {
+		case "openai":
+			if res.Openai {
+				tags = append(tags, "GPT⁺")
+			} else if res.OpenaiWeb {
+				tags = append(tags, "GPT")
+			}
+		case "netflix":
+			if res.Netflix {
+				tags = append(tags, "NF")
+			}
+		case "disney":
+			if res.Disney {
+				tags = append(tags, "D+")
+			}
+		case "gemini":
+			if res.Gemini {
+				tags = append(tags, "GM")
+			}
+		case "iprisk":
+			if res.IPRisk != "" {
+				tags = append(tags, res.IPRisk)
+			}
+		case "youtube":
+			if res.Youtube != "" {
+				tags = append(tags, fmt.Sprintf("YT-%s", res.Youtube))
+			}
+		case "tiktok":
+			if res.TikTok != "" {
+				tags = append(tags, fmt.Sprintf("TK-%s", res.TikTok))
+			}
+		}
+	}
+	return tags
+}
+
+func (pc *ProxyChecker) updateProxyName(res *Result, httpClient *ProxyClient, speed int) {
+	// 以节点IP查询位置重命名节点
+	if config.GlobalConfig.RenameNode && res.Country == "" {
+		info := proxyutils.GetProxyInfo(httpClient.Client)
+		res.Country = info.Country
+		res.City, res.ASN, res.ISP = info.City, info.ASN, info.ISP
+		if res.IP == "" && info.IP != "" {
+			res.IP = info.IP
+		}
+	}
+	// 出口IP查询接口都失败时，使用双栈检测的结果
+	if res.Country == "" {
+		switch {
+		case res.IPv4Country != "":
+			res.Country = res.IPv4Country
+		case res.IPv6Country != "":
+			res.Country = res.IPv6Country
+		}
+	}
+	if res.IP == "" {
+		res.IP = res.IPv4
+		if res.IP == "" {
+			res.IP = res.IPv6
+		}
+	}
+
+	name := originalName(res)
+
+	// 序号只取一次，模板渲染失败时默认命名沿用同一个序号
+	var index int
+	if config.GlobalConfig.RenameTemplate != "" || config.GlobalConfig.RenameNode {
+		index = proxyutils.NextIndex(res.Country)
+	}
+
+	if text := config.GlobalConfig.RenameTemplate; text != "" {
+		rendered, err := renderName(text, res, name, speed, index)
+		if err == nil {
+			res.Proxy["name"] = rendered
+			return
+		}
+		slog.Warn(fmt.Sprintf("rename-template 渲染失败，使用默认命名: %v", err))
+	}
+
+	if config.GlobalConfig.RenameNode {
+		name = config.GlobalConfig.NodePrefix + proxyutils.RenameIndex(res.Country, index)
+	}
+
+	var tags []string
+	// 获取速度
+	if config.GlobalConfig.SpeedTestUrl != "" {
+		tags = append(tags, formatSpeed(speed))
+	}
+	tags = append(tags, platformTags(res)...)
+	if res.IPStack != "" {
+		tags = append(tags, res.IPStack)
+	}
+
+	if tag, ok := res.Proxy["sub_tag"].(string); ok && tag != "" {
+		tags = append(tags, tag)
+	}
+
+	// 将所有标记添加到名称中
+	if len(tags) > 0 {
+		name += "|" + strings.Join(tags, "|")
+	}
+
+	res.Proxy["name"] = name
+}
+
+// renderName 使用 rename-template 生成节点名称
+func renderName(text string, res *Result, name string, speed, index int) (string, error) {
+	t, err := getRenameTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	flag := "❓"
+	if len(res.Country) == 2 {
+		flag = proxyutils.CountryCodeToFlag(res.Country)
+	}
+	subTag, _ := res.Proxy["sub_tag"].(string)
+	protocol, _ := res.Proxy["type"].(string)
+	data := RenameData{
+		Name:      name,
+		Prefix:    config.GlobalConfig.NodePrefix,
+		Country:   res.Country,
+		Flag:      flag,
+		City:      res.City,
+		ASN:       res.ASN,
+		ISP:       res.ISP,
+		IP:        res.IP,
+		SpeedKBps: speed,
+		Latency:   res.Latency,
+		Tags:      platformTags(res),
+		SubTag:    subTag,
+		Protocol:  protocol,
+		Index:     index,
+		Stack:     res.IPStack,
+		IPv4:      res.IPv4,
+		IPv6:      res.IPv6,
+	}
+	if config.GlobalConfig.SpeedTestUrl != "" {
+		data.Speed = formatSpeed(speed)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	out := strings.TrimSpace(buf.String())
+	if out == "" {
+		return "", fmt.Errorf("渲染结果为空")
+	}
+	return out, nil
+}
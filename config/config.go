@@ -3,73 +3,91 @@ package config
 import _ "embed"
 
 type Config struct {
-	PrintProgress        bool          `yaml:"print-progress"`
-	Concurrent           int           `yaml:"concurrent"`
-	CheckInterval        int           `yaml:"check-interval"`
-	CronExpression       string        `yaml:"cron-expression"`
-	AliveTestUrl         string        `yaml:"alive-test-url"`
-	SpeedTestUrl         string        `yaml:"speed-test-url"`
-	DownloadTimeout      int           `yaml:"download-timeout"`
-	DownloadMB           int           `yaml:"download-mb"`
-	TotalSpeedLimit      int           `yaml:"total-speed-limit"`
-	MinSpeed             int           `yaml:"min-speed"`
-	Timeout              int           `yaml:"timeout"`
-	FilterRegex          string        `yaml:"filter-regex"`
-	SaveMethod           any           `yaml:"save-method"`
-	WebDAVURL            string        `yaml:"webdav-url"`
-	WebDAVUsername       string        `yaml:"webdav-username"`
-	WebDAVPassword       string        `yaml:"webdav-password"`
-	GithubToken          string        `yaml:"github-token"`
-	GithubGistID         string        `yaml:"github-gist-id"`
-	GithubAPIMirror      string        `yaml:"github-api-mirror"`
-	GithubRawToken       string        `yaml:"github-raw-token"`
-	GithubRawOwner       string        `yaml:"github-raw-owner"`
-	GithubRawRepo        string        `yaml:"github-raw-repo"`
-	GithubRawBranch      string        `yaml:"github-raw-branch"`
-	GithubRawPath        string        `yaml:"github-raw-path"`
-	TelegraphToken       string        `yaml:"telegraph-token"`
-	TelegraphPath        string        `yaml:"telegraph-path"`
-	WorkerURL            string        `yaml:"worker-url"`
-	WorkerToken          string        `yaml:"worker-token"`
-	S3Endpoint           string        `yaml:"s3-endpoint"`
-	S3AccessID           string        `yaml:"s3-access-id"`
-	S3SecretKey          string        `yaml:"s3-secret-key"`
-	S3Bucket             string        `yaml:"s3-bucket"`
-	S3UseSSL             bool          `yaml:"s3-use-ssl"`
-	S3BucketLookup       string        `yaml:"s3-bucket-lookup"`
-	SubUrlsReTry         int           `yaml:"sub-urls-retry"`
-	SubUrlsRetryInterval int           `yaml:"sub-urls-retry-interval"`
-	SubUrlsTimeout       int           `yaml:"sub-urls-timeout"`
-	SubUrlsGetUA         string        `yaml:"sub-urls-get-ua"`
-	SubUrlsRemote        []string      `yaml:"sub-urls-remote"`
-	SubUrls              []string      `yaml:"sub-urls"`
-	SuccessRate          float32       `yaml:"success-rate"`
-	MihomoApiUrl         string        `yaml:"mihomo-api-url"`
-	MihomoApiSecret      string        `yaml:"mihomo-api-secret"`
-	ListenPort           string        `yaml:"listen-port"`
-	RenameNode           bool          `yaml:"rename-node"`
-	KeepSuccessProxies   bool          `yaml:"keep-success-proxies"`
-	OutputDir            string        `yaml:"output-dir"`
-	AppriseApiServer     string        `yaml:"apprise-api-server"`
-	RecipientUrl         []string      `yaml:"recipient-url"`
-	NotifyTitle          string        `yaml:"notify-title"`
-	SubStorePort         string        `yaml:"sub-store-port"`
-	SubStorePath         string        `yaml:"sub-store-path"`
-	SubStoreSyncCron     string        `yaml:"sub-store-sync-cron"`
-	SubStorePushService  string        `yaml:"sub-store-push-service"`
-	SubStoreProduceCron  string        `yaml:"sub-store-produce-cron"`
-	MihomoOverwriteUrl   string        `yaml:"mihomo-overwrite-url"`
-	MediaCheck           bool          `yaml:"media-check"`
-	Platforms            []string      `yaml:"platforms"`
-	SuccessLimit         int32         `yaml:"success-limit"`
-	NodePrefix           string        `yaml:"node-prefix"`
-	NodeType             []string      `yaml:"node-type"`
-	EnableWebUI          bool          `yaml:"enable-web-ui"`
-	APIKey               string        `yaml:"api-key"`
-	GithubProxy          string        `yaml:"github-proxy"`
-	Proxy                string        `yaml:"proxy"`
-	CallbackScript       string        `yaml:"callback-script"`
-	IpCheck              IpCheckConfig `yaml:"ip-check"`
+	PrintProgress        bool                `yaml:"print-progress"`
+	Concurrent           int                 `yaml:"concurrent"`
+	CheckInterval        int                 `yaml:"check-interval"`
+	CronExpression       string              `yaml:"cron-expression"`
+	AliveTestUrl         string              `yaml:"alive-test-url"`
+	SpeedTestUrl         string              `yaml:"speed-test-url"`
+	DownloadTimeout      int                 `yaml:"download-timeout"`
+	DownloadMB           int                 `yaml:"download-mb"`
+	TotalSpeedLimit      int                 `yaml:"total-speed-limit"`
+	MinSpeed             int                 `yaml:"min-speed"`
+	Timeout              int                 `yaml:"timeout"`
+	FilterRegex          string              `yaml:"filter-regex"`
+	SaveMethod           any                 `yaml:"save-method"`
+	WebDAVURL            string              `yaml:"webdav-url"`
+	WebDAVUsername       string              `yaml:"webdav-username"`
+	WebDAVPassword       string              `yaml:"webdav-password"`
+	GithubToken          string              `yaml:"github-token"`
+	GithubGistID         string              `yaml:"github-gist-id"`
+	GithubAPIMirror      string              `yaml:"github-api-mirror"`
+	GithubRawToken       string              `yaml:"github-raw-token"`
+	GithubRawOwner       string              `yaml:"github-raw-owner"`
+	GithubRawRepo        string              `yaml:"github-raw-repo"`
+	GithubRawBranch      string              `yaml:"github-raw-branch"`
+	GithubRawPath        string              `yaml:"github-raw-path"`
+	TelegraphToken       string              `yaml:"telegraph-token"`
+	TelegraphPath        string              `yaml:"telegraph-path"`
+	WorkerURL            string              `yaml:"worker-url"`
+	WorkerToken          string              `yaml:"worker-token"`
+	S3Endpoint           string              `yaml:"s3-endpoint"`
+	S3AccessID           string              `yaml:"s3-access-id"`
+	S3SecretKey          string              `yaml:"s3-secret-key"`
+	S3Bucket             string              `yaml:"s3-bucket"`
+	S3UseSSL             bool                `yaml:"s3-use-ssl"`
+	S3BucketLookup       string              `yaml:"s3-bucket-lookup"`
+	SubUrlsReTry         int                 `yaml:"sub-urls-retry"`
+	SubUrlsRetryInterval int                 `yaml:"sub-urls-retry-interval"`
+	SubUrlsTimeout       int                 `yaml:"sub-urls-timeout"`
+	SubUrlsGetUA         string              `yaml:"sub-urls-get-ua"`
+	SubUrlsRemote        []string            `yaml:"sub-urls-remote"`
+	SubUrls              []string            `yaml:"sub-urls"`
+	SuccessRate          float32             `yaml:"success-rate"`
+	MihomoApiUrl         string              `yaml:"mihomo-api-url"`
+	MihomoApiSecret      string              `yaml:"mihomo-api-secret"`
+	ListenPort           string              `yaml:"listen-port"`
+	RenameNode           bool                `yaml:"rename-node"`
+	RenameTemplate       string              `yaml:"rename-template"`
+	KeepSuccessProxies   bool                `yaml:"keep-success-proxies"`
+	KeepSuccessMaxMissed int                 `yaml:"keep-success-max-missed"`
+	OutputDir            string              `yaml:"output-dir"`
+	OutputHistory        int                 `yaml:"output-history"`
+	MaxDropPercent       int                 `yaml:"max-drop-percent"`
+	AppriseApiServer     string              `yaml:"apprise-api-server"`
+	RecipientUrl         []string            `yaml:"recipient-url"`
+	NotifyTitle          string              `yaml:"notify-title"`
+	Notify               NotifyConfig        `yaml:"notify"`
+	SubStorePort         string              `yaml:"sub-store-port"`
+	SubStorePath         string              `yaml:"sub-store-path"`
+	SubStoreSyncCron     string              `yaml:"sub-store-sync-cron"`
+	SubStorePushService  string              `yaml:"sub-store-push-service"`
+	SubStoreProduceCron  string              `yaml:"sub-store-produce-cron"`
+	OutputBackend        string              `yaml:"output-backend"`
+	MihomoOverwriteUrl   string              `yaml:"mihomo-overwrite-url"`
+	MediaCheck           bool                `yaml:"media-check"`
+	Platforms            []string            `yaml:"platforms"`
+	SuccessLimit         int32               `yaml:"success-limit"`
+	NodePrefix           string              `yaml:"node-prefix"`
+	NodeType             []string            `yaml:"node-type"`
+	EnableWebUI          bool                `yaml:"enable-web-ui"`
+	APIKey               string              `yaml:"api-key"`
+	SubToken             string              `yaml:"sub-token"`
+	ShareTokenRequired   *bool               `yaml:"share-token-required"` // 未设置时创建了分享令牌即要求令牌
+	GithubProxy          string              `yaml:"github-proxy"`
+	Proxy                string              `yaml:"proxy"`
+	CallbackScript       string              `yaml:"callback-script"`
+	Hooks                HooksConfig         `yaml:"hooks"`
+	IpCheck              IpCheckConfig       `yaml:"ip-check"`
+	GeoIP                GeoIPConfig         `yaml:"geoip"`
+	IPProviders          []IPProviderConfig  `yaml:"ip-providers"`
+	IPStack              IPStackConfig       `yaml:"ip-stack"`
+	Gateway              GatewayConfig       `yaml:"gateway"`
+	HealthMonitor        HealthMonitorConfig `yaml:"health-monitor"`
+	Incremental          IncrementalConfig   `yaml:"incremental"`
+	Outputs              []OutputConfig      `yaml:"outputs"`
+	AutoGroups           AutoGroupsConfig    `yaml:"auto-groups"`
+	Webhooks             WebhooksConfig      `yaml:"webhooks"`
 }
 
 type IpCheckConfig struct {
@@ -84,18 +102,173 @@ type IpCheckConfig struct {
 	RatePerMin  int    `yaml:"rate-per-minute"`
 	Cron        string `yaml:"cron"`
 	WindowHours int    `yaml:"window-hours"`
+	// Engine 为 native 时使用内置的Go实现，script 时调用 ip.sh
+	Engine    string            `yaml:"engine"`
+	Providers []string          `yaml:"providers"`
+	APIKeys   map[string]string `yaml:"api-keys"`
+	// CacheHours 同一出口IP在该时间内复用已有的检测结果，0 表示不缓存
+	CacheHours int `yaml:"cache-hours"`
+}
+
+type GeoIPConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CityDB     string `yaml:"city-db"`
+	ASNDB      string `yaml:"asn-db"`
+	CityDBUrl  string `yaml:"city-db-url"`
+	ASNDBUrl   string `yaml:"asn-db-url"`
+	UpdateCron string `yaml:"update-cron"`
+}
+
+// IPProviderConfig 出口IP查询接口
+// Fields 的键为 ip/country/city/asn/isp，值为 JSON 路径(如 eo.geo.countryCodeAlpha2)或 trace 格式的 key
+type IPProviderConfig struct {
+	Name    string            `yaml:"name"`
+	URL     string            `yaml:"url"`
+	Format  string            `yaml:"format"`
+	Fields  map[string]string `yaml:"fields"`
+	Timeout int               `yaml:"timeout"`
+	UA      string            `yaml:"ua"`
+}
+
+// IPStackConfig 双栈检测，分别通过只有IPv4/只有IPv6地址的接口探测节点出口
+type IPStackConfig struct {
+	Enabled bool             `yaml:"enabled"`
+	IPv4    IPProviderConfig `yaml:"ipv4"`
+	IPv6    IPProviderConfig `yaml:"ipv6"`
+}
+
+// GatewayConfig 本地代理网关，通过检测通过的节点提供 HTTP/SOCKS5 出口
+type GatewayConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	// Policy 节点选择策略: round-robin、lowest-latency、sticky
+	Policy   string `yaml:"policy"`
+	Password string `yaml:"password"`
+	// HealthCheckInterval 两次完整检测之间健康检查的间隔(分钟)，0 表示不检查
+	HealthCheckInterval int `yaml:"health-check-interval"`
+}
+
+// HealthMonitorConfig 两次完整检测之间对已发布节点的存活探测
+type HealthMonitorConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval 探测间隔(分钟)
+	Interval int `yaml:"interval"`
+	// FailThreshold 连续失败多少次后从订阅中移除
+	FailThreshold int `yaml:"fail-threshold"`
+	// MinAvailable 可用节点低于该数量时触发完整检测，0 表示不触发
+	MinAvailable int `yaml:"min-available"`
+	Concurrent   int `yaml:"concurrent"`
+}
+
+// AutoGroupsConfig 根据检测结果自动生成策略组
+type AutoGroupsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// LowRiskMax IP风险分数不高于该值的节点进入低风险分组
+	LowRiskMax int `yaml:"low-risk-max"`
+}
+
+// NotifyConfig 通知事件的路由与模板
+type NotifyConfig struct {
+	// Routes 事件对应的通知目标，值为 recipient-url 中的完整地址或 scheme(如 tgram)
+	// 未配置的事件发送到全部目标，配置为空列表时不发送
+	Routes map[string][]string `yaml:"routes"`
+	// Templates 事件对应的 Go 模板，覆盖默认的通知内容
+	Templates map[string]string `yaml:"templates"`
+	// MinAvailable 可用节点低于该数量时发送 available-low 事件，0 表示不发送
+	MinAvailable int `yaml:"min-available"`
+	// ExpireDays 订阅在该天数内到期时发送 subscription-expiring 事件，0 表示不发送
+	ExpireDays int `yaml:"expire-days"`
+	// Retry 发送失败后的重试次数，Backoff 首次重试前等待的秒数，之后每次翻倍
+	Retry   int `yaml:"retry"`
+	Backoff int `yaml:"backoff"`
+	// Channels 内置通知渠道，不需要 Apprise
+	Channels []NotifierConfig `yaml:"channels"`
+}
+
+// NotifierConfig 内置通知渠道
+// Type: telegram、webhook、ntfy、bark、serverchan、dingtalk、wecom、feishu、apprise
+type NotifierConfig struct {
+	// Name 用于 notify.routes 的名称，为空时使用 Type
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// URL 推送地址；telegram、serverchan 为可选的 API 地址
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// ChatID telegram 的会话 ID
+	ChatID string `yaml:"chat-id"`
+	// Secret webhook、dingtalk、feishu 的签名密钥
+	Secret string `yaml:"secret"`
+	// Recipients apprise 的通知目标
+	Recipients []string `yaml:"recipients"`
+	// Retry、Backoff 为 0 时使用 notify.retry、notify.backoff
+	Retry   int `yaml:"retry"`
+	Backoff int `yaml:"backoff"`
+}
+
+// WebhooksConfig 检测开始、结束与保存订阅文件时向外部服务推送 JSON
+type WebhooksConfig struct {
+	// PublicURL 订阅文件的外部访问地址，如 http://example.com:8199，用于生成文件链接，为空时为相对路径
+	PublicURL string `yaml:"public-url"`
+	// TopN run-end 中附带的最快节点数量
+	TopN int `yaml:"top-n"`
+	// Retry 投递失败后的重试次数，Backoff 首次重试前等待的秒数，之后每次翻倍
+	Retry   int             `yaml:"retry"`
+	Backoff int             `yaml:"backoff"`
+	Targets []WebhookTarget `yaml:"targets"`
+}
+
+// WebhookTarget webhook 投递地址
+type WebhookTarget struct {
+	URL string `yaml:"url"`
+	// Secret 签名密钥，请求头 X-Subcheck-Signature 为请求体的 HMAC-SHA256
+	Secret string `yaml:"secret"`
+	// Events 订阅的事件: run-start、run-end、save，为空时订阅全部
+	Events []string `yaml:"events"`
+}
+
+// HooksConfig 检测前后执行的脚本
+type HooksConfig struct {
+	// Timeout 脚本默认的超时时间(秒)
+	Timeout   int          `yaml:"timeout"`
+	PreCheck  []HookConfig `yaml:"pre-check"`
+	PostCheck []HookConfig `yaml:"post-check"`
+}
+
+// HookConfig 一个脚本，Timeout 为 0 时使用 hooks.timeout
+type HookConfig struct {
+	Path    string `yaml:"path"`
+	Timeout int    `yaml:"timeout"`
+}
+
+// OutputConfig 自定义输出分类，按过滤表达式从检测结果中筛选节点生成单独的订阅文件
+type OutputConfig struct {
+	// Name 文件名，不带扩展名，如 jp 生成 jp.yaml
+	Name   string `yaml:"name"`
+	Filter string `yaml:"filter"`
+	// Sort 排序方式: speed、latency、risk
+	Sort  string `yaml:"sort"`
+	Limit int    `yaml:"limit"`
+}
+
+// IncrementalConfig 增量检测，TTL 内完整检测通过的节点只做存活探测
+type IncrementalConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	TTLHours int  `yaml:"ttl-hours"`
 }
 
 var GlobalConfig = &Config{
 	// 新增配置，给未更改配置文件的用户一个默认值
-	ListenPort:         ":8199",
-	NotifyTitle:        "🔔 节点状态更新",
-	MihomoOverwriteUrl: "http://127.0.0.1:8199/sub/clash_template.yaml",
-	Platforms:          []string{"openai", "youtube", "netflix", "disney", "gemini", "iprisk"},
-	DownloadMB:         20,
-	AliveTestUrl:       "http://gstatic.com/generate_204",
-	SubUrlsGetUA:       "clash.meta (https://github.com/twj0/subcheck)",
-	APIKey:             "123456",
+	ListenPort:           ":8199",
+	NotifyTitle:          "🔔 节点状态更新",
+	MihomoOverwriteUrl:   "http://127.0.0.1:8199/sub/clash_template.yaml",
+	Platforms:            []string{"openai", "youtube", "netflix", "disney", "gemini", "iprisk"},
+	DownloadMB:           20,
+	AliveTestUrl:         "http://gstatic.com/generate_204",
+	KeepSuccessMaxMissed: 3,
+	OutputBackend:        "auto",
+	OutputHistory:        5,
+	SubUrlsGetUA:         "clash.meta (https://github.com/twj0/subcheck)",
+	APIKey:               "123456",
 	IpCheck: IpCheckConfig{
 		Enabled:     true,
 		ScriptPath:  "ipcheck/ip.sh",
@@ -108,6 +281,93 @@ var GlobalConfig = &Config{
 		RatePerMin:  20,
 		Cron:        "",
 		WindowHours: 24,
+		Engine:      "native",
+		Providers:   []string{"scamalytics", "ipqs", "ip2location", "ipapi", "dbip", "abuseipdb"},
+		CacheHours:  24,
+	},
+	GeoIP: GeoIPConfig{
+		Enabled:    false,
+		CityDB:     "data/GeoLite2-City.mmdb",
+		ASNDB:      "data/GeoLite2-ASN.mmdb",
+		CityDBUrl:  "https://raw.githubusercontent.com/P3TERX/GeoLite.mmdb/download/GeoLite2-City.mmdb",
+		ASNDBUrl:   "https://raw.githubusercontent.com/P3TERX/GeoLite.mmdb/download/GeoLite2-ASN.mmdb",
+		UpdateCron: "0 4 * * 3",
+	},
+	IPProviders: []IPProviderConfig{
+		{
+			Name:   "me",
+			URL:    "https://ip.122911.xyz/api/ipinfo",
+			Format: "json",
+			Fields: map[string]string{"ip": "ip", "country": "country_code"},
+		},
+		{
+			Name:   "iplark",
+			URL:    "https://f3bca0e28e6b.aapq.net/ipapi/ipcat",
+			Format: "json",
+			Fields: map[string]string{"ip": "ip", "country": "country_code"},
+			UA:     "curl/8.7.1",
+		},
+		{
+			Name:   "cloudflare",
+			URL:    "https://www.cloudflare.com/cdn-cgi/trace",
+			Format: "trace",
+			Fields: map[string]string{"ip": "ip", "country": "loc"},
+			UA:     "random",
+		},
+		{
+			// 不准，放在最后
+			Name:   "edgeone",
+			URL:    "https://functions-geolocation.edgeone.app/geo",
+			Format: "json",
+			Fields: map[string]string{"ip": "eo.clientIp", "country": "eo.geo.countryCodeAlpha2"},
+			UA:     "random",
+		},
+	},
+	IPStack: IPStackConfig{
+		Enabled: false,
+		IPv4: IPProviderConfig{
+			Name:    "ipv4",
+			URL:     "https://1.1.1.1/cdn-cgi/trace",
+			Format:  "trace",
+			Fields:  map[string]string{"ip": "ip", "country": "loc"},
+			Timeout: 5000,
+		},
+		IPv6: IPProviderConfig{
+			Name:    "ipv6",
+			URL:     "https://[2606:4700:4700::1111]/cdn-cgi/trace",
+			Format:  "trace",
+			Fields:  map[string]string{"ip": "ip", "country": "loc"},
+			Timeout: 5000,
+		},
+	},
+	Gateway: GatewayConfig{
+		Listen:              "127.0.0.1:7890",
+		Policy:              "round-robin",
+		HealthCheckInterval: 5,
+	},
+	Incremental: IncrementalConfig{
+		TTLHours: 6,
+	},
+	AutoGroups: AutoGroupsConfig{
+		LowRiskMax: 30,
+	},
+	Hooks: HooksConfig{
+		Timeout: 300,
+	},
+	Webhooks: WebhooksConfig{
+		TopN:    10,
+		Retry:   3,
+		Backoff: 5,
+	},
+	Notify: NotifyConfig{
+		ExpireDays: 3,
+		Retry:      2,
+		Backoff:    2,
+	},
+	HealthMonitor: HealthMonitorConfig{
+		Interval:      5,
+		FailThreshold: 2,
+		Concurrent:    20,
 	},
 }
 
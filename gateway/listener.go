@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter/inbound"
+	N "github.com/metacubex/mihomo/common/net"
+	"github.com/metacubex/mihomo/component/auth"
+	"github.com/metacubex/mihomo/constant"
+	authStore "github.com/metacubex/mihomo/listener/auth"
+	LC "github.com/metacubex/mihomo/listener/config"
+	"github.com/metacubex/mihomo/listener/mixed"
+)
+
+// dialTimeout 通过节点连接目标的超时时间
+const dialTimeout = 10 * time.Second
+
+// Selector 根据连接的元数据(目标地址、入站用户名)选择出站节点
+type Selector func(metadata *constant.Metadata) (constant.Proxy, error)
+
+// Listener 本地混合(HTTP+SOCKS5)入站，连接通过 Selector 选出的节点转发
+type Listener struct {
+	mixed *mixed.Listener
+}
+
+// Listen 在 addr 上启动混合入站，authenticator 为 nil 时不需要认证
+func Listen(addr string, selector Selector, authenticator auth.Authenticator) (*Listener, error) {
+	// 使用非默认的 AuthStore 与 additions，避免 mihomo 默认入站的局域网IP过滤
+	l, err := mixed.NewWithConfig(LC.AuthServer{
+		Enable:    true,
+		Listen:    addr,
+		AuthStore: authStore.NewAuthStore(authenticator),
+	}, &tunnel{selector: selector}, inbound.WithInName("subcheck"))
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{mixed: l}, nil
+}
+
+// ListenProxy 为单个节点启动只监听本机随机端口的临时入站，用完需要 Close
+func ListenProxy(proxy constant.Proxy) (*Listener, error) {
+	return Listen("127.0.0.1:0", func(*constant.Metadata) (constant.Proxy, error) {
+		return proxy, nil
+	}, nil)
+}
+
+// Address 实际监听的地址
+func (l *Listener) Address() string {
+	return l.mixed.Address()
+}
+
+// ProxyURL 供 curl -x 使用的代理地址，域名交给节点解析
+func (l *Listener) ProxyURL() string {
+	return "socks5h://" + l.Address()
+}
+
+// Close 关闭入站
+func (l *Listener) Close() error {
+	return l.mixed.Close()
+}
+
+// tunnel 实现 mihomo 的 C.Tunnel，只转发TCP
+type tunnel struct {
+	selector Selector
+}
+
+func (t *tunnel) HandleTCPConn(conn net.Conn, metadata *constant.Metadata) {
+	proxy, err := t.selector(metadata)
+	if err == nil && proxy == nil {
+		err = errors.New("没有可用的节点")
+	}
+	if err != nil {
+		slog.Debug(fmt.Sprintf("选择节点失败 [%s]: %v", metadata.RemoteAddress(), err))
+		conn.Close()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	remote, err := proxy.DialContext(ctx, metadata)
+	cancel()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("通过节点 %s 连接 %s 失败: %v", proxy.Name(), metadata.RemoteAddress(), err))
+		conn.Close()
+		return
+	}
+	N.Relay(conn, remote)
+}
+
+// HandleUDPPacket 不支持UDP转发
+func (t *tunnel) HandleUDPPacket(packet constant.UDPPacket, metadata *constant.Metadata) {
+	packet.Drop()
+}
+
+func (t *tunnel) NatTable() constant.NatTable {
+	return nil
+}
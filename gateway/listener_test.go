@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/constant"
+)
+
+// newDirect 直连节点，用于在本地验证入站转发
+func newDirect(t *testing.T, name string) constant.Proxy {
+	t.Helper()
+	p, err := adapter.ParseProxy(map[string]any{"name": name, "type": "direct"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestListenProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	l, err := ListenProxy(newDirect(t, "direct"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for _, scheme := range []string{"http", "socks5"} {
+		t.Run(scheme, func(t *testing.T) {
+			proxyURL, _ := url.Parse(scheme + "://" + l.Address())
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != "ok" {
+				t.Errorf("body = %q, want ok", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metacubex/mihomo/constant"
+)
+
+// 节点选择策略
+const (
+	PolicyRoundRobin    = "round-robin"
+	PolicyLowestLatency = "lowest-latency"
+	PolicySticky        = "sticky"
+)
+
+// maxFails 健康检查连续失败多少次后移出节点池
+const maxFails = 2
+
+// Node 节点池中的节点
+type Node struct {
+	Proxy   constant.Proxy
+	Country string // 出口国家代码，用于按国家分池
+	Latency int    // 延迟(毫秒)，健康检查后更新
+	fails   int
+}
+
+// Pool 检测通过的节点池，按策略为每个连接选择出站节点
+type Pool struct {
+	mu     sync.RWMutex
+	nodes  []*Node
+	policy string
+	next   atomic.Uint64
+}
+
+// NewPool 创建节点池，policy 为空或未知时使用轮询
+func NewPool(policy string) *Pool {
+	return &Pool{policy: policy}
+}
+
+// Update 用一次完整检测的结果替换节点池
+func (p *Pool) Update(nodes []Node) {
+	list := make([]*Node, 0, len(nodes))
+	for i := range nodes {
+		if nodes[i].Proxy == nil {
+			continue
+		}
+		n := nodes[i]
+		n.Country = strings.ToUpper(n.Country)
+		list = append(list, &n)
+	}
+	p.mu.Lock()
+	p.nodes = list
+	p.mu.Unlock()
+}
+
+// Len 节点池中的节点数量
+func (p *Pool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.nodes)
+}
+
+// Select 实现 Selector，入站用户名形如 user-country-jp 时只在该国家的节点中选择
+func (p *Pool) Select(metadata *constant.Metadata) (constant.Proxy, error) {
+	country := ParseCountry(metadata.InUser)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	candidates := p.nodes
+	if country != "" {
+		candidates = make([]*Node, 0, len(p.nodes))
+		for _, n := range p.nodes {
+			if n.Country == country {
+				candidates = append(candidates, n)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		if country != "" {
+			return nil, fmt.Errorf("没有 %s 的可用节点", country)
+		}
+		return nil, errors.New("节点池为空")
+	}
+
+	switch p.policy {
+	case PolicyLowestLatency:
+		best := candidates[0]
+		for _, n := range candidates[1:] {
+			if n.Latency > 0 && (best.Latency <= 0 || n.Latency < best.Latency) {
+				best = n
+			}
+		}
+		return best.Proxy, nil
+	case PolicySticky:
+		// 同一目标固定使用同一节点，节点池不变时结果稳定
+		h := fnv.New32a()
+		h.Write([]byte(destination(metadata)))
+		return candidates[h.Sum32()%uint32(len(candidates))].Proxy, nil
+	default:
+		i := p.next.Add(1) - 1
+		return candidates[i%uint64(len(candidates))].Proxy, nil
+	}
+}
+
+// HealthCheck 通过每个节点访问 url，更新延迟，连续失败的节点移出节点池
+func (p *Pool) HealthCheck(ctx context.Context, url string, timeout time.Duration) {
+	p.mu.RLock()
+	nodes := append([]*Node(nil), p.nodes...)
+	p.mu.RUnlock()
+	if len(nodes) == 0 {
+		return
+	}
+
+	type result struct {
+		node  *Node
+		delay uint16
+		err   error
+	}
+	results := make(chan result, len(nodes))
+	sem := make(chan struct{}, 10)
+	for _, n := range nodes {
+		sem <- struct{}{}
+		go func(n *Node) {
+			defer func() { <-sem }()
+			tctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			delay, err := n.Proxy.URLTest(tctx, url, nil)
+			results <- result{node: n, delay: delay, err: err}
+		}(n)
+	}
+
+	list := make([]result, 0, len(nodes))
+	for range nodes {
+		list = append(list, <-results)
+	}
+
+	// 等待期间不持有锁，避免阻塞新连接选择节点
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range list {
+		if r.err != nil {
+			r.node.fails++
+			continue
+		}
+		r.node.fails = 0
+		r.node.Latency = int(r.delay)
+	}
+	kept := p.nodes[:0]
+	for _, n := range p.nodes {
+		if n.fails >= maxFails {
+			slog.Info(fmt.Sprintf("网关节点 %s 健康检查连续失败，已移出节点池", n.Proxy.Name()))
+			continue
+		}
+		kept = append(kept, n)
+	}
+	p.nodes = kept
+}
+
+// ParseCountry 从入站用户名中解析国家代码，如 user-country-jp 返回 JP
+func ParseCountry(user string) string {
+	parts := strings.Split(strings.ToLower(user), "-")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "country" {
+			return strings.ToUpper(parts[i+1])
+		}
+	}
+	return ""
+}
+
+// destination 连接的目标，优先使用域名
+func destination(metadata *constant.Metadata) string {
+	if metadata.Host != "" {
+		return metadata.Host
+	}
+	return metadata.DstIP.String()
+}
+
+// PasswordAuth 只校验密码的认证，用户名用于选择国家
+type PasswordAuth string
+
+func (a PasswordAuth) Verify(_ string, pass string) bool {
+	return pass == string(a)
+}
+
+func (a PasswordAuth) Users() []string {
+	return nil
+}
@@ -0,0 +1,241 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/constant"
+)
+
+func TestParseCountry(t *testing.T) {
+	tests := []struct {
+		user string
+		want string
+	}{
+		{"user-country-jp", "JP"},
+		{"USER-COUNTRY-us-session-1", "US"},
+		{"alice", ""},
+		{"user-country", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			if got := ParseCountry(tt.user); got != tt.want {
+				t.Errorf("ParseCountry(%q) = %q, want %q", tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestPool(t *testing.T, policy string) *Pool {
+	t.Helper()
+	p := NewPool(policy)
+	p.Update([]Node{
+		{Proxy: newDirect(t, "jp-1"), Country: "jp", Latency: 300},
+		{Proxy: newDirect(t, "jp-2"), Country: "JP", Latency: 100},
+		{Proxy: newDirect(t, "us-1"), Country: "US", Latency: 50},
+	})
+	return p
+}
+
+func TestPoolSelect(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		user    string
+		hosts   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "round robin",
+			policy: PolicyRoundRobin,
+			hosts:  []string{"a.com", "a.com", "a.com", "a.com"},
+			want:   []string{"jp-1", "jp-2", "us-1", "jp-1"},
+		},
+		{
+			name:   "round robin in country pool",
+			policy: PolicyRoundRobin,
+			user:   "user-country-jp",
+			hosts:  []string{"a.com", "a.com", "a.com"},
+			want:   []string{"jp-1", "jp-2", "jp-1"},
+		},
+		{
+			name:   "lowest latency",
+			policy: PolicyLowestLatency,
+			hosts:  []string{"a.com", "b.com"},
+			want:   []string{"us-1", "us-1"},
+		},
+		{
+			name:   "lowest latency in country pool",
+			policy: PolicyLowestLatency,
+			user:   "user-country-jp",
+			hosts:  []string{"a.com"},
+			want:   []string{"jp-2"},
+		},
+		{
+			name:    "unknown country",
+			policy:  PolicyRoundRobin,
+			user:    "user-country-de",
+			hosts:   []string{"a.com"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPool(t, tt.policy)
+			for i, host := range tt.hosts {
+				proxy, err := p.Select(&constant.Metadata{Host: host, InUser: tt.user})
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+				if proxy.Name() != tt.want[i] {
+					t.Errorf("Select() #%d = %s, want %s", i, proxy.Name(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPoolSticky(t *testing.T) {
+	p := newTestPool(t, PolicySticky)
+	for _, host := range []string{"a.com", "b.org", "example.net"} {
+		first, err := p.Select(&constant.Metadata{Host: host})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			if got, _ := p.Select(&constant.Metadata{Host: host}); got != first {
+				t.Errorf("%s: sticky policy switched from %s to %s", host, first.Name(), got.Name())
+			}
+		}
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// 指向已关闭端口的 socks5 节点，健康检查必然失败
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	dead, err := adapter.ParseProxy(map[string]any{"name": "dead", "type": "socks5", "server": "127.0.0.1", "port": port})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPool(PolicyRoundRobin)
+	p.Update([]Node{{Proxy: newDirect(t, "alive")}, {Proxy: dead}})
+
+	p.HealthCheck(context.Background(), srv.URL, time.Second)
+	if p.Len() != 2 {
+		t.Fatalf("a single failure should not evict, pool size = %d", p.Len())
+	}
+	p.HealthCheck(context.Background(), srv.URL, time.Second)
+	if p.Len() != 1 {
+		t.Fatalf("consecutive failures should evict, pool size = %d", p.Len())
+	}
+	if proxy, _ := p.Select(&constant.Metadata{Host: "a.com"}); proxy.Name() != "alive" {
+		t.Errorf("remaining node = %s, want alive", proxy.Name())
+	}
+}
+
+func TestListenPoolWithPassword(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	p := NewPool(PolicyRoundRobin)
+	p.Update([]Node{{Proxy: newDirect(t, "jp"), Country: "JP"}})
+	l, err := Listen("127.0.0.1:0", p.Select, PasswordAuth("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		name   string
+		user   *url.Userinfo
+		wantOK bool
+	}{
+		{"country pool", url.UserPassword("user-country-jp", "secret"), true},
+		{"missing country", url.UserPassword("user-country-us", "secret"), false},
+		{"wrong password", url.UserPassword("user-country-jp", "nope"), false},
+		{"no credentials", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyURL := &url.URL{Scheme: "socks5", Host: l.Address(), User: tt.user}
+			client := &http.Client{
+				Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+				Timeout:   5 * time.Second,
+			}
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ok := err == nil && resp.StatusCode == http.StatusOK; ok != tt.wantOK {
+				t.Errorf("request ok = %v (err %v), want %v", ok, err, tt.wantOK)
+			}
+		})
+	}
+}
+
+// 没有密码时 HTTP 代理仍会带上用户名，可以按国家选择节点
+func TestListenPoolWithoutPassword(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	p := NewPool(PolicyRoundRobin)
+	p.Update([]Node{{Proxy: newDirect(t, "jp"), Country: "JP"}})
+	l, err := Listen("127.0.0.1:0", p.Select, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		name   string
+		user   *url.Userinfo
+		wantOK bool
+	}{
+		{"country pool", url.User("user-country-jp"), true},
+		{"missing country", url.User("user-country-us"), false},
+		{"no credentials", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyURL := &url.URL{Scheme: "http", Host: l.Address(), User: tt.user}
+			client := &http.Client{
+				Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+				Timeout:   5 * time.Second,
+			}
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ok := err == nil && resp.StatusCode == http.StatusOK; ok != tt.wantOK {
+				t.Errorf("request ok = %v (err %v), want %v", ok, err, tt.wantOK)
+			}
+		})
+	}
+}
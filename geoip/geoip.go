@@ -0,0 +1,269 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/utils"
+)
+
+// Info 离线数据库的查询结果
+type Info struct {
+	Country string // 国家代码，如 US
+	City    string // 城市英文名
+	ASN     string // ASN，如 AS13335
+	ISP     string // ASN 所属组织
+}
+
+var (
+	lock      sync.RWMutex
+	cityDB    *maxminddb.Reader
+	asnDB     *maxminddb.Reader
+	updateMux sync.Mutex
+)
+
+// Enabled 是否启用了离线数据库并且至少加载了一个数据库
+func Enabled() bool {
+	if !config.GlobalConfig.GeoIP.Enabled {
+		return false
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+	return cityDB != nil || asnDB != nil
+}
+
+// Init 加载离线数据库，本地不存在时先下载
+func Init() error {
+	cfg := config.GlobalConfig.GeoIP
+	if !cfg.Enabled {
+		return nil
+	}
+	var errs []error
+	if cfg.CityDB != "" {
+		if err := ensure(resolvePath(cfg.CityDB), cfg.CityDBUrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.ASNDB != "" {
+		if err := ensure(resolvePath(cfg.ASNDB), cfg.ASNDBUrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := reload(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Update 重新下载离线数据库并热加载
+func Update() error {
+	cfg := config.GlobalConfig.GeoIP
+	if !cfg.Enabled {
+		return nil
+	}
+	var errs []error
+	if cfg.CityDB != "" && cfg.CityDBUrl != "" {
+		if err := download(resolvePath(cfg.CityDB), cfg.CityDBUrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.ASNDB != "" && cfg.ASNDBUrl != "" {
+		if err := download(resolvePath(cfg.ASNDB), cfg.ASNDBUrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := reload(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		slog.Info("GeoIP数据库更新完成")
+	}
+	return errors.Join(errs...)
+}
+
+// Lookup 查询IP的国家、城市与ASN信息
+func Lookup(ipStr string) (Info, error) {
+	var info Info
+	ip := net.ParseIP(strings.TrimSpace(ipStr))
+	if ip == nil {
+		return info, fmt.Errorf("无效的IP: %s", ipStr)
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if cityDB != nil {
+		var rec map[string]any
+		if err := cityDB.Lookup(ip, &rec); err != nil {
+			return info, err
+		}
+		info.Country, info.City = parseLocation(rec)
+		// IPinfo 的 country_asn 库同时包含 ASN 信息
+		info.ASN, info.ISP = parseASN(rec)
+	}
+	if asnDB != nil {
+		var rec map[string]any
+		if err := asnDB.Lookup(ip, &rec); err != nil {
+			return info, err
+		}
+		if asn, isp := parseASN(rec); asn != "" {
+			info.ASN, info.ISP = asn, isp
+		}
+		// IPinfo lite 库同时包含国家信息
+		if info.Country == "" {
+			info.Country, _ = parseLocation(rec)
+		}
+	}
+	return info, nil
+}
+
+// parseLocation 兼容 MaxMind(country.iso_code/city.names.en) 与 IPinfo(country_code/city) 两种格式
+func parseLocation(rec map[string]any) (country, city string) {
+	if m, ok := rec["country"].(map[string]any); ok {
+		country, _ = m["iso_code"].(string)
+	}
+	if country == "" {
+		country, _ = rec["country_code"].(string)
+	}
+	switch v := rec["city"].(type) {
+	case map[string]any:
+		if names, ok := v["names"].(map[string]any); ok {
+			city, _ = names["en"].(string)
+		}
+	case string:
+		city = v
+	}
+	return strings.ToUpper(country), city
+}
+
+// parseASN 兼容 MaxMind(autonomous_system_*) 与 IPinfo(asn/as_name) 两种格式
+func parseASN(rec map[string]any) (asn, isp string) {
+	switch v := rec["autonomous_system_number"].(type) {
+	case uint64:
+		asn = fmt.Sprintf("AS%d", v)
+	case uint32:
+		asn = fmt.Sprintf("AS%d", v)
+	}
+	isp, _ = rec["autonomous_system_organization"].(string)
+	if asn == "" {
+		asn, _ = rec["asn"].(string)
+	}
+	if isp == "" {
+		isp, _ = rec["as_name"].(string)
+	}
+	return asn, isp
+}
+
+// reload 重新打开数据库文件，替换正在使用的reader
+func reload() error {
+	cfg := config.GlobalConfig.GeoIP
+	var errs []error
+	open := func(path string) *maxminddb.Reader {
+		if path == "" {
+			return nil
+		}
+		r, err := maxminddb.Open(resolvePath(path))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("打开GeoIP数据库失败 [%s]: %w", path, err))
+			return nil
+		}
+		return r
+	}
+	newCity := open(cfg.CityDB)
+	newASN := open(cfg.ASNDB)
+
+	lock.Lock()
+	oldCity, oldASN := cityDB, asnDB
+	// 打开失败时保留旧的reader
+	if newCity != nil || cfg.CityDB == "" {
+		cityDB = newCity
+	}
+	if newASN != nil || cfg.ASNDB == "" {
+		asnDB = newASN
+	}
+	lock.Unlock()
+
+	if oldCity != nil && oldCity != cityDB {
+		oldCity.Close()
+	}
+	if oldASN != nil && oldASN != asnDB {
+		oldASN.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// ensure 本地数据库不存在时下载
+func ensure(path, url string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if url == "" {
+		return fmt.Errorf("GeoIP数据库不存在且未配置下载地址: %s", path)
+	}
+	return download(path, url)
+}
+
+// download 下载数据库到临时文件，校验通过后替换
+func download(path, url string) error {
+	updateMux.Lock()
+	defer updateMux.Unlock()
+
+	url = utils.WarpUrl(url)
+	slog.Info("下载GeoIP数据库", "url", url)
+	// 数据库决定所有节点的国家，必须校验证书
+	client := &http.Client{
+		Timeout:   5 * time.Minute,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("下载GeoIP数据库失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载GeoIP数据库失败，状态码: %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("写入GeoIP数据库失败: %w", err)
+	}
+	f.Close()
+
+	// 确认是有效的mmdb文件再替换
+	r, err := maxminddb.Open(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("GeoIP数据库校验失败: %w", err)
+	}
+	r.Close()
+	return os.Rename(tmp, path)
+}
+
+// resolvePath 相对路径以程序所在目录为基准
+func resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(utils.GetExecutablePath(), path)
+}
@@ -0,0 +1,295 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/twj0/subcheck/config"
+)
+
+// MaxMind 格式的城市库
+var cityJP = map[string]any{
+	"country": map[string]any{"iso_code": "jp"},
+	"city":    map[string]any{"names": map[string]any{"en": "Tokyo"}},
+}
+
+// IPinfo lite 格式，同时包含国家与 ASN
+var asnCF = map[string]any{
+	"country_code": "US",
+	"asn":          "AS13335",
+	"as_name":      "Cloudflare",
+}
+
+func setup(t *testing.T, cfg config.GeoIPConfig) {
+	t.Helper()
+	old := config.GlobalConfig
+	t.Cleanup(func() {
+		config.GlobalConfig = old
+		lock.Lock()
+		defer lock.Unlock()
+		if cityDB != nil {
+			cityDB.Close()
+		}
+		if asnDB != nil {
+			asnDB.Close()
+		}
+		cityDB, asnDB = nil, nil
+	})
+	cfg.Enabled = true
+	config.GlobalConfig = &config.Config{GeoIP: cfg}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	city := filepath.Join(dir, "city.mmdb")
+	asn := filepath.Join(dir, "asn.mmdb")
+	writeMMDB(t, city, map[string]map[string]any{"1.2.3.0/24": cityJP})
+	writeMMDB(t, asn, map[string]map[string]any{
+		"1.2.3.0/24": {"autonomous_system_number": uint32(2497), "autonomous_system_organization": "IIJ"},
+		"1.1.1.0/24": asnCF,
+	})
+	setup(t, config.GeoIPConfig{CityDB: city, ASNDB: asn})
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if !Enabled() {
+		t.Fatal("Enabled() should be true after loading databases")
+	}
+
+	tests := []struct {
+		ip      string
+		want    Info
+		wantErr bool
+	}{
+		{ip: "1.2.3.4", want: Info{Country: "JP", City: "Tokyo", ASN: "AS2497", ISP: "IIJ"}},
+		// 城市库没有记录时使用 ASN 库中的国家
+		{ip: "1.1.1.1", want: Info{Country: "US", ASN: "AS13335", ISP: "Cloudflare"}},
+		{ip: "8.8.8.8", want: Info{}},
+		{ip: "not-an-ip", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got, err := Lookup(tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	city := filepath.Join(dir, "city.mmdb")
+	writeMMDB(t, city, map[string]map[string]any{"1.2.3.0/24": cityJP})
+	setup(t, config.GeoIPConfig{CityDB: city})
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 与下载一样写入新文件后替换
+	writeMMDB(t, city+".new", map[string]map[string]any{"1.2.3.0/24": {"country_code": "SG"}})
+	if err := os.Rename(city+".new", city); err != nil {
+		t.Fatal(err)
+	}
+	if err := reload(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := Lookup("1.2.3.4"); info.Country != "SG" {
+		t.Errorf("after reload Country = %q, want SG", info.Country)
+	}
+
+	// 打开失败时保留旧的数据库
+	if err := os.WriteFile(city+".new", []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(city+".new", city); err != nil {
+		t.Fatal(err)
+	}
+	if err := reload(); err == nil {
+		t.Error("reload() of a broken file should fail")
+	}
+	if info, _ := Lookup("1.2.3.4"); info.Country != "SG" {
+		t.Errorf("broken reload should keep the old reader, Country = %q", info.Country)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "fixture.mmdb")
+	writeMMDB(t, valid, map[string]map[string]any{"1.2.3.0/24": cityJP})
+	fixture, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/city.mmdb":
+			w.Write(fixture)
+		case "/broken.mmdb":
+			w.Write([]byte("<html>not a database</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	city := filepath.Join(dir, "data", "city.mmdb")
+	setup(t, config.GeoIPConfig{CityDB: city, CityDBUrl: srv.URL + "/city.mmdb"})
+	// 本地不存在时下载
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := Lookup("1.2.3.4"); info.Country != "JP" {
+		t.Errorf("downloaded database Country = %q, want JP", info.Country)
+	}
+
+	for _, path := range []string{"/broken.mmdb", "/missing.mmdb"} {
+		t.Run(path, func(t *testing.T) {
+			if err := download(city, srv.URL+path); err == nil {
+				t.Fatal("download() should fail")
+			}
+			// 校验失败时不替换已有的数据库，也不留下临时文件
+			if data, err := os.ReadFile(city); err != nil || !bytes.Equal(data, fixture) {
+				t.Errorf("existing database was replaced: %v", err)
+			}
+			if _, err := os.Stat(city + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+		})
+	}
+}
+
+// writeMMDB 生成只包含 IPv4 网段的 mmdb 文件，record size 为 24
+func writeMMDB(t *testing.T, path string, records map[string]map[string]any) {
+	t.Helper()
+	type node [2]int // 子节点序号，-1 为空，<= -2 为数据 -(序号+2)
+	nodes := []node{{-1, -1}}
+	var data []byte
+	var offsets []int
+
+	cidrs := make([]string, 0, len(records))
+	for c := range records {
+		cidrs = append(cidrs, c)
+	}
+	sort.Strings(cidrs)
+	for i, c := range cidrs {
+		_, network, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, len(data))
+		data = append(data, encodeMMDB(records[c])...)
+
+		ip := network.IP.To4()
+		bits, _ := network.Mask.Size()
+		n := 0
+		for b := 0; b < bits; b++ {
+			bit := int(ip[b/8]>>(7-b%8)) & 1
+			if b == bits-1 {
+				nodes[n][bit] = -(i + 2)
+				break
+			}
+			if nodes[n][bit] < 0 {
+				nodes = append(nodes, node{-1, -1})
+				nodes[n][bit] = len(nodes) - 1
+			}
+			n = nodes[n][bit]
+		}
+	}
+
+	count := len(nodes)
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		for _, child := range n {
+			v := count // 没有数据
+			switch {
+			case child >= 0:
+				v = child
+			case child <= -2:
+				v = count + 16 + offsets[-child-2]
+			}
+			buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data)
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	buf.Write(encodeMMDB(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               "Test",
+		"description":                 map[string]any{"en": "test"},
+		"ip_version":                  uint16(4),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+	}))
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encodeMMDB 按 MaxMind DB 数据格式编码，只支持测试用到的类型
+func encodeMMDB(v any) []byte {
+	control := func(typ, size int) []byte {
+		var out []byte
+		if typ <= 7 {
+			out = []byte{byte(typ << 5)}
+		} else {
+			out = []byte{0, byte(typ - 7)}
+		}
+		if size < 29 {
+			out[0] |= byte(size)
+		} else {
+			out[0] |= 29
+			out = append(out, byte(size-29))
+		}
+		return out
+	}
+	uint := func(typ int, n uint64) []byte {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		raw := bytes.TrimLeft(b[:], "\x00")
+		return append(control(typ, len(raw)), raw...)
+	}
+	switch v := v.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case uint16:
+		return uint(5, uint64(v))
+	case uint32:
+		return uint(6, uint64(v))
+	case uint64:
+		return uint(9, v)
+	case []any:
+		out := control(11, len(v))
+		for _, item := range v {
+			out = append(out, encodeMMDB(item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := control(7, len(v))
+		for _, k := range keys {
+			out = append(out, encodeMMDB(k)...)
+			out = append(out, encodeMMDB(v[k])...)
+		}
+		return out
+	}
+	panic("unsupported type")
+}
@@ -0,0 +1,311 @@
+// Package hooks 在检测前后执行用户脚本
+//
+// 检测前脚本(pre-check)从 stdin 读取节点列表 JSON，可以在 stdout 输出修改后的节点列表，
+// 或以非 0 退出码/输出 {"veto":true} 否决本次检测；检测后脚本(post-check)通过环境变量与
+// 结果文件获取本次检测的信息，在后台执行，不阻塞检测
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/save"
+)
+
+// ErrVetoed 检测前脚本否决了本次检测
+var ErrVetoed = errors.New("检测前脚本否决了本次检测")
+
+// PreCheckInput 通过 stdin 传给检测前脚本的内容
+type PreCheckInput struct {
+	RunID   int64            `json:"runId"`
+	Proxies []map[string]any `json:"proxies"`
+}
+
+// PreCheckOutput 检测前脚本在 stdout 输出的内容，不输出时节点列表保持不变
+type PreCheckOutput struct {
+	Veto    bool             `json:"veto"`
+	Reason  string           `json:"reason"`
+	Proxies []map[string]any `json:"proxies"` // 不为空时替换节点列表
+}
+
+// PostCheckInfo 检测完成后传给脚本的信息
+type PostCheckInfo struct {
+	RunID     int64
+	Started   time.Time
+	Duration  time.Duration
+	Total     int
+	Results   []check.Result
+	Files     []save.OutputFile
+	OutputDir string
+	Traffic   uint64 // 检测消耗的流量(字节)
+}
+
+// postCheckResults 写入结果文件的内容
+type postCheckResults struct {
+	RunID     int64             `json:"runId"`
+	Started   time.Time         `json:"started"`
+	Duration  float64           `json:"duration"`
+	Total     int               `json:"total"`
+	Available int               `json:"available"`
+	Files     []save.OutputFile `json:"files"`
+	Results   []json.RawMessage `json:"results"`
+}
+
+// pending 正在后台执行的检测后脚本
+var pending sync.WaitGroup
+
+// 脚本退出后等待其输出关闭的时间，避免脚本启动的子进程占用输出导致阻塞
+const waitDelay = 5 * time.Second
+
+// PreCheck 依次执行检测前脚本，返回修改后的节点列表
+// 脚本以非 0 退出码退出或输出 veto 时返回 ErrVetoed；脚本超时、无法执行或输出无效时忽略该脚本
+func PreCheck(runID int64, proxies []map[string]any) ([]map[string]any, error) {
+	for _, h := range config.GlobalConfig.Hooks.PreCheck {
+		if h.Path == "" {
+			continue
+		}
+		input, err := json.Marshal(PreCheckInput{RunID: runID, Proxies: proxies})
+		if err != nil {
+			return proxies, fmt.Errorf("序列化节点列表失败: %w", err)
+		}
+		env := []string{
+			"SUBCHECK_HOOK=pre-check",
+			fmt.Sprintf("SUBCHECK_RUN_ID=%d", runID),
+			fmt.Sprintf("SUBCHECK_PROXY_COUNT=%d", len(proxies)),
+		}
+		slog.Info(fmt.Sprintf("执行检测前脚本: %s", h.Path))
+		stdout, stderr, err := run(h, input, env)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%w: %s 退出码 %d %s", ErrVetoed, h.Path, exitErr.ExitCode(), tail(stderr))
+		}
+		if err != nil {
+			slog.Error(fmt.Sprintf("执行检测前脚本失败，忽略该脚本: %v", err))
+			continue
+		}
+		if len(stderr) > 0 {
+			slog.Debug(fmt.Sprintf("检测前脚本 %s 输出: %s", h.Path, tail(stderr)))
+		}
+		if len(bytes.TrimSpace(stdout)) == 0 {
+			continue
+		}
+		var out PreCheckOutput
+		if err := json.Unmarshal(stdout, &out); err != nil {
+			slog.Error(fmt.Sprintf("检测前脚本 %s 输出的不是有效的 JSON，忽略该脚本: %v", h.Path, err))
+			continue
+		}
+		if out.Veto {
+			return nil, fmt.Errorf("%w: %s %s", ErrVetoed, h.Path, out.Reason)
+		}
+		if out.Proxies != nil {
+			slog.Info(fmt.Sprintf("检测前脚本 %s 修改了节点列表: %d -> %d", h.Path, len(proxies), len(out.Proxies)))
+			proxies = out.Proxies
+		}
+	}
+	return proxies, nil
+}
+
+// PostCheck 在后台依次执行检测后脚本，callback-script 作为最后一个检测后脚本执行
+func PostCheck(info PostCheckInfo) {
+	scripts := postScripts()
+	if len(scripts) == 0 {
+		return
+	}
+	// 结果文件在返回前写入，之后的检测不会影响脚本读到的内容
+	path, err := writeResults(info)
+	if err != nil {
+		slog.Error(fmt.Sprintf("写入检测结果文件失败: %v", err))
+	}
+	env := postEnv(info, path)
+
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		if path != "" {
+			defer os.Remove(path)
+		}
+		for _, h := range scripts {
+			slog.Info(fmt.Sprintf("执行检测后脚本: %s", h.Path))
+			stdout, stderr, err := run(h, nil, env)
+			output := strings.TrimSpace(string(stdout) + string(stderr))
+			if err != nil {
+				slog.Error(fmt.Sprintf("执行检测后脚本失败: %v, 输出: %s", err, output))
+				continue
+			}
+			slog.Info(fmt.Sprintf("检测后脚本 %s 执行成功", h.Path))
+			if output != "" {
+				slog.Debug(fmt.Sprintf("检测后脚本 %s 输出: %s", h.Path, output))
+			}
+		}
+	}()
+}
+
+// Wait 等待后台执行的检测后脚本结束
+func Wait() {
+	pending.Wait()
+}
+
+// postScripts 检测后脚本，兼容旧的 callback-script
+func postScripts() []config.HookConfig {
+	var scripts []config.HookConfig
+	for _, h := range config.GlobalConfig.Hooks.PostCheck {
+		if h.Path != "" {
+			scripts = append(scripts, h)
+		}
+	}
+	if config.GlobalConfig.CallbackScript != "" {
+		scripts = append(scripts, config.HookConfig{Path: config.GlobalConfig.CallbackScript})
+	}
+	return scripts
+}
+
+// writeResults 将检测结果写入临时文件，返回文件路径
+func writeResults(info PostCheckInfo) (string, error) {
+	res := postCheckResults{
+		RunID:     info.RunID,
+		Started:   info.Started,
+		Duration:  info.Duration.Seconds(),
+		Total:     info.Total,
+		Available: len(info.Results),
+		Files:     info.Files,
+		Results:   make([]json.RawMessage, 0, len(info.Results)),
+	}
+	for _, r := range info.Results {
+		js, err := check.ResultJSON(r)
+		if err != nil {
+			continue
+		}
+		res.Results = append(res.Results, json.RawMessage(js))
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "subcheck-results-*.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// postEnv 检测后脚本的环境变量
+func postEnv(info PostCheckInfo, resultsPath string) []string {
+	names := make([]string, 0, len(info.Files))
+	var size int
+	for _, f := range info.Files {
+		names = append(names, f.Name)
+		size += f.Size
+	}
+	env := []string{
+		fmt.Sprintf("SUCCESS_COUNT=%d", len(info.Results)),
+		"SUBCHECK_HOOK=post-check",
+		fmt.Sprintf("SUBCHECK_RUN_ID=%d", info.RunID),
+		"SUBCHECK_RESULTS=" + resultsPath,
+		"SUBCHECK_OUTPUT_DIR=" + info.OutputDir,
+		"SUBCHECK_FILES=" + strings.Join(names, ","),
+		fmt.Sprintf("SUBCHECK_OUTPUT_BYTES=%d", size),
+		fmt.Sprintf("SUBCHECK_TOTAL_BYTES=%d", info.Traffic),
+		fmt.Sprintf("SUBCHECK_DURATION=%d", int64(info.Duration.Seconds())),
+		fmt.Sprintf("SUBCHECK_TOTAL=%d", info.Total),
+		fmt.Sprintf("SUBCHECK_AVAILABLE=%d", len(info.Results)),
+	}
+	platforms := make(map[string]int)
+	for _, s := range save.Snapshot(info.Results) {
+		for _, p := range s.Unlocks {
+			platforms[p]++
+		}
+	}
+	keys := make([]string, 0, len(platforms))
+	for p := range platforms {
+		keys = append(keys, p)
+	}
+	sort.Strings(keys)
+	for _, p := range keys {
+		name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(p))
+		env = append(env, fmt.Sprintf("SUBCHECK_PLATFORM_%s=%d", name, platforms[p]))
+	}
+	return env
+}
+
+// run 执行脚本，超时后结束脚本
+func run(h config.HookConfig, stdin []byte, env []string) ([]byte, []byte, error) {
+	path, err := filepath.Abs(h.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := prepareScript(path); err != nil {
+		return nil, nil, err
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = config.GlobalConfig.Hooks.Timeout
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = waitDelay
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return stdout.Bytes(), stderr.Bytes(), fmt.Errorf("脚本 %s 执行超过 %d 秒，已结束", h.Path, timeout)
+	}
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// prepareScript 检查脚本是否存在并设置执行权限
+func prepareScript(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("脚本不存在: %s", path)
+	}
+	if err := os.Chmod(path, 0755); err != nil {
+		slog.Warn(fmt.Sprintf("设置脚本执行权限失败: %v", err))
+	}
+	content, err := os.ReadFile(path)
+	if err == nil && len(content) > 0 && !bytes.HasPrefix(content, []byte("#!")) {
+		slog.Warn(fmt.Sprintf("脚本 %s 缺少shebang行，请在脚本开头添加对应的：#!/bin/bash、#!/bin/sh、#!/usr/bin/env bash 等", path))
+	}
+	return nil
+}
+
+// tail 截取脚本输出的最后一部分，用于日志与否决原因
+func tail(b []byte) string {
+	const max = 500
+	s := strings.TrimSpace(string(b))
+	if len(s) > max {
+		s = "..." + s[len(s)-max:]
+	}
+	return s
+}
@@ -0,0 +1,136 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/save"
+)
+
+func setup(t *testing.T, cfg config.HooksConfig, callback string) {
+	t.Helper()
+	old := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = old })
+	config.GlobalConfig = &config.Config{Hooks: cfg, CallbackScript: callback}
+}
+
+func script(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPreCheck(t *testing.T) {
+	proxies := []map[string]any{
+		{"name": "a", "type": "ss", "server": "1.1.1.1", "port": 443},
+		{"name": "b", "type": "ss", "server": "2.2.2.2", "port": 443},
+	}
+	tests := []struct {
+		name   string
+		body   string
+		veto   bool
+		result []string // 返回的节点名称
+	}{
+		{name: "no output keeps proxies", body: `cat >/dev/null`, result: []string{"a", "b"}},
+		{name: "replace proxies", body: `cat >/dev/null; echo '{"proxies":[{"name":"c","type":"ss","server":"3.3.3.3","port":8388}]}'`, result: []string{"c"}},
+		{name: "exit code vetoes", body: `echo maintenance >&2; exit 3`, veto: true},
+		{name: "json vetoes", body: `echo '{"veto":true,"reason":"quota"}'`, veto: true},
+		{name: "invalid json ignored", body: `echo not-json`, result: []string{"a", "b"}},
+		{name: "timeout ignored", body: `exec sleep 5`, result: []string{"a", "b"}},
+		{name: "reads stdin and env", body: `grep -q '"runId":9' && [ "$SUBCHECK_PROXY_COUNT" = 2 ] || exit 1`, result: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := script(t, t.TempDir(), "pre.sh", tt.body)
+			setup(t, config.HooksConfig{Timeout: 1, PreCheck: []config.HookConfig{{Path: path}}}, "")
+
+			got, err := PreCheck(9, proxies)
+			if tt.veto {
+				if !errors.Is(err, ErrVetoed) {
+					t.Fatalf("err = %v, want ErrVetoed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, p := range got {
+				names = append(names, p["name"].(string))
+			}
+			if strings.Join(names, ",") != strings.Join(tt.result, ",") {
+				t.Errorf("proxies = %v, want %v", names, tt.result)
+			}
+		})
+	}
+}
+
+func TestPostCheck(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	// 第一个脚本失败不影响后续脚本，callback-script 最后执行
+	first := script(t, dir, "first.sh", "exit 1")
+	post := script(t, dir, "post.sh", `env | grep -E '^(SUCCESS_COUNT|SUBCHECK_)' > "`+out+`.env"; cp "$SUBCHECK_RESULTS" "`+out+`.json"`)
+	setup(t, config.HooksConfig{Timeout: 5, PostCheck: []config.HookConfig{{Path: first}}}, post)
+
+	results := []check.Result{
+		{Proxy: map[string]any{"name": "jp", "type": "ss", "server": "1.1.1.1", "port": 443}, SpeedKBps: 100, Openai: true},
+		{Proxy: map[string]any{"name": "us", "type": "ss", "server": "2.2.2.2", "port": 443}, SpeedKBps: 50},
+	}
+	PostCheck(PostCheckInfo{
+		RunID:     4,
+		Started:   time.Now(),
+		Duration:  90 * time.Second,
+		Total:     10,
+		Results:   results,
+		Files:     []save.OutputFile{{Name: "mihomo.yaml", Size: 100}, {Name: "base64.txt", Size: 20}},
+		OutputDir: dir,
+		Traffic:   2048,
+	})
+	Wait()
+
+	data, err := os.ReadFile(out + ".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := string(data)
+	for _, want := range []string{
+		"SUCCESS_COUNT=2",
+		"SUBCHECK_HOOK=post-check",
+		"SUBCHECK_RUN_ID=4",
+		"SUBCHECK_OUTPUT_DIR=" + dir,
+		"SUBCHECK_FILES=mihomo.yaml,base64.txt",
+		"SUBCHECK_OUTPUT_BYTES=120",
+		"SUBCHECK_TOTAL_BYTES=2048",
+		"SUBCHECK_DURATION=90",
+		"SUBCHECK_TOTAL=10",
+		"SUBCHECK_AVAILABLE=2",
+		"SUBCHECK_PLATFORM_OPENAI=1",
+	} {
+		if !strings.Contains(env, want+"\n") {
+			t.Errorf("env missing %q:\n%s", want, env)
+		}
+	}
+
+	var got struct {
+		RunID   int64             `json:"runId"`
+		Results []json.RawMessage `json:"results"`
+	}
+	data, err = os.ReadFile(out + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil || got.RunID != 4 || len(got.Results) != 2 {
+		t.Errorf("results file = %s, %v", data, err)
+	}
+}
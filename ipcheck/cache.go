@@ -0,0 +1,193 @@
+package ipcheck
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/storage"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+)
+
+// 查询方式，不同方式的结果包含的内容不同，缓存按查询方式区分
+const (
+	KindChain  = "chain"  // 主检测按顺序查询，只有第一个给出分数的接口
+	KindFull   = "full"   // 查询所有接口的完整结果
+	KindScript = "script" // ip.sh 的完整报告
+)
+
+// cacheKinds 各查询方式可以使用的缓存，主检测只需要分数，任何方式给出分数的结果都可以使用
+var cacheKinds = map[string][]string{
+	KindChain:  nil,
+	KindFull:   {KindFull},
+	KindScript: {KindScript},
+}
+
+var (
+	group singleflight.Group
+
+	limiterLock sync.Mutex
+	limiter     *rate.Limiter
+	limiterRate int
+)
+
+// Wait 等待全局限速，主检测与定时IP质量检测共用 ip-check.rate-per-minute
+// 预计等待时间超过 ctx 的截止时间时立即返回错误
+func Wait(ctx context.Context) error {
+	return currentLimiter().Wait(ctx)
+}
+
+// currentLimiter 返回全局限速器，配置变化时重建
+func currentLimiter() *rate.Limiter {
+	limiterLock.Lock()
+	defer limiterLock.Unlock()
+
+	n := config.GlobalConfig.IpCheck.RatePerMin
+	if limiter != nil && n == limiterRate {
+		return limiter
+	}
+	if n <= 0 {
+		limiter = rate.NewLimiter(rate.Inf, 0)
+	} else {
+		limiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(n)), 1)
+	}
+	limiterRate = n
+	return limiter
+}
+
+// Lookup 以出口IP与查询方式为键查询风险
+// 缓存新鲜时直接返回数据库中的结果(Cached 为 true)，同一IP同一方式的并发请求合并为一次，
+// 未命中时在全局限速下执行 fn，并立即入库供后续节点使用
+func Lookup(ctx context.Context, ip, kind string, fn func(ctx context.Context) (*Report, error)) (*Report, error) {
+	if ip == "" {
+		return nil, errors.New("ip is empty")
+	}
+	v, err, _ := group.Do(kind+"|"+ip, func() (any, error) {
+		if rep := fromCache(ctx, ip, kind); rep != nil {
+			return rep, nil
+		}
+		if err := Wait(ctx); err != nil {
+			return nil, fmt.Errorf("等待IP质量检测限速失败: %w", err)
+		}
+		rep, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rep.Kind = kind
+		if err := Save(ctx, rep); err != nil {
+			slog.Debug(fmt.Sprintf("保存IP质量检测结果失败: %v", err))
+		}
+		return rep, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Report), nil
+}
+
+// fromCache 读取 ip-check.cache-hours 内可以用于 kind 查询方式的检测结果，没有分数的结果 FraudScore 为 -1
+func fromCache(ctx context.Context, ip, kind string) *Report {
+	hours := config.GlobalConfig.IpCheck.CacheHours
+	if hours <= 0 || storage.DB == nil {
+		return nil
+	}
+	kinds, ok := cacheKinds[kind]
+	if !ok {
+		kinds = []string{kind}
+	}
+	r, err := storage.QueryRecentIPQuality(ctx, ip, kinds, kind == KindChain, hours)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("读取IP质量缓存失败: %v", err))
+		return nil
+	}
+	if r == nil {
+		return nil
+	}
+	rep := &Report{
+		Core: Core{
+			IP:          r.IPAddress,
+			FraudScore:  -1,
+			RiskLevel:   r.RiskLevel.String,
+			IsProxy:     r.IsProxy.Bool,
+			IsVPN:       r.IsVPN.Bool,
+			IsTor:       r.IsTor.Bool,
+			CountryCode: r.CountryCode.String,
+		},
+		ID:     r.ID,
+		Kind:   r.LookupKind.String,
+		Cached: true,
+		Node:   r.NodeName.String,
+	}
+	if r.FraudScore.Valid {
+		rep.FraudScore = int(r.FraudScore.Int64)
+	}
+	if r.ReportJSON.Valid {
+		rep.Raw = json.RawMessage(r.ReportJSON.String)
+	}
+	list, err := storage.QueryIPQualityProviderResults(ctx, r.ID)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("读取IP质量缓存失败: %v", err))
+	}
+	for _, p := range list {
+		rep.Providers = append(rep.Providers, RiskReport{
+			Provider:     p.Provider,
+			Score:        p.Score,
+			Level:        p.RiskLevel,
+			Country:      p.CountryCode,
+			IsProxy:      p.IsProxy,
+			IsVPN:        p.IsVPN,
+			IsTor:        p.IsTor,
+			IsDatacenter: p.IsDatacenter,
+		})
+	}
+	return rep
+}
+
+// Save 保存汇总结果与每个接口的结果，保存成功后 rep.ID 为结果的ID
+func Save(ctx context.Context, rep *Report) error {
+	if storage.DB == nil {
+		return errors.New("database not initialized")
+	}
+	id, err := storage.SaveIPQualityResult(ctx, sql.NullInt64{}, rep.IP,
+		sql.NullInt64{Int64: int64(rep.FraudScore), Valid: rep.FraudScore >= 0},
+		sql.NullString{String: rep.RiskLevel, Valid: rep.RiskLevel != ""},
+		sql.NullBool{Bool: rep.IsProxy, Valid: true}, sql.NullBool{Bool: rep.IsVPN, Valid: true}, sql.NullBool{Bool: rep.IsTor, Valid: true},
+		sql.NullString{String: rep.CountryCode, Valid: rep.CountryCode != ""})
+	if err != nil {
+		return err
+	}
+	rep.ID = id
+	raw := rep.Raw
+	if len(raw) == 0 {
+		// 内置检测没有 ip.sh 报告，保存汇总与每个接口的结果及错误
+		raw, _ = json.Marshal(struct {
+			Core
+			Providers []RiskReport      `json:"providers"`
+			Errors    map[string]string `json:"errors,omitempty"`
+		}{rep.Core, rep.Providers, rep.Errors})
+	}
+	if err := storage.SaveIPQualityReport(ctx, id, rep.Node, rep.Kind, string(raw)); err != nil {
+		return err
+	}
+	list := make([]storage.IPQualityProviderResult, 0, len(rep.Providers))
+	for _, r := range rep.Providers {
+		list = append(list, storage.IPQualityProviderResult{
+			Provider:     r.Provider,
+			Score:        r.Score,
+			RiskLevel:    r.Level,
+			CountryCode:  r.Country,
+			IsProxy:      r.IsProxy,
+			IsVPN:        r.IsVPN,
+			IsTor:        r.IsTor,
+			IsDatacenter: r.IsDatacenter,
+		})
+	}
+	return storage.SaveIPQualityProviderResults(ctx, id, list)
+}
@@ -0,0 +1,199 @@
+package ipcheck
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/storage"
+)
+
+func setupCache(t *testing.T) {
+	t.Helper()
+	if err := storage.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		storage.Close()
+		storage.DB = nil
+	})
+
+	old := config.GlobalConfig.IpCheck
+	t.Cleanup(func() { config.GlobalConfig.IpCheck = old })
+	config.GlobalConfig.IpCheck.CacheHours = 24
+	config.GlobalConfig.IpCheck.RatePerMin = 0
+}
+
+func TestLookupCache(t *testing.T) {
+	setupCache(t)
+
+	var calls atomic.Int32
+	fn := func(context.Context) (*Report, error) {
+		calls.Add(1)
+		// 保证并发请求都在等待同一次查询
+		time.Sleep(50 * time.Millisecond)
+		return NewReport("203.0.113.7",
+			RiskReport{Provider: "scamalytics", Score: 30, IsVPN: true},
+			RiskReport{Provider: "dbip", Score: -1, Level: "low", Country: "JP"},
+		), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Lookup(context.Background(), "203.0.113.7", KindFull, fn); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("concurrent lookups of one IP should run once, ran %d times", n)
+	}
+
+	rep, err := Lookup(context.Background(), "203.0.113.7", KindFull, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Cached || calls.Load() != 1 {
+		t.Fatalf("second lookup should be served from cache, cached=%v calls=%d", rep.Cached, calls.Load())
+	}
+	if rep.FraudScore != 30 || rep.CountryCode != "JP" || !rep.IsVPN {
+		t.Errorf("cached core = %+v", rep.Core)
+	}
+	if len(rep.Providers) != 2 || rep.Providers[1].Score != -1 || rep.Providers[1].Level != "low" {
+		t.Errorf("cached providers = %+v", rep.Providers)
+	}
+
+	// 内置检测也保存完整报告，供详情接口展示
+	if len(rep.Raw) == 0 || !strings.Contains(string(rep.Raw), `"provider":"scamalytics"`) {
+		t.Errorf("native report should be persisted, raw = %s", rep.Raw)
+	}
+	row, err := storage.GetIPQualityResult(context.Background(), rep.ID)
+	if err != nil || row == nil || !row.HasReport {
+		t.Errorf("GetIPQualityResult(%d) = %+v, %v", rep.ID, row, err)
+	}
+
+	config.GlobalConfig.IpCheck.CacheHours = 0
+	if rep, _ := Lookup(context.Background(), "203.0.113.7", KindFull, fn); rep.Cached || calls.Load() != 2 {
+		t.Errorf("cache-hours 0 should disable the cache")
+	}
+}
+
+func TestLookupKinds(t *testing.T) {
+	setupCache(t)
+
+	const ip = "203.0.113.8"
+	var chainCalls, fullCalls int
+	chain := func(context.Context) (*Report, error) {
+		chainCalls++
+		return NewReport(ip, RiskReport{Provider: "scamalytics", Score: 30}), nil
+	}
+	full := func(context.Context) (*Report, error) {
+		fullCalls++
+		return NewReport(ip,
+			RiskReport{Provider: "scamalytics", Score: 30},
+			RiskReport{Provider: "ipapi", Score: 10},
+			RiskReport{Provider: "dbip", Score: -1, Level: "low"},
+		), nil
+	}
+
+	tests := []struct {
+		name       string
+		kind       string
+		fn         func(context.Context) (*Report, error)
+		cached     bool
+		providers  int
+		chainCalls int
+		fullCalls  int
+	}{
+		{"chain lookup", KindChain, chain, false, 1, 1, 0},
+		// 主检测只查询了一个接口，完整检测不能使用它的结果
+		{"full lookup after chain", KindFull, full, false, 3, 1, 1},
+		{"full lookup cached", KindFull, full, true, 3, 1, 1},
+		{"chain lookup uses any result", KindChain, chain, true, 3, 1, 1},
+		{"script lookup ignores full", KindScript, full, false, 3, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep, err := Lookup(context.Background(), ip, tt.kind, tt.fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Cached != tt.cached || len(rep.Providers) != tt.providers {
+				t.Errorf("cached=%v providers=%d, want cached=%v providers=%d", rep.Cached, len(rep.Providers), tt.cached, tt.providers)
+			}
+			if chainCalls != tt.chainCalls || fullCalls != tt.fullCalls {
+				t.Errorf("calls chain=%d full=%d, want chain=%d full=%d", chainCalls, fullCalls, tt.chainCalls, tt.fullCalls)
+			}
+		})
+	}
+}
+
+func TestLookupUnscored(t *testing.T) {
+	setupCache(t)
+
+	const ip = "203.0.113.9"
+	var calls int
+	unscored := func(context.Context) (*Report, error) {
+		calls++
+		return NewReport(ip, RiskReport{Provider: "dbip", Score: -1, Level: "low"}), nil
+	}
+	chain := func(context.Context) (*Report, error) {
+		calls++
+		return NewReport(ip, RiskReport{Provider: "scamalytics", Score: 40}), nil
+	}
+
+	tests := []struct {
+		name   string
+		kind   string
+		fn     func(context.Context) (*Report, error)
+		cached bool
+		score  int
+		calls  int
+	}{
+		{"full lookup without score", KindFull, unscored, false, -1, 1},
+		// 没有分数的结果读回时不能变成 0 分
+		{"full lookup cached", KindFull, unscored, true, -1, 1},
+		// 主检测需要分数，跳过没有分数的结果
+		{"chain lookup skips unscored", KindChain, chain, false, 40, 2},
+		{"chain lookup cached", KindChain, chain, true, 40, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep, err := Lookup(context.Background(), ip, tt.kind, tt.fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Cached != tt.cached || rep.FraudScore != tt.score || calls != tt.calls {
+				t.Errorf("cached=%v score=%d calls=%d, want cached=%v score=%d calls=%d", rep.Cached, rep.FraudScore, calls, tt.cached, tt.score, tt.calls)
+			}
+		})
+	}
+}
+
+func TestWaitRateLimit(t *testing.T) {
+	old := config.GlobalConfig.IpCheck.RatePerMin
+	t.Cleanup(func() { config.GlobalConfig.IpCheck.RatePerMin = old })
+	config.GlobalConfig.IpCheck.RatePerMin = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Wait(ctx); err != nil {
+		t.Fatalf("first token should be available: %v", err)
+	}
+	// 下一个令牌要等1分钟，超过截止时间应立即失败
+	if err := Wait(ctx); err == nil {
+		t.Errorf("second wait should fail when the deadline is shorter than the interval")
+	}
+}
@@ -9,11 +9,14 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/metacubex/mihomo/constant"
 	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/gateway"
 	"github.com/twj0/subcheck/utils"
 )
 
@@ -99,9 +102,28 @@ func RunDefault(ctx context.Context) (Result, error) {
 	return Run(ctx, "")
 }
 
+// RunProxy 为节点启动临时的本地入站，让 ip.sh 通过节点出口完成检测
+func RunProxy(ctx context.Context, proxy constant.Proxy) (Result, error) {
+	l, err := gateway.ListenProxy(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("启动本地入站失败: %w", err)
+	}
+	defer l.Close()
+	return Run(ctx, l.ProxyURL())
+}
+
+// NewScriptReport 由 ip.sh 的输出生成检测结果，保留完整的原始报告
+func NewScriptReport(res Result) *Report {
+	rep := &Report{Core: ExtractCore(res), Providers: ExtractProviders(res), Kind: KindScript}
+	if raw, err := json.Marshal(res); err == nil {
+		rep.Raw = raw
+	}
+	return rep
+}
+
 type Core struct {
 	IP          string
-	FraudScore  int
+	FraudScore  int // 0-100，-1 表示没有给出分数
 	RiskLevel   string
 	IsProxy     bool
 	IsVPN       bool
@@ -110,7 +132,7 @@ type Core struct {
 }
 
 func ExtractCore(res Result) Core {
-	var core Core
+	core := Core{FraudScore: -1}
 	getMap := func(v any) map[string]any {
 		if m, ok := v.(map[string]any); ok {
 			return m
@@ -174,22 +196,7 @@ func ExtractCore(res Result) Core {
 				core.FraudScore = n
 			}
 		}
-		switch {
-		case core.FraudScore <= 10:
-			core.RiskLevel = "VeryLow"
-		case core.FraudScore <= 25:
-			core.RiskLevel = "Low"
-		case core.FraudScore <= 50:
-			core.RiskLevel = "Medium"
-		case core.FraudScore <= 75:
-			core.RiskLevel = "High"
-		default:
-			if core.FraudScore > 0 {
-				core.RiskLevel = "VeryHigh"
-			} else {
-				core.RiskLevel = "Unknown"
-			}
-		}
+		core.RiskLevel = RiskLevel(core.FraudScore)
 	}
 
 	if factor := getArr(res, "Factor"); len(factor) > 0 {
@@ -211,3 +218,30 @@ func ExtractCore(res Result) Core {
 	}
 	return core
 }
+
+// ExtractProviders 从 ip.sh 输出的 Score 中提取每个接口的分数
+func ExtractProviders(res Result) []RiskReport {
+	score, ok := res["Score"].([]any)
+	if !ok || len(score) == 0 {
+		return nil
+	}
+	m, ok := score[0].(map[string]any)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var out []RiskReport
+	for _, k := range keys {
+		s, _ := m[k].(string)
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		out = append(out, RiskReport{Provider: strings.ToLower(k), Score: n, Level: RiskLevel(n)})
+	}
+	return out
+}
@@ -0,0 +1,239 @@
+package ipcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/metacubex/mihomo/common/convert"
+	"github.com/twj0/subcheck/config"
+)
+
+// ErrNoAPIKey 接口需要API Key但没有配置，检测时跳过该接口
+var ErrNoAPIKey = errors.New("未配置API Key")
+
+// RiskReport 单个接口对IP的风险评估
+type RiskReport struct {
+	Provider     string `json:"provider"`
+	Score        int    `json:"score"` // 0-100，越高风险越大，-1 表示接口没有给出分数
+	Level        string `json:"level,omitempty"`
+	Country      string `json:"country,omitempty"`
+	IsProxy      bool   `json:"is_proxy"`
+	IsVPN        bool   `json:"is_vpn"`
+	IsTor        bool   `json:"is_tor"`
+	IsDatacenter bool   `json:"is_datacenter"`
+}
+
+// IPRiskProvider IP风险查询接口，client 为节点的代理client时通过节点出口查询
+type IPRiskProvider interface {
+	Name() string
+	Check(ctx context.Context, client *http.Client, ip string) (RiskReport, error)
+}
+
+// Report 一个IP在所有接口上的检测结果，Core 为汇总后的结果
+type Report struct {
+	Core
+	Providers []RiskReport      `json:"providers"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	ID        int64             `json:"id,omitempty"`   // ip_quality_results 中的ID
+	Kind      string            `json:"kind,omitempty"` // 查询方式，见 KindChain 等
+	Cached    bool              `json:"cached"`         // 是否来自缓存
+	Node      string            `json:"node,omitempty"` // 检测所用的节点名称，本机检测为空
+	Raw       json.RawMessage   `json:"raw,omitempty"`  // ip.sh 的完整报告
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = make(map[string]IPRiskProvider)
+)
+
+// Register 注册接口，同名接口会被覆盖
+func Register(p IPRiskProvider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[strings.ToLower(p.Name())] = p
+}
+
+// Providers 按 ip-check.providers 的顺序返回已注册的接口
+func Providers() []IPRiskProvider {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	var out []IPRiskProvider
+	for _, name := range config.GlobalConfig.IpCheck.Providers {
+		p, ok := providers[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			slog.Warn(fmt.Sprintf("未知的IP质量检测接口: %s", name))
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// Check 并发查询所有接口，汇总为一个结果
+func Check(ctx context.Context, client *http.Client, ip string) (*Report, error) {
+	if ip == "" {
+		return nil, errors.New("ip is empty")
+	}
+	list := Providers()
+	if len(list) == 0 {
+		return nil, errors.New("没有可用的IP质量检测接口")
+	}
+
+	reports := make([]*RiskReport, len(list))
+	errs := make([]error, len(list))
+	var wg sync.WaitGroup
+	for i, p := range list {
+		wg.Add(1)
+		go func(i int, p IPRiskProvider) {
+			defer wg.Done()
+			r, err := p.Check(ctx, client, ip)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			r.Provider = p.Name()
+			reports[i] = &r
+		}(i, p)
+	}
+	wg.Wait()
+
+	rep := &Report{Core: Core{IP: ip}}
+	for i, r := range reports {
+		if r != nil {
+			rep.Providers = append(rep.Providers, *r)
+			continue
+		}
+		if errors.Is(errs[i], ErrNoAPIKey) {
+			continue
+		}
+		if rep.Errors == nil {
+			rep.Errors = make(map[string]string)
+		}
+		rep.Errors[list[i].Name()] = errs[i].Error()
+		slog.Debug(fmt.Sprintf("%s查询IP质量失败: %v", list[i].Name(), errs[i]))
+	}
+	if len(rep.Providers) == 0 {
+		return rep, fmt.Errorf("所有IP质量检测接口都失败: %v", rep.Errors)
+	}
+	rep.Core = summarize(ip, rep.Providers)
+	return rep, nil
+}
+
+// CheckChain 按 ip-check.providers 的顺序依次查询，返回第一个给出分数的接口结果
+// 用于主检测流程，避免每个节点都请求所有接口
+func CheckChain(ctx context.Context, client *http.Client, ip string) (RiskReport, error) {
+	if ip == "" {
+		return RiskReport{Score: -1}, errors.New("ip is empty")
+	}
+	var errs []error
+	for _, p := range Providers() {
+		r, err := p.Check(ctx, client, ip)
+		if errors.Is(err, ErrNoAPIKey) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		if r.Score < 0 {
+			continue
+		}
+		r.Provider = p.Name()
+		return r, nil
+	}
+	if len(errs) == 0 {
+		return RiskReport{Score: -1}, errors.New("没有接口给出风险分数")
+	}
+	return RiskReport{Score: -1}, errors.Join(errs...)
+}
+
+// NewReport 由若干接口结果生成汇总结果
+func NewReport(ip string, reports ...RiskReport) *Report {
+	return &Report{Core: summarize(ip, reports), Providers: reports}
+}
+
+// summarize 综合分数取第一个给出分数的接口，没有接口给出分数时为 -1，代理/VPN/Tor 任一接口命中即为真
+func summarize(ip string, reports []RiskReport) Core {
+	core := Core{IP: ip, FraudScore: -1}
+	level := ""
+	for _, r := range reports {
+		if core.FraudScore < 0 && r.Score >= 0 {
+			core.FraudScore = r.Score
+		}
+		if level == "" && r.Level != "" {
+			level = r.Level
+		}
+		if core.CountryCode == "" {
+			core.CountryCode = r.Country
+		}
+		core.IsProxy = core.IsProxy || r.IsProxy
+		core.IsVPN = core.IsVPN || r.IsVPN
+		core.IsTor = core.IsTor || r.IsTor
+	}
+	if core.FraudScore >= 0 {
+		core.RiskLevel = RiskLevel(core.FraudScore)
+	} else {
+		core.RiskLevel = "Unknown"
+		if level != "" {
+			core.RiskLevel = level
+		}
+	}
+	return core
+}
+
+// RiskLevel 将 0-100 的分数转换为风险等级
+func RiskLevel(score int) string {
+	switch {
+	case score < 0:
+		return "Unknown"
+	case score <= 10:
+		return "VeryLow"
+	case score <= 25:
+		return "Low"
+	case score <= 50:
+		return "Medium"
+	case score <= 75:
+		return "High"
+	default:
+		return "VeryHigh"
+	}
+}
+
+// apiKey 获取接口的API Key
+func apiKey(name string) string {
+	return strings.TrimSpace(config.GlobalConfig.IpCheck.APIKeys[name])
+}
+
+// get 发送GET请求并返回响应内容
+func get(ctx context.Context, client *http.Client, url string, header map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", convert.RandUserAgent())
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("返回非200状态码: %v", resp.StatusCode)
+	}
+	return body, nil
+}
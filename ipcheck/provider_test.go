@@ -0,0 +1,206 @@
+package ipcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/twj0/subcheck/config"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseProviders(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		parse   func([]byte) (RiskReport, error)
+		want    RiskReport
+		wantErr bool
+	}{
+		{
+			name:    "scamalytics",
+			fixture: "scamalytics.html",
+			parse:   parseScamalytics,
+			want:    RiskReport{Score: 57, Level: "medium", IsVPN: true, IsProxy: true, IsDatacenter: true},
+		},
+		{
+			name:    "scamalytics without api block",
+			fixture: "scamalytics_noapi.html",
+			parse:   parseScamalytics,
+			want:    RiskReport{Score: 4, IsTor: true},
+		},
+		{
+			name:    "scamalytics challenge page",
+			fixture: "scamalytics_blocked.html",
+			parse:   parseScamalytics,
+			want:    RiskReport{Score: -1},
+			wantErr: true,
+		},
+		{
+			name:    "ipqs",
+			fixture: "ipqs.json",
+			parse:   parseIPQS,
+			want:    RiskReport{Score: 88, Country: "US", IsProxy: true, IsVPN: true},
+		},
+		{
+			name:    "ipqs invalid key",
+			fixture: "ipqs_error.json",
+			parse:   parseIPQS,
+			want:    RiskReport{Score: -1},
+			wantErr: true,
+		},
+		{
+			name:    "ip2location free",
+			fixture: "ip2location.json",
+			parse:   parseIP2Location,
+			want:    RiskReport{Score: -1, Country: "JP"},
+		},
+		{
+			name:    "ip2location with proxy data",
+			fixture: "ip2location_plus.json",
+			parse:   parseIP2Location,
+			want:    RiskReport{Score: 33, Country: "DE", IsProxy: true, IsDatacenter: true},
+		},
+		{
+			name:    "ipapi",
+			fixture: "ipapi.json",
+			parse:   parseIPAPI,
+			want:    RiskReport{Score: 12, Level: "High", Country: "US", IsVPN: true, IsDatacenter: true},
+		},
+		{
+			name:    "dbip",
+			fixture: "dbip.json",
+			parse:   parseDBIP,
+			want:    RiskReport{Score: -1, Level: "high", Country: "SG", IsProxy: true, IsVPN: true, IsDatacenter: true},
+		},
+		{
+			name:    "abuseipdb",
+			fixture: "abuseipdb.json",
+			parse:   parseAbuseIPDB,
+			want:    RiskReport{Score: 100, Country: "NL", IsTor: true, IsDatacenter: true},
+		},
+		{
+			name:    "abuseipdb auth error",
+			fixture: "abuseipdb_error.json",
+			parse:   parseAbuseIPDB,
+			want:    RiskReport{Score: -1},
+			wantErr: true,
+		},
+		{
+			name:    "html instead of json",
+			fixture: "scamalytics.html",
+			parse:   parseIPQS,
+			want:    RiskReport{Score: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(readFixture(t, tt.fixture))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeProvider 返回固定结果的接口
+type fakeProvider struct {
+	name   string
+	report RiskReport
+	err    error
+	calls  int
+}
+
+func (f *fakeProvider) Name() string { return f.name }
+
+func (f *fakeProvider) Check(context.Context, *http.Client, string) (RiskReport, error) {
+	f.calls++
+	return f.report, f.err
+}
+
+// registerFake 注册测试用的接口，测试结束后恢复注册表
+func registerFake(t *testing.T, list ...IPRiskProvider) {
+	t.Helper()
+	for _, p := range list {
+		key := strings.ToLower(p.Name())
+		providersLock.Lock()
+		prev, existed := providers[key]
+		providersLock.Unlock()
+		t.Cleanup(func() {
+			providersLock.Lock()
+			defer providersLock.Unlock()
+			if existed {
+				providers[key] = prev
+			} else {
+				delete(providers, key)
+			}
+		})
+		Register(p)
+	}
+}
+
+func TestCheckChain(t *testing.T) {
+	failing := &fakeProvider{name: "fake-failing", report: RiskReport{Score: -1}, err: errors.New("blocked")}
+	nokey := &fakeProvider{name: "fake-nokey", report: RiskReport{Score: -1}, err: ErrNoAPIKey}
+	noscore := &fakeProvider{name: "fake-noscore", report: RiskReport{Score: -1, Country: "US"}}
+	good := &fakeProvider{name: "fake-good", report: RiskReport{Score: 42, IsVPN: true}}
+	last := &fakeProvider{name: "fake-last", report: RiskReport{Score: 1}}
+	registerFake(t, failing, nokey, noscore, good, last)
+
+	old := config.GlobalConfig.IpCheck.Providers
+	t.Cleanup(func() { config.GlobalConfig.IpCheck.Providers = old })
+	config.GlobalConfig.IpCheck.Providers = []string{"fake-failing", "fake-nokey", "fake-noscore", "fake-good", "fake-last"}
+
+	got, err := CheckChain(context.Background(), http.DefaultClient, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("CheckChain() error = %v", err)
+	}
+	if got.Provider != "fake-good" || got.Score != 42 || !got.IsVPN {
+		t.Errorf("CheckChain() = %+v, want the first provider with a score", got)
+	}
+	if last.calls != 0 {
+		t.Errorf("providers after the first success should not be called")
+	}
+
+	config.GlobalConfig.IpCheck.Providers = []string{"fake-failing", "fake-nokey"}
+	if _, err := CheckChain(context.Background(), http.DefaultClient, "203.0.113.7"); err == nil {
+		t.Errorf("CheckChain() should fail when every provider fails")
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	rep := NewReport("203.0.113.7",
+		RiskReport{Provider: "dbip", Score: -1, Level: "high", Country: "SG"},
+		RiskReport{Provider: "ipapi", Score: 60, IsTor: true},
+		RiskReport{Provider: "abuseipdb", Score: 5, IsProxy: true},
+	)
+	want := Core{IP: "203.0.113.7", FraudScore: 60, RiskLevel: "High", CountryCode: "SG", IsProxy: true, IsTor: true}
+	if rep.Core != want {
+		t.Errorf("NewReport().Core = %+v, want %+v", rep.Core, want)
+	}
+	if len(rep.Providers) != 3 {
+		t.Errorf("every provider result should be kept, got %d", len(rep.Providers))
+	}
+
+	// 没有接口给出分数时不能当作 0 分
+	rep = NewReport("203.0.113.7", RiskReport{Provider: "dbip", Score: -1, Level: "low"})
+	if rep.FraudScore != -1 || rep.RiskLevel != "low" {
+		t.Errorf("unscored NewReport().Core = %+v, want score -1", rep.Core)
+	}
+}
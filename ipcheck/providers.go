@@ -0,0 +1,320 @@
+package ipcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(scamalytics{})
+	Register(ipqs{})
+	Register(ip2location{})
+	Register(ipapi{})
+	Register(dbip{})
+	Register(abuseipdb{})
+}
+
+// scamalytics 解析 https://scamalytics.com/ip/{ip} 网页，无需API Key
+type scamalytics struct{}
+
+func (scamalytics) Name() string { return "scamalytics" }
+
+var (
+	scamalyticsScoreRe = regexp.MustCompile(`"score"\s*:\s*"?(\d{1,3})"?`)
+	scamalyticsRiskRe  = regexp.MustCompile(`"risk"\s*:\s*"([A-Za-z ]+)"`)
+	scamalyticsFraudRe = regexp.MustCompile(`(?i)Fraud\s+Score:?\s*(\d{1,3})`)
+	scamalyticsFlagRe  = regexp.MustCompile(`(?is)<th[^>]*>\s*([^<]+?)\s*</th>\s*<td[^>]*>\s*(?:<div[^>]*>)?\s*(Yes|No)\b`)
+)
+
+const scamalyticsAPISection = "IP Fraud Risk API"
+
+func (s scamalytics) Check(ctx context.Context, client *http.Client, ip string) (RiskReport, error) {
+	body, err := get(ctx, client, "https://scamalytics.com/ip/"+url.PathEscape(ip), nil)
+	if err != nil {
+		return RiskReport{Score: -1}, err
+	}
+	return parseScamalytics(body)
+}
+
+// parseScamalytics 解析网页中的分数与代理标记
+// 优先使用 "IP Fraud Risk API" 示例中的 JSON，页面结构变化时退回到 "Fraud Score: NN" 文本
+func parseScamalytics(body []byte) (RiskReport, error) {
+	r := RiskReport{Score: -1}
+	page := string(body)
+	section := page
+	if idx := strings.Index(page, scamalyticsAPISection); idx >= 0 {
+		section = page[idx:]
+	}
+	m := scamalyticsScoreRe.FindStringSubmatch(section)
+	if m == nil {
+		m = scamalyticsFraudRe.FindStringSubmatch(page)
+	}
+	if m == nil {
+		return r, fmt.Errorf("未找到欺诈分数")
+	}
+	score, err := strconv.Atoi(m[1])
+	if err != nil || score > 100 {
+		return r, fmt.Errorf("欺诈分数无效: %s", m[1])
+	}
+	r.Score = score
+	if m := scamalyticsRiskRe.FindStringSubmatch(section); m != nil {
+		r.Level = strings.TrimSpace(m[1])
+	}
+
+	for _, m := range scamalyticsFlagRe.FindAllStringSubmatch(page, -1) {
+		yes := strings.EqualFold(m[2], "yes")
+		switch strings.ToLower(strings.TrimSpace(m[1])) {
+		case "anonymizing vpn":
+			r.IsVPN = r.IsVPN || yes
+		case "tor exit node":
+			r.IsTor = r.IsTor || yes
+		case "server":
+			r.IsDatacenter = r.IsDatacenter || yes
+		case "public proxy", "web proxy":
+			r.IsProxy = r.IsProxy || yes
+		}
+	}
+	return r, nil
+}
+
+// ipqs IPQualityScore，需要API Key
+type ipqs struct{}
+
+func (ipqs) Name() string { return "ipqs" }
+
+func (q ipqs) Check(ctx context.Context, client *http.Client, ip string) (RiskReport, error) {
+	key := apiKey(q.Name())
+	if key == "" {
+		return RiskReport{Score: -1}, ErrNoAPIKey
+	}
+	u := fmt.Sprintf("https://ipqualityscore.com/api/json/ip/%s/%s?strictness=1", url.PathEscape(key), url.PathEscape(ip))
+	body, err := get(ctx, client, u, nil)
+	if err != nil {
+		return RiskReport{Score: -1}, err
+	}
+	return parseIPQS(body)
+}
+
+func parseIPQS(body []byte) (RiskReport, error) {
+	r := RiskReport{Score: -1}
+	var resp struct {
+		Success     bool   `json:"success"`
+		Message     string `json:"message"`
+		FraudScore  int    `json:"fraud_score"`
+		CountryCode string `json:"country_code"`
+		Proxy       bool   `json:"proxy"`
+		VPN         bool   `json:"vpn"`
+		Tor         bool   `json:"tor"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return r, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	if !resp.Success {
+		return r, fmt.Errorf("查询失败: %s", resp.Message)
+	}
+	r.Score = resp.FraudScore
+	r.Country = strings.ToUpper(resp.CountryCode)
+	r.IsProxy, r.IsVPN, r.IsTor = resp.Proxy, resp.VPN, resp.Tor
+	return r, nil
+}
+
+// ip2location ip2location.io，不配置API Key时使用免费额度，免费额度不返回欺诈分数
+type ip2location struct{}
+
+func (ip2location) Name() string { return "ip2location" }
+
+func (l ip2location) Check(ctx context.Context, client *http.Client, ip string) (RiskReport, error) {
+	q := url.Values{"ip": {ip}}
+	if key := apiKey(l.Name()); key != "" {
+		q.Set("key", key)
+	}
+	body, err := get(ctx, client, "https://api.ip2location.io/?"+q.Encode(), nil)
+	if err != nil {
+		return RiskReport{Score: -1}, err
+	}
+	return parseIP2Location(body)
+}
+
+func parseIP2Location(body []byte) (RiskReport, error) {
+	r := RiskReport{Score: -1}
+	var resp struct {
+		CountryCode string `json:"country_code"`
+		IsProxy     bool   `json:"is_proxy"`
+		FraudScore  *int   `json:"fraud_score"`
+		Proxy       *struct {
+			IsVPN        bool `json:"is_vpn"`
+			IsTor        bool `json:"is_tor"`
+			IsDataCenter bool `json:"is_data_center"`
+		} `json:"proxy"`
+		Error *struct {
+			Message string `json:"error_message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return r, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	if resp.Error != nil {
+		return r, fmt.Errorf("查询失败: %s", resp.Error.Message)
+	}
+	if resp.FraudScore != nil {
+		r.Score = *resp.FraudScore
+	}
+	r.Country = strings.ToUpper(resp.CountryCode)
+	r.IsProxy = resp.IsProxy
+	if resp.Proxy != nil {
+		r.IsVPN, r.IsTor, r.IsDatacenter = resp.Proxy.IsVPN, resp.Proxy.IsTor, resp.Proxy.IsDataCenter
+	}
+	return r, nil
+}
+
+// ipapi ipapi.is，abuser_score 形如 "0.0039 (Low)"
+type ipapi struct{}
+
+func (ipapi) Name() string { return "ipapi" }
+
+var abuserScoreRe = regexp.MustCompile(`^\s*([\d.]+)\s*(?:\(([^)]+)\))?`)
+
+func (a ipapi) Check(ctx context.Context, client *http.Client, ip string) (RiskReport, error) {
+	q := url.Values{"q": {ip}}
+	if key := apiKey(a.Name()); key != "" {
+		q.Set("key", key)
+	}
+	body, err := get(ctx, client, "https://api.ipapi.is/?"+q.Encode(), nil)
+	if err != nil {
+		return RiskReport{Score: -1}, err
+	}
+	return parseIPAPI(body)
+}
+
+func parseIPAPI(body []byte) (RiskReport, error) {
+	r := RiskReport{Score: -1}
+	var resp struct {
+		Error        string `json:"error"`
+		IsDatacenter bool   `json:"is_datacenter"`
+		IsTor        bool   `json:"is_tor"`
+		IsProxy      bool   `json:"is_proxy"`
+		IsVPN        bool   `json:"is_vpn"`
+		Company      struct {
+			AbuserScore string `json:"abuser_score"`
+		} `json:"company"`
+		ASN struct {
+			AbuserScore string `json:"abuser_score"`
+		} `json:"asn"`
+		Location struct {
+			CountryCode string `json:"country_code"`
+		} `json:"location"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return r, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	if resp.Error != "" {
+		return r, fmt.Errorf("查询失败: %s", resp.Error)
+	}
+	abuser := resp.Company.AbuserScore
+	if abuser == "" {
+		abuser = resp.ASN.AbuserScore
+	}
+	if m := abuserScoreRe.FindStringSubmatch(abuser); m != nil {
+		if f, err := strconv.ParseFloat(m[1], 64); err == nil {
+			r.Score = int(math.Round(f * 100))
+		}
+		r.Level = m[2]
+	}
+	r.Country = strings.ToUpper(resp.Location.CountryCode)
+	r.IsProxy, r.IsVPN, r.IsTor, r.IsDatacenter = resp.IsProxy, resp.IsVPN, resp.IsTor, resp.IsDatacenter
+	return r, nil
+}
+
+// dbip DB-IP，免费接口只返回位置，配置API Key后返回威胁等级
+type dbip struct{}
+
+func (dbip) Name() string { return "dbip" }
+
+func (d dbip) Check(ctx context.Context, client *http.Client, ip string) (RiskReport, error) {
+	key := apiKey(d.Name())
+	if key == "" {
+		key = "free"
+	}
+	body, err := get(ctx, client, fmt.Sprintf("https://api.db-ip.com/v2/%s/%s", url.PathEscape(key), url.PathEscape(ip)), nil)
+	if err != nil {
+		return RiskReport{Score: -1}, err
+	}
+	return parseDBIP(body)
+}
+
+func parseDBIP(body []byte) (RiskReport, error) {
+	r := RiskReport{Score: -1}
+	var resp struct {
+		Error       string `json:"error"`
+		CountryCode string `json:"countryCode"`
+		ThreatLevel string `json:"threatLevel"`
+		IsProxy     bool   `json:"isProxy"`
+		ProxyType   string `json:"proxyType"`
+		UsageType   string `json:"usageType"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return r, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	if resp.Error != "" {
+		return r, fmt.Errorf("查询失败: %s", resp.Error)
+	}
+	r.Country = strings.ToUpper(resp.CountryCode)
+	r.Level = resp.ThreatLevel
+	r.IsProxy = resp.IsProxy
+	switch strings.ToLower(resp.ProxyType) {
+	case "vpn":
+		r.IsVPN = true
+	case "tor":
+		r.IsTor = true
+	}
+	r.IsDatacenter = strings.EqualFold(resp.UsageType, "hosting")
+	return r, nil
+}
+
+// abuseipdb AbuseIPDB，需要API Key
+type abuseipdb struct{}
+
+func (abuseipdb) Name() string { return "abuseipdb" }
+
+func (a abuseipdb) Check(ctx context.Context, client *http.Client, ip string) (RiskReport, error) {
+	key := apiKey(a.Name())
+	if key == "" {
+		return RiskReport{Score: -1}, ErrNoAPIKey
+	}
+	u := "https://api.abuseipdb.com/api/v2/check?" + url.Values{"ipAddress": {ip}, "maxAgeInDays": {"90"}}.Encode()
+	body, err := get(ctx, client, u, map[string]string{"Key": key, "Accept": "application/json"})
+	if err != nil {
+		return RiskReport{Score: -1}, err
+	}
+	return parseAbuseIPDB(body)
+}
+
+func parseAbuseIPDB(body []byte) (RiskReport, error) {
+	r := RiskReport{Score: -1}
+	var resp struct {
+		Data *struct {
+			AbuseConfidenceScore int    `json:"abuseConfidenceScore"`
+			CountryCode          string `json:"countryCode"`
+			UsageType            string `json:"usageType"`
+			IsTor                bool   `json:"isTor"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return r, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	if resp.Data == nil {
+		return r, fmt.Errorf("响应中没有data字段")
+	}
+	r.Score = resp.Data.AbuseConfidenceScore
+	r.Country = strings.ToUpper(resp.Data.CountryCode)
+	r.IsTor = resp.Data.IsTor
+	r.IsDatacenter = strings.Contains(resp.Data.UsageType, "Data Center")
+	return r, nil
+}
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// AppriseRequest Apprise API 的请求结构
+type AppriseRequest struct {
+	URLs  string `json:"urls"`  // 通知目标的 URL（如 mailto://、discord://），多个以逗号分隔
+	Body  string `json:"body"`  // 通知内容
+	Title string `json:"title"` // 通知标题（可选）
+}
+
+// Apprise 通过 Apprise API 发送通知
+type Apprise struct {
+	Server string
+	URLs   string
+}
+
+func (a *Apprise) Send(ctx context.Context, msg Message) error {
+	if _, err := postJSON(ctx, a.Server, AppriseRequest{URLs: a.URLs, Body: msg.Body, Title: msg.Title}, nil); err != nil {
+		return fmt.Errorf("apprise 通知失败: %w", err)
+	}
+	return nil
+}
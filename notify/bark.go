@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// Bark 推送到 Bark，URL 为包含设备 key 的地址，如 https://api.day.app/<key>
+type Bark struct {
+	URL string
+}
+
+func (b *Bark) Send(ctx context.Context, msg Message) error {
+	data, err := postJSON(ctx, b.URL, map[string]any{
+		"title": msg.Title,
+		"body":  msg.Body,
+		"group": "subcheck",
+	}, nil)
+	if err == nil {
+		err = checkCode(data, "code", 200)
+	}
+	if err != nil {
+		return fmt.Errorf("bark 通知失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DingTalk 钉钉群机器人，URL 为包含 access_token 的 Webhook 地址，Secret 为加签密钥
+type DingTalk struct {
+	URL    string
+	Secret string
+}
+
+func (d *DingTalk) Send(ctx context.Context, msg Message) error {
+	endpoint := d.URL
+	if d.Secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(d.Secret))
+		mac.Write([]byte(ts + "\n" + d.Secret))
+		u, err := url.Parse(d.URL)
+		if err != nil {
+			return fmt.Errorf("dingtalk 地址错误: %w", err)
+		}
+		q := u.Query()
+		q.Set("timestamp", ts)
+		q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		u.RawQuery = q.Encode()
+		endpoint = u.String()
+	}
+	data, err := postJSON(ctx, endpoint, map[string]any{
+		"msgtype": "text",
+		"text":    map[string]string{"content": msg.text()},
+	}, nil)
+	if err == nil {
+		err = checkCode(data, "errcode", 0)
+	}
+	if err != nil {
+		return fmt.Errorf("dingtalk 通知失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Feishu 飞书群机器人，URL 为 Webhook 地址，Secret 为签名校验密钥
+type Feishu struct {
+	URL    string
+	Secret string
+}
+
+func (f *Feishu) Send(ctx context.Context, msg Message) error {
+	payload := map[string]any{
+		"msg_type": "text",
+		"content":  map[string]string{"text": msg.text()},
+	}
+	if f.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		// 飞书以 timestamp + "\n" + secret 作为密钥对空内容签名
+		mac := hmac.New(sha256.New, []byte(ts+"\n"+f.Secret))
+		payload["timestamp"] = ts
+		payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	data, err := postJSON(ctx, f.URL, payload, nil)
+	if err == nil {
+		err = checkCode(data, "code", 0)
+	}
+	if err != nil {
+		return fmt.Errorf("feishu 通知失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/twj0/subcheck/config"
+)
+
+// Message 一条通知
+type Message struct {
+	Event Event
+	Title string
+	Body  string
+	Time  time.Time
+}
+
+// Notifier 通知渠道
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// channel 配置好的通知渠道，keys 为 notify.routes 中可以匹配该渠道的值
+type channel struct {
+	name     string
+	keys     []string
+	notifier Notifier
+	retry    int
+	backoff  time.Duration
+}
+
+// httpClient 通知请求使用的客户端
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// wait 重试前的等待，测试中替换
+var wait = time.Sleep
+
+// newNotifier 根据配置创建通知渠道
+func newNotifier(c config.NotifierConfig) (Notifier, error) {
+	switch strings.ToLower(c.Type) {
+	case "telegram":
+		if c.Token == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("telegram 需要 token 与 chat-id")
+		}
+		return &Telegram{API: defaultURL(c.URL, "https://api.telegram.org"), Token: c.Token, ChatID: c.ChatID}, nil
+	case "webhook":
+		return requireURL(c, &Webhook{URL: c.URL, Secret: c.Secret})
+	case "ntfy":
+		return requireURL(c, &Ntfy{URL: c.URL, Token: c.Token})
+	case "bark":
+		return requireURL(c, &Bark{URL: c.URL})
+	case "serverchan":
+		if c.Token == "" {
+			return nil, fmt.Errorf("serverchan 需要 token(SendKey)")
+		}
+		return &ServerChan{API: defaultURL(c.URL, "https://sctapi.ftqq.com"), Key: c.Token}, nil
+	case "dingtalk":
+		return requireURL(c, &DingTalk{URL: c.URL, Secret: c.Secret})
+	case "wecom":
+		return requireURL(c, &WeCom{URL: c.URL})
+	case "feishu":
+		return requireURL(c, &Feishu{URL: c.URL, Secret: c.Secret})
+	case "apprise":
+		if len(c.Recipients) == 0 {
+			return nil, fmt.Errorf("apprise 需要 recipients")
+		}
+		return requireURL(c, &Apprise{Server: c.URL, URLs: strings.Join(c.Recipients, ",")})
+	}
+	return nil, fmt.Errorf("未知的通知渠道类型 %q", c.Type)
+}
+
+func requireURL(c config.NotifierConfig, n Notifier) (Notifier, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("%s 需要 url", c.Type)
+	}
+	return n, nil
+}
+
+func defaultURL(url, def string) string {
+	if url == "" {
+		return def
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+// channels 根据配置创建所有通知渠道，apprise-api-server 与 recipient-url 中的每个目标作为一个 apprise 渠道
+func channels() []channel {
+	cfg := config.GlobalConfig.Notify
+	var list []channel
+	if server := config.GlobalConfig.AppriseApiServer; server != "" {
+		if len(config.GlobalConfig.RecipientUrl) == 0 {
+			slog.Error("没有配置通知目标")
+		}
+		for _, url := range config.GlobalConfig.RecipientUrl {
+			list = append(list, channel{
+				name:     strings.SplitN(url, "://", 2)[0],
+				keys:     []string{url, strings.SplitN(url, "://", 2)[0]},
+				notifier: &Apprise{Server: server, URLs: url},
+				retry:    cfg.Retry,
+				backoff:  time.Duration(cfg.Backoff) * time.Second,
+			})
+		}
+	}
+	for _, c := range cfg.Channels {
+		n, err := newNotifier(c)
+		if err != nil {
+			slog.Error(fmt.Sprintf("通知渠道 %s 配置错误: %v", defaultStr(c.Name, c.Type), err))
+			continue
+		}
+		ch := channel{
+			name:     defaultStr(c.Name, c.Type),
+			keys:     []string{strings.ToLower(c.Type)},
+			notifier: n,
+			retry:    cfg.Retry,
+			backoff:  time.Duration(cfg.Backoff) * time.Second,
+		}
+		if c.Name != "" {
+			ch.keys = append(ch.keys, c.Name)
+		}
+		if c.Retry > 0 {
+			ch.retry = c.Retry
+		}
+		if c.Backoff > 0 {
+			ch.backoff = time.Duration(c.Backoff) * time.Second
+		}
+		list = append(list, ch)
+	}
+	return list
+}
+
+// send 发送通知，失败后按指数退避重试
+func (c channel) send(msg Message) error {
+	var err error
+	for i := 0; i <= c.retry; i++ {
+		if i > 0 {
+			wait(c.backoff << (i - 1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = c.notifier.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// postJSON 发送 JSON 请求，非 2xx 时返回错误，返回响应内容
+func postJSON(ctx context.Context, url string, payload any, header http.Header) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	return post(ctx, url, body, header)
+}
+
+func post(ctx context.Context, url string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("状态码: %d, 响应: %s", resp.StatusCode, string(data))
+	}
+	return data, nil
+}
+
+// checkCode 检查响应 JSON 中的错误码字段，ok 为成功时的值
+func checkCode(data []byte, field string, ok int) error {
+	var resp map[string]any
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %s", string(data))
+	}
+	if code, _ := resp[field].(float64); int(code) != ok {
+		return fmt.Errorf("响应错误: %s", string(data))
+	}
+	return nil
+}
+
+// text 标题与内容合并为一段文字，用于只支持纯文本的渠道
+func (m Message) text() string {
+	if m.Title == "" {
+		return m.Body
+	}
+	return m.Title + "\n" + m.Body
+}
+
+func defaultStr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
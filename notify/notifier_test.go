@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twj0/subcheck/config"
+)
+
+// captured 渠道发出的请求
+type captured struct {
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+}
+
+func TestNotifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.NotifierConfig // URL 为空时使用测试服务器地址
+		response string
+		check    func(t *testing.T, r captured)
+	}{
+		{
+			name:     "telegram",
+			cfg:      config.NotifierConfig{Type: "telegram", Token: "123:abc", ChatID: "-100"},
+			response: `{"ok":true}`,
+			check: func(t *testing.T, r captured) {
+				var got map[string]any
+				json.Unmarshal(r.body, &got)
+				if r.path != "/bot123:abc/sendMessage" || got["chat_id"] != "-100" || got["text"] != "标题\n内容" {
+					t.Errorf("path %s body %v", r.path, got)
+				}
+			},
+		},
+		{
+			name:     "webhook",
+			cfg:      config.NotifierConfig{Type: "webhook", Secret: "s3cret"},
+			response: `ok`,
+			check: func(t *testing.T, r captured) {
+				var got map[string]any
+				json.Unmarshal(r.body, &got)
+				if got["event"] != "run-finished" || got["body"] != "内容" {
+					t.Errorf("body %v", got)
+				}
+				if sig := r.header.Get(SignatureHeader); sig != Sign("s3cret", r.body) || !strings.HasPrefix(sig, "sha256=") {
+					t.Errorf("signature %q", sig)
+				}
+			},
+		},
+		{
+			name:     "ntfy",
+			cfg:      config.NotifierConfig{Type: "ntfy", Token: "tk"},
+			response: `{}`,
+			check: func(t *testing.T, r captured) {
+				var got map[string]any
+				json.Unmarshal(r.body, &got)
+				if r.path != "/" || got["topic"] != "alerts" || got["title"] != "标题" || r.header.Get("Authorization") != "Bearer tk" {
+					t.Errorf("path %s body %v header %v", r.path, got, r.header)
+				}
+			},
+		},
+		{
+			name:     "bark",
+			cfg:      config.NotifierConfig{Type: "bark"},
+			response: `{"code":200}`,
+			check: func(t *testing.T, r captured) {
+				var got map[string]any
+				json.Unmarshal(r.body, &got)
+				if got["title"] != "标题" || got["body"] != "内容" {
+					t.Errorf("body %v", got)
+				}
+			},
+		},
+		{
+			name:     "serverchan",
+			cfg:      config.NotifierConfig{Type: "serverchan", Token: "SCT1"},
+			response: `{"code":0}`,
+			check: func(t *testing.T, r captured) {
+				form, _ := url.ParseQuery(string(r.body))
+				if r.path != "/SCT1.send" || form.Get("title") != "标题" || form.Get("desp") != "内容" {
+					t.Errorf("path %s form %v", r.path, form)
+				}
+			},
+		},
+		{
+			name:     "dingtalk",
+			cfg:      config.NotifierConfig{Type: "dingtalk", Secret: "SEC"},
+			response: `{"errcode":0}`,
+			check: func(t *testing.T, r captured) {
+				if r.query.Get("access_token") != "x" || r.query.Get("timestamp") == "" || r.query.Get("sign") == "" {
+					t.Errorf("query %v", r.query)
+				}
+				if !strings.Contains(string(r.body), `"msgtype":"text"`) {
+					t.Errorf("body %s", r.body)
+				}
+			},
+		},
+		{
+			name:     "wecom",
+			cfg:      config.NotifierConfig{Type: "wecom"},
+			response: `{"errcode":0}`,
+			check: func(t *testing.T, r captured) {
+				if !strings.Contains(string(r.body), `"content":"标题\n内容"`) {
+					t.Errorf("body %s", r.body)
+				}
+			},
+		},
+		{
+			name:     "feishu",
+			cfg:      config.NotifierConfig{Type: "feishu", Secret: "SEC"},
+			response: `{"code":0}`,
+			check: func(t *testing.T, r captured) {
+				var got map[string]any
+				json.Unmarshal(r.body, &got)
+				if got["msg_type"] != "text" || got["sign"] == nil || got["timestamp"] == nil {
+					t.Errorf("body %v", got)
+				}
+			},
+		},
+		{
+			name:     "apprise",
+			cfg:      config.NotifierConfig{Type: "apprise", Recipients: []string{"tgram://a/b", "mailto://c"}},
+			response: `ok`,
+			check: func(t *testing.T, r captured) {
+				var got AppriseRequest
+				json.Unmarshal(r.body, &got)
+				if got.URLs != "tgram://a/b,mailto://c" || got.Title != "标题" {
+					t.Errorf("body %+v", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got captured
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				got = captured{path: r.URL.Path, query: r.URL.Query(), header: r.Header, body: body}
+				io.WriteString(w, tt.response)
+			}))
+			defer srv.Close()
+
+			cfg := tt.cfg
+			switch cfg.Type {
+			case "telegram", "serverchan", "bark", "webhook", "wecom", "feishu", "apprise":
+				cfg.URL = srv.URL
+			case "ntfy":
+				cfg.URL = srv.URL + "/alerts"
+			case "dingtalk":
+				cfg.URL = srv.URL + "/robot/send?access_token=x"
+			}
+			n, err := newNotifier(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := Message{Event: RunFinished, Title: "标题", Body: "内容", Time: time.Now()}
+			if err := n.Send(t.Context(), msg); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			tt.check(t, got)
+		})
+	}
+}
+
+func TestNotifierErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"ok":false,"code":500,"errcode":40001}`)
+	}))
+	defer srv.Close()
+	for _, typ := range []string{"telegram", "bark", "serverchan", "wecom", "feishu"} {
+		t.Run(typ, func(t *testing.T) {
+			n, err := newNotifier(config.NotifierConfig{Type: typ, URL: srv.URL, Token: "t", ChatID: "c"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := n.Send(t.Context(), Message{Body: "x"}); err == nil {
+				t.Error("error response should fail")
+			}
+		})
+	}
+	if _, err := newNotifier(config.NotifierConfig{Type: "pigeon"}); err == nil {
+		t.Error("unknown type should fail")
+	}
+	if _, err := newNotifier(config.NotifierConfig{Type: "webhook"}); err == nil {
+		t.Error("webhook without url should fail")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	oldWait := wait
+	wait = func(d time.Duration) { waits = append(waits, d) }
+	t.Cleanup(func() { wait = oldWait })
+
+	stub := newAppriseStub(t, config.NotifyConfig{
+		Retry:   1,
+		Backoff: 1,
+		Channels: []config.NotifierConfig{
+			{Name: "hook", Type: "webhook", URL: srv.URL, Retry: 3, Backoff: 2},
+		},
+		Routes: map[string][]string{string(RunFinished): {"hook"}},
+	})
+	Send(RunFinished, Data{Available: 1})
+
+	if calls.Load() != 3 {
+		t.Errorf("webhook called %d times, want 3", calls.Load())
+	}
+	if len(waits) != 2 || waits[0] != 2*time.Second || waits[1] != 4*time.Second {
+		t.Errorf("waits = %v, want [2s 4s]", waits)
+	}
+	if got := stub.received(); len(got) != 0 {
+		t.Errorf("apprise recipients not routed to run-finished should not receive it: %+v", got)
+	}
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/save"
+)
+
+// Event 通知事件
+type Event string
+
+const (
+	RunFinished          Event = "run-finished"          // 检测完成
+	RunFailed            Event = "run-failed"            // 检测失败
+	AvailableLow         Event = "available-low"         // 可用节点低于 notify.min-available
+	SubscriptionExpiring Event = "subscription-expiring" // 订阅在 notify.expire-days 天内到期
+	SubscriptionBroken   Event = "subscription-broken"   // 订阅获取失败、没有节点或节点全部不可用
+	IPQualityDegraded    Event = "ip-quality-degraded"   // 节点IP风险分数升高到低风险阈值以上
+)
+
+// Events 所有通知事件
+var Events = []Event{RunFinished, RunFailed, AvailableLow, SubscriptionExpiring, SubscriptionBroken, IPQualityDegraded}
+
+// Data 通知模板可用的数据
+type Data struct {
+	Event         Event
+	Time          time.Time
+	Duration      time.Duration
+	Total         int // 参与检测的节点数量
+	Available     int
+	MinAvailable  int
+	Error         string
+	Diff          *save.RunDiff // 与上一次检测的差异，首次检测为空
+	Summary       string        // 差异摘要
+	Subscriptions []check.SubResult
+	Affected      []check.SubResult // 触发订阅事件的订阅
+}
+
+// state 记录已通知的状态，订阅异常与可用节点不足只在状态变化时通知，订阅到期每天通知一次
+var state = struct {
+	sync.Mutex
+	broken       map[string]bool
+	expiring     map[string]string
+	availableLow bool
+}{broken: map[string]bool{}, expiring: map[string]string{}}
+
+// SendRun 检测完成后发送 run-finished 及满足条件的其他事件
+func SendRun(d Data) {
+	cfg := config.GlobalConfig.Notify
+	d.MinAvailable = cfg.MinAvailable
+	if d.Diff != nil && d.Summary == "" {
+		d.Summary = d.Diff.Summary()
+	}
+	Send(RunFinished, d)
+
+	state.Lock()
+	low := cfg.MinAvailable > 0 && d.Available < cfg.MinAvailable
+	sendLow := low && !state.availableLow
+	state.availableLow = low
+
+	var expiring, broken []check.SubResult
+	today := d.Time.Format("2006-01-02")
+	for _, s := range d.Subscriptions {
+		if cfg.ExpireDays > 0 && !s.Expire.IsZero() && s.Expire.Sub(d.Time) < time.Duration(cfg.ExpireDays)*24*time.Hour {
+			if state.expiring[s.URL] != today {
+				state.expiring[s.URL] = today
+				expiring = append(expiring, s)
+			}
+		}
+		isBroken := s.Error != "" || s.Nodes == 0 || (s.Checked > 0 && s.Passed == 0)
+		if isBroken && !state.broken[s.URL] {
+			broken = append(broken, s)
+		}
+		state.broken[s.URL] = isBroken
+	}
+	state.Unlock()
+
+	if sendLow {
+		Send(AvailableLow, d)
+	}
+	if len(expiring) > 0 {
+		e := d
+		e.Affected = expiring
+		Send(SubscriptionExpiring, e)
+	}
+	if len(broken) > 0 {
+		e := d
+		e.Affected = broken
+		Send(SubscriptionBroken, e)
+	}
+	if d.Diff != nil && len(d.Diff.Riskier) > 0 {
+		Send(IPQualityDegraded, d)
+	}
+}
+
+// Send 按事件模板渲染通知内容，并发发送到该事件路由的通知渠道，全部完成后返回
+func Send(event Event, d Data) {
+	targets := routed(event, channels())
+	if len(targets) == 0 {
+		return
+	}
+	d.Event = event
+	if d.Time.IsZero() {
+		d.Time = time.Now()
+	}
+	body, err := Render(event, d)
+	if err != nil {
+		// 自定义模板有误时使用默认模板，避免丢失通知
+		slog.Error(fmt.Sprintf("渲染通知模板失败 [%s]，使用默认模板: %v", event, err))
+		if body, err = render(string(event), defaultTemplates[event], d); err != nil {
+			slog.Error(fmt.Sprintf("渲染默认通知模板失败 [%s]: %v", event, err))
+			return
+		}
+	}
+	msg := Message{Event: event, Title: config.GlobalConfig.NotifyTitle, Body: body, Time: d.Time}
+
+	var wg sync.WaitGroup
+	for _, c := range targets {
+		wg.Add(1)
+		go func(c channel) {
+			defer wg.Done()
+			if err := c.send(msg); err != nil {
+				slog.Error(fmt.Sprintf("%s 发送通知失败 [%s]: %v", c.name, event, err))
+				return
+			}
+			slog.Info(fmt.Sprintf("%s 通知发送成功 [%s]", c.name, event))
+		}(c)
+	}
+	wg.Wait()
+}
+
+// routed 事件路由的通知渠道，路由项可以是渠道名称、类型，或 recipient-url 中的完整地址、scheme
+func routed(event Event, all []channel) []channel {
+	routes, ok := config.GlobalConfig.Notify.Routes[string(event)]
+	if !ok {
+		return all
+	}
+	var list []channel
+	for _, c := range all {
+		if slices.ContainsFunc(c.keys, func(k string) bool { return slices.Contains(routes, k) }) {
+			list = append(list, c)
+		}
+	}
+	return list
+}
@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Ntfy 发布到 ntfy 主题，URL 为主题地址，如 https://ntfy.sh/mytopic
+type Ntfy struct {
+	URL   string
+	Token string
+}
+
+func (n *Ntfy) Send(ctx context.Context, msg Message) error {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return fmt.Errorf("ntfy 地址错误: %w", err)
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	topic := path[i+1:]
+	if topic == "" {
+		return fmt.Errorf("ntfy 地址缺少主题: %s", n.URL)
+	}
+	// 使用 JSON 发布，标题可以包含非 ASCII 字符
+	u.Path = "/" + path[:max(i, 0)]
+	header := http.Header{}
+	if n.Token != "" {
+		header.Set("Authorization", "Bearer "+n.Token)
+	}
+	if _, err := postJSON(ctx, u.String(), map[string]any{
+		"topic":   topic,
+		"title":   msg.Title,
+		"message": msg.Body,
+	}, header); err != nil {
+		return fmt.Errorf("ntfy 通知失败: %w", err)
+	}
+	return nil
+}
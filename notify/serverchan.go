@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ServerChan 通过 Server酱 推送，Key 为 SendKey
+type ServerChan struct {
+	API string
+	Key string
+}
+
+func (s *ServerChan) Send(ctx context.Context, msg Message) error {
+	form := url.Values{"title": {msg.Title}, "desp": {msg.Body}}
+	data, err := post(ctx, s.API+"/"+s.Key+".send", []byte(form.Encode()),
+		http.Header{"Content-Type": {"application/x-www-form-urlencoded"}})
+	if err == nil {
+		err = checkCode(data, "code", 0)
+	}
+	if err != nil {
+		return fmt.Errorf("serverchan 通知失败: %w", err)
+	}
+	return nil
+}
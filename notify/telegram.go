@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Telegram 通过 Bot API 发送消息
+type Telegram struct {
+	API    string
+	Token  string
+	ChatID string
+}
+
+func (t *Telegram) Send(ctx context.Context, msg Message) error {
+	data, err := postJSON(ctx, t.API+"/bot"+t.Token+"/sendMessage", map[string]any{
+		"chat_id":                  t.ChatID,
+		"text":                     msg.text(),
+		"disable_web_page_preview": true,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("telegram 通知失败: %w", err)
+	}
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || !resp.OK {
+		return fmt.Errorf("telegram 通知失败: %s", string(data))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/twj0/subcheck/config"
+)
+
+// defaultTemplates 各事件默认的通知内容
+var defaultTemplates = map[Event]string{
+	RunFinished: `✅ 可用节点：{{.Available}}{{if .Total}} / {{.Total}}{{end}}
+🕒 {{date .Time}}{{if .Duration}}  ⏱️ {{.Duration}}{{end}}
+{{- if .Summary}}
+{{.Summary}}{{end}}`,
+	RunFailed: `❌ 检测失败：{{.Error}}
+🕒 {{date .Time}}`,
+	AvailableLow: `⚠️ 可用节点 {{.Available}} 个，低于 {{.MinAvailable}}
+🕒 {{date .Time}}`,
+	SubscriptionExpiring: `⏳ 订阅即将到期
+{{- range .Affected}}
+{{.Name}}：{{.Expire.Format "2006-01-02"}} 到期{{if .Total}}，已用 {{bytes .Used}} / {{bytes .Total}}{{end}}
+{{- end}}`,
+	SubscriptionBroken: `🚫 订阅异常
+{{- range .Affected}}
+{{.Name}}：{{if .Error}}{{.Error}}{{else if eq .Nodes 0}}没有节点{{else}}{{.Checked}} 个节点全部不可用{{end}}
+{{- end}}`,
+	IPQualityDegraded: `⚠️ {{len .Diff.Riskier}} 个节点IP风险升高
+{{- range .Diff.Riskier}}
+{{.Name}}：{{.OldRisk}} → {{.Risk}}
+{{- end}}`,
+}
+
+var funcs = template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"join": strings.Join,
+	"bytes": func(n int64) string {
+		const unit = 1024
+		if n < unit {
+			return fmt.Sprintf("%dB", n)
+		}
+		div, exp := int64(unit), 0
+		for m := n / unit; m >= unit; m /= unit {
+			div *= unit
+			exp++
+		}
+		return fmt.Sprintf("%.2f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+	},
+}
+
+// Render 使用 notify.templates 中的模板渲染事件通知，未配置时使用默认模板
+func Render(event Event, d Data) (string, error) {
+	text, ok := config.GlobalConfig.Notify.Templates[string(event)]
+	if !ok || strings.TrimSpace(text) == "" {
+		text = defaultTemplates[event]
+	}
+	return render(string(event), text, d)
+}
+
+func render(name, text string, d Data) (string, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
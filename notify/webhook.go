@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader 请求体的 HMAC-SHA256 签名，格式为 sha256=<hex>
+const SignatureHeader = "X-Subcheck-Signature"
+
+// Webhook 以 JSON POST 通知内容，配置 Secret 时对请求体签名
+type Webhook struct {
+	URL    string
+	Secret string
+}
+
+func (w *Webhook) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]any{
+		"event": msg.Event,
+		"title": msg.Title,
+		"body":  msg.Body,
+		"time":  msg.Time.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if w.Secret != "" {
+		header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	if _, err := post(ctx, w.URL, body, header); err != nil {
+		return fmt.Errorf("webhook 通知失败: %w", err)
+	}
+	return nil
+}
+
+// Sign 计算请求体的签名，接收方使用相同的密钥计算后比较
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
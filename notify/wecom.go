@@ -0,0 +1,25 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// WeCom 企业微信群机器人，URL 为包含 key 的 Webhook 地址
+type WeCom struct {
+	URL string
+}
+
+func (w *WeCom) Send(ctx context.Context, msg Message) error {
+	data, err := postJSON(ctx, w.URL, map[string]any{
+		"msgtype": "text",
+		"text":    map[string]string{"content": msg.text()},
+	}, nil)
+	if err == nil {
+		err = checkCode(data, "errcode", 0)
+	}
+	if err != nil {
+		return fmt.Errorf("wecom 通知失败: %w", err)
+	}
+	return nil
+}
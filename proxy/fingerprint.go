@@ -0,0 +1,36 @@
+package proxies
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// OriginalNameKey 旧版本在代理map中保存原始名称的键名，数据库中保留的节点可能仍带有该字段
+const OriginalNameKey = "original_name"
+
+// fingerprintIgnore 不影响节点连接的字段，名称会被重命名，sub_* 为订阅来源标记
+var fingerprintIgnore = map[string]bool{
+	"name":          true,
+	OriginalNameKey: true,
+	"sub_url":       true,
+	"sub_tag":       true,
+}
+
+// Fingerprint 根据节点的连接参数生成指纹，名称或来源变化时指纹不变
+// 序列化失败时返回空字符串
+func Fingerprint(proxy map[string]any) string {
+	m := make(map[string]any, len(proxy))
+	for k, v := range proxy {
+		if !fingerprintIgnore[k] {
+			m[k] = v
+		}
+	}
+	// encoding/json 按键排序输出，同样的参数得到同样的结果
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
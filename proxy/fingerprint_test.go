@@ -0,0 +1,30 @@
+package proxies
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	base := map[string]any{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 443, "password": "x", "sub_url": "https://a"}
+	tests := []struct {
+		name  string
+		proxy map[string]any
+		same  bool
+	}{
+		{"renamed", map[string]any{"name": "b|1MB/s", "type": "ss", "server": "1.2.3.4", "port": 443, "password": "x"}, true},
+		{"renamed with original name", map[string]any{"name": "🇯🇵JP_1|1MB/s", OriginalNameKey: "a", "type": "ss", "server": "1.2.3.4", "port": 443, "password": "x"}, true},
+		{"other subscription", map[string]any{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 443, "password": "x", "sub_url": "https://b", "sub_tag": "b"}, true},
+		{"password changed", map[string]any{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 443, "password": "y"}, false},
+		{"port changed", map[string]any{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 8443, "password": "x"}, false},
+		{"option added", map[string]any{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 443, "password": "x", "udp": true}, false},
+	}
+	want := Fingerprint(base)
+	if want == "" {
+		t.Fatal("Fingerprint() is empty")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fingerprint(tt.proxy); (got == want) != tt.same {
+				t.Errorf("Fingerprint() = %s, base %s, want same=%v", got, want, tt.same)
+			}
+		})
+	}
+}
@@ -28,6 +28,8 @@ import (
  */
 func GetProxies() ([]map[string]any, error) {
 
+	resetSubStatuses()
+
 	// 解析本地与远程订阅清单
 	subUrls, localNum, remoteNum := resolveSubUrls()
 	slog.Info("订阅链接数量", "本地", localNum, "远程", remoteNum, "总计", len(subUrls))
@@ -61,11 +63,15 @@ func GetProxies() ([]map[string]any, error) {
 			defer func() { <-concurrentLimit }() // 释放令牌
 
 			// 从订阅链接获取数据
-			data, err := GetDateFromSubs(url)
+			data, header, err := fetchSub(url)
 			if err != nil {
 				slog.Error(fmt.Sprintf("获取订阅链接错误跳过: %v", err))
+				recordSubStatus(url, 0, nil, err)
 				return
 			}
+			var nodes int
+			var parseErr error
+			defer func() { recordSubStatus(url, nodes, header, parseErr) }()
 
 			// 解析订阅链接标签
 			var tag string
@@ -81,6 +87,7 @@ func GetProxies() ([]map[string]any, error) {
 				proxyList, err := convert.ConvertsV2Ray(data)
 				if err != nil {
 					slog.Error(fmt.Sprintf("解析proxy错误: %v", err), "url", url)
+					parseErr = fmt.Errorf("解析订阅失败: %w", err)
 					return
 				}
 				slog.Debug(fmt.Sprintf("获取订阅链接: %s，有效节点数量: %d", url, len(proxyList)))
@@ -97,6 +104,7 @@ func GetProxies() ([]map[string]any, error) {
 					proxy["sub_url"] = url
 					proxy["sub_tag"] = tag
 					proxyChan <- proxy
+					nodes++
 				}
 				return
 			}
@@ -105,11 +113,13 @@ func GetProxies() ([]map[string]any, error) {
 			proxyInterface, ok := con["proxies"]
 			if !ok || proxyInterface == nil {
 				slog.Error(fmt.Sprintf("订阅链接没有proxies: %s", url))
+				parseErr = errors.New("订阅中没有 proxies")
 				return
 			}
 
 			proxyList, ok := proxyInterface.([]any)
 			if !ok {
+				parseErr = errors.New("订阅中的 proxies 格式错误")
 				return
 			}
 			slog.Debug(fmt.Sprintf("获取订阅链接: %s，有效节点数量: %d", url, len(proxyList)))
@@ -135,6 +145,7 @@ func GetProxies() ([]map[string]any, error) {
 					proxyMap["sub_url"] = url
 					proxyMap["sub_tag"] = tag
 					proxyChan <- proxyMap
+					nodes++
 				}
 			}
 		}(utils.WarpUrl(subUrl))
@@ -233,6 +244,12 @@ func fetchRemoteSubUrls(listURL string) ([]string, error) {
 
 // 订阅链接中获取数据
 func GetDateFromSubs(subUrl string) ([]byte, error) {
+	data, _, err := fetchSub(subUrl)
+	return data, err
+}
+
+// fetchSub 获取订阅内容，同时返回响应头，用于读取 subscription-userinfo
+func fetchSub(subUrl string) ([]byte, http.Header, error) {
 	maxRetries := config.GlobalConfig.SubUrlsReTry
 	// 重试间隔
 	retryInterval := config.GlobalConfig.SubUrlsRetryInterval
@@ -294,8 +311,8 @@ func GetDateFromSubs(subUrl string) ([]byte, error) {
 			lastErr = fmt.Errorf("读取订阅链接: %s 数据错误: %v", subUrl, err)
 			continue
 		}
-		return body, nil
+		return body, resp.Header, nil
 	}
 
-	return nil, fmt.Errorf("重试%d次后失败: %v", maxRetries, lastErr)
+	return nil, nil, fmt.Errorf("重试%d次后失败: %v", maxRetries, lastErr)
 }
@@ -1,202 +1,357 @@
 package proxies
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"log/slog"
 
 	"github.com/metacubex/mihomo/common/convert"
 	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/geoip"
 )
 
-func GetProxyCountry(httpClient *http.Client) (loc string, ip string) {
+// IPInfo 节点出口信息
+type IPInfo struct {
+	IP      string
+	Country string
+	City    string
+	ASN     string
+	ISP     string
+}
+
+// ProviderStat 出口IP查询接口的成功/失败统计
+type ProviderStat struct {
+	Name    string  `json:"name"`
+	URL     string  `json:"url"`
+	Success int64   `json:"success"`
+	Failure int64   `json:"failure"`
+	Rate    float64 `json:"rate"`
+}
+
+type providerCounter struct {
+	success atomic.Int64
+	failure atomic.Int64
+}
+
+var (
+	providerStatsLock sync.Mutex
+	providerStats     = make(map[string]*providerCounter)
+)
+
+// GetProxyInfo 获取节点出口IP与位置信息
+// 启用离线GeoIP数据库时，国家/城市/ASN由本地数据库补全，接口链只需要成功一次拿到出口IP
+func GetProxyInfo(httpClient *http.Client) IPInfo {
+	var info IPInfo
 	for i := 0; i < config.GlobalConfig.SubUrlsReTry; i++ {
-		loc, ip = GetMe(httpClient)
-		if loc != "" && ip != "" {
-			return
-		}
-		loc, ip = GetIPLark(httpClient)
-		if loc != "" && ip != "" {
-			return
-		}
-		loc, ip = GetCFProxy(httpClient)
-		if loc != "" && ip != "" {
-			return
-		}
-		// 不准
-		loc, ip = GetEdgeOneProxy(httpClient)
-		if loc != "" && ip != "" {
-			return
+		info = lookupChain(httpClient)
+		if info.IP != "" && (info.Country != "" || geoip.Enabled()) {
+			break
 		}
 	}
-	return
+	fillGeo(&info)
+	return info
 }
 
-func GetEdgeOneProxy(httpClient *http.Client) (loc string, ip string) {
-	type GeoResponse struct {
-		Eo struct {
-			Geo struct {
-				CountryCodeAlpha2 string `json:"countryCodeAlpha2"`
-			} `json:"geo"`
-			ClientIp string `json:"clientIp"`
-		} `json:"eo"`
-	}
-
-	url := "https://functions-geolocation.edgeone.app/geo"
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("创建请求失败: %s", err))
+// fillGeo 启用离线GeoIP数据库时以本地数据库的结果为准
+func fillGeo(info *IPInfo) {
+	if info.IP == "" || !geoip.Enabled() {
 		return
 	}
-	req.Header.Set("User-Agent", convert.RandUserAgent())
-	resp, err := httpClient.Get(url)
+	geo, err := geoip.Lookup(info.IP)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("edgeone获取节点位置失败: %s", err))
+		slog.Debug(fmt.Sprintf("GeoIP查询失败: %v", err))
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		slog.Debug(fmt.Sprintf("edgeone返回非200状态码: %v", resp.StatusCode))
-		return
+	if geo.Country != "" {
+		info.Country = geo.Country
 	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("edgeone读取节点位置失败: %s", err))
-		return
+	if geo.City != "" {
+		info.City = geo.City
 	}
-
-	var eo GeoResponse
-	err = json.Unmarshal(body, &eo)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("解析edgeone JSON 失败: %v", err))
-		return
+	if geo.ASN != "" {
+		info.ASN, info.ISP = geo.ASN, geo.ISP
 	}
+}
 
-	return eo.Eo.Geo.CountryCodeAlpha2, eo.Eo.ClientIp
+func GetProxyCountry(httpClient *http.Client) (loc string, ip string) {
+	info := GetProxyInfo(httpClient)
+	return info.Country, info.IP
 }
 
-func GetCFProxy(httpClient *http.Client) (loc string, ip string) {
-	url := "https://www.cloudflare.com/cdn-cgi/trace"
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("创建请求失败: %s", err))
-		return
-	}
-	req.Header.Set("User-Agent", convert.RandUserAgent())
-	resp, err := httpClient.Get(url)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("cf获取节点位置失败: %s", err))
-		return
-	}
-	defer resp.Body.Close()
+// 节点出口的IP栈类型
+const (
+	StackV4   = "v4"
+	StackV6   = "v6"
+	StackDual = "dual"
+)
 
-	if resp.StatusCode != http.StatusOK {
-		slog.Debug(fmt.Sprintf("cf返回非200状态码: %v", resp.StatusCode))
-		return
+// StackInfo 双栈检测结果，对应的栈不通时IP为空
+type StackInfo struct {
+	IPv4 IPInfo
+	IPv6 IPInfo
+}
+
+// Stack 返回 v4/v6/dual，两个栈都不通时返回空
+func (s StackInfo) Stack() string {
+	switch {
+	case s.IPv4.IP != "" && s.IPv6.IP != "":
+		return StackDual
+	case s.IPv4.IP != "":
+		return StackV4
+	case s.IPv6.IP != "":
+		return StackV6
 	}
+	return ""
+}
 
-	body, err := io.ReadAll(resp.Body)
+// GetProxyStack 分别请求只有IPv4、只有IPv6地址的接口，探测节点的双栈出口
+func GetProxyStack(httpClient *http.Client) StackInfo {
+	var (
+		s  StackInfo
+		wg sync.WaitGroup
+	)
+	cfg := config.GlobalConfig.IPStack
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.IPv4 = probeStack(httpClient, cfg.IPv4, false)
+	}()
+	go func() {
+		defer wg.Done()
+		s.IPv6 = probeStack(httpClient, cfg.IPv6, true)
+	}()
+	wg.Wait()
+	return s
+}
+
+// probeStack 请求单栈接口，返回的IP与期望的地址族不符时视为失败
+func probeStack(httpClient *http.Client, p config.IPProviderConfig, v6 bool) IPInfo {
+	if p.URL == "" {
+		return IPInfo{}
+	}
+	info, err := LookupProvider(httpClient, p)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("cf读取节点位置失败: %s", err))
-		return
+		slog.Debug(fmt.Sprintf("%s出口探测失败: %v", providerName(p), err))
+		return IPInfo{}
+	}
+	addr, err := netip.ParseAddr(info.IP)
+	if err != nil || addr.Unmap().Is4() == v6 {
+		return IPInfo{}
 	}
+	info.IP = addr.Unmap().String()
+	fillGeo(&info)
+	return info
+}
 
-	// Parse the response text to find loc=XX
-	for _, line := range strings.Split(string(body), "\n") {
-		if strings.HasPrefix(line, "loc=") {
-			loc = strings.TrimPrefix(line, "loc=")
-		}
-		if strings.HasPrefix(line, "ip=") {
-			ip = strings.TrimPrefix(line, "ip=")
+// lookupChain 按成功率从高到低依次请求出口IP查询接口，直到拿到结果
+func lookupChain(httpClient *http.Client) IPInfo {
+	needCountry := !geoip.Enabled()
+	for _, p := range OrderedProviders() {
+		info, err := LookupProvider(httpClient, p)
+		counter := providerCounterFor(p)
+		if err != nil || info.IP == "" || (needCountry && info.Country == "") {
+			counter.failure.Add(1)
+			if err != nil {
+				slog.Debug(fmt.Sprintf("%s获取节点位置失败: %v", p.Name, err))
+			}
+			continue
 		}
+		counter.success.Add(1)
+		return info
 	}
-	return
+	return IPInfo{}
 }
 
-func GetIPLark(httpClient *http.Client) (loc string, ip string) {
-	type GeoIPData struct {
-		IP      string `json:"ip"`
-		Country string `json:"country_code"`
+// LookupProvider 请求单个出口IP查询接口并按配置提取字段
+func LookupProvider(httpClient *http.Client, p config.IPProviderConfig) (IPInfo, error) {
+	var info IPInfo
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.Timeout)*time.Millisecond)
+		defer cancel()
 	}
-
-	url := string([]byte{104, 116, 116, 112, 115, 58, 47, 47, 102, 51, 98, 99, 97, 48, 101, 50, 56, 101, 54, 98, 46, 97, 97, 112, 113, 46, 110, 101, 116, 47, 105, 112, 97, 112, 105, 47, 105, 112, 99, 97, 116})
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", p.URL, nil)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("创建请求失败: %s", err))
-		return
+		return info, fmt.Errorf("创建请求失败: %w", err)
+	}
+	switch p.UA {
+	case "":
+		req.Header.Set("User-Agent", "subs-check (https://github.com/twj0/subcheck)")
+	case "random":
+		req.Header.Set("User-Agent", convert.RandUserAgent())
+	default:
+		req.Header.Set("User-Agent", p.UA)
 	}
-	req.Header.Set("User-Agent", "curl/8.7.1")
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("iplark获取节点位置失败: %s", err))
-		return
+		return info, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		slog.Debug(fmt.Sprintf("iplark返回非200状态码: %v", resp.StatusCode))
-		return
+		return info, fmt.Errorf("返回非200状态码: %v", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		slog.Debug(fmt.Sprintf("iplark读取节点位置失败: %s", err))
-		return
+		return info, fmt.Errorf("读取响应失败: %w", err)
 	}
 
-	var geo GeoIPData
-	err = json.Unmarshal(body, &geo)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("解析iplark JSON 失败: %v", err))
-		return
+	var get func(key string) string
+	switch strings.ToLower(p.Format) {
+	case "trace":
+		kv := parseTrace(body)
+		get = func(key string) string { return kv[key] }
+	default:
+		var data any
+		if err := json.Unmarshal(body, &data); err != nil {
+			return info, fmt.Errorf("解析JSON失败: %w", err)
+		}
+		get = func(path string) string { return jsonPath(data, path) }
 	}
 
-	return geo.Country, geo.IP
+	field := func(name string) string {
+		if key := p.Fields[name]; key != "" {
+			return strings.TrimSpace(get(key))
+		}
+		return ""
+	}
+	info.IP = field("ip")
+	info.Country = strings.ToUpper(field("country"))
+	info.City = field("city")
+	info.ASN = field("asn")
+	info.ISP = field("isp")
+	// 部分接口返回纯数字的ASN
+	if info.ASN != "" && !strings.HasPrefix(strings.ToUpper(info.ASN), "AS") {
+		info.ASN = "AS" + info.ASN
+	}
+	return info, nil
 }
 
-func GetMe(httpClient *http.Client) (loc string, ip string) {
-	type GeoIPData struct {
-		IP      string `json:"ip"`
-		Country string `json:"country_code"`
+// parseTrace 解析 key=value 按行分隔的文本，如 cloudflare 的 /cdn-cgi/trace
+func parseTrace(body []byte) map[string]string {
+	kv := make(map[string]string)
+	for _, line := range strings.Split(string(body), "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok {
+			kv[k] = v
+		}
 	}
+	return kv
+}
 
-	url := "https://ip.122911.xyz/api/ipinfo"
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("创建请求失败: %s", err))
-		return
+// jsonPath 按 a.b.0.c 的路径取JSON中的值，数字段作为数组下标
+func jsonPath(data any, path string) string {
+	cur := data
+	for _, seg := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			cur = v[seg]
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(v) {
+				return ""
+			}
+			cur = v[i]
+		default:
+			return ""
+		}
 	}
-	req.Header.Set("User-Agent", "subs-check (https://github.com/twj0/subcheck)")
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("me获取节点位置失败: %s", err))
-		return
+	switch v := cur.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
 	}
-	defer resp.Body.Close()
+	return ""
+}
 
-	if resp.StatusCode != http.StatusOK {
-		slog.Debug(fmt.Sprintf("me返回非200状态码: %v", resp.StatusCode))
-		return
+// providerName 未配置名称时使用接口域名
+func providerName(p config.IPProviderConfig) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	if u, err := url.Parse(p.URL); err == nil && u.Host != "" {
+		return u.Host
 	}
+	return p.URL
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("me读取节点位置失败: %s", err))
-		return
+func providerCounterFor(p config.IPProviderConfig) *providerCounter {
+	providerStatsLock.Lock()
+	defer providerStatsLock.Unlock()
+
+	key := providerName(p)
+	c, ok := providerStats[key]
+	if !ok {
+		c = &providerCounter{}
+		providerStats[key] = c
 	}
+	return c
+}
 
-	var geo GeoIPData
-	err = json.Unmarshal(body, &geo)
-	if err != nil {
-		slog.Debug(fmt.Sprintf("解析me JSON 失败: %v", err))
-		return
+// successRate 平滑后的成功率，没有样本的接口为0.5，避免新接口一直排在最后
+func (c *providerCounter) successRate() float64 {
+	s, f := c.success.Load(), c.failure.Load()
+	return float64(s+1) / float64(s+f+2)
+}
+
+// OrderedProviders 返回按成功率排序后的接口列表，成功率相同时保持配置顺序
+func OrderedProviders() []config.IPProviderConfig {
+	providers := make([]config.IPProviderConfig, 0, len(config.GlobalConfig.IPProviders))
+	for _, p := range config.GlobalConfig.IPProviders {
+		if p.URL == "" {
+			continue
+		}
+		p.Name = providerName(p)
+		providers = append(providers, p)
+	}
+	rates := make(map[string]float64, len(providers))
+	for _, p := range providers {
+		rates[p.Name] = providerCounterFor(p).successRate()
 	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		return rates[providers[i].Name] > rates[providers[j].Name]
+	})
+	return providers
+}
+
+// GetProviderStats 返回当前排序下各接口的统计
+func GetProviderStats() []ProviderStat {
+	providers := OrderedProviders()
+	out := make([]ProviderStat, 0, len(providers))
+	for _, p := range providers {
+		c := providerCounterFor(p)
+		out = append(out, ProviderStat{
+			Name:    p.Name,
+			URL:     p.URL,
+			Success: c.success.Load(),
+			Failure: c.failure.Load(),
+			Rate:    c.successRate(),
+		})
+	}
+	return out
+}
+
+// ResetProviderStats 清空接口统计
+func ResetProviderStats() {
+	providerStatsLock.Lock()
+	defer providerStatsLock.Unlock()
 
-	return geo.Country, geo.IP
+	providerStats = make(map[string]*providerCounter)
 }
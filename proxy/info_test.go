@@ -0,0 +1,155 @@
+package proxies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/twj0/subcheck/config"
+)
+
+// newFixtureServer 使用 testdata 中的文件模拟出口IP查询接口，/fail 返回500
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", filepath.Base(r.URL.Path)))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLookupProvider(t *testing.T) {
+	srv := newFixtureServer(t)
+
+	tests := []struct {
+		name     string
+		provider config.IPProviderConfig
+		want     IPInfo
+		wantErr  bool
+	}{
+		{
+			name: "json nested path",
+			provider: config.IPProviderConfig{
+				URL:    srv.URL + "/edgeone.json",
+				Format: "json",
+				Fields: map[string]string{"ip": "eo.clientIp", "country": "eo.geo.countryCodeAlpha2", "city": "eo.geo.cityName"},
+			},
+			want: IPInfo{IP: "198.51.100.23", Country: "US", City: "Ashburn"},
+		},
+		{
+			name: "json asn without prefix",
+			provider: config.IPProviderConfig{
+				URL:    srv.URL + "/ipinfo.json",
+				Format: "json",
+				Fields: map[string]string{"ip": "ip", "country": "country_code", "asn": "asn.asn", "isp": "asn.name"},
+			},
+			want: IPInfo{IP: "203.0.113.7", Country: "JP", ASN: "AS2516", ISP: "KDDI"},
+		},
+		{
+			name: "trace",
+			provider: config.IPProviderConfig{
+				URL:    srv.URL + "/trace.txt",
+				Format: "trace",
+				Fields: map[string]string{"ip": "ip", "country": "loc"},
+			},
+			want: IPInfo{IP: "2001:db8::1", Country: "SG"},
+		},
+		{
+			name: "bad status",
+			provider: config.IPProviderConfig{
+				URL:    srv.URL + "/fail",
+				Format: "json",
+				Fields: map[string]string{"ip": "ip"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid json",
+			provider: config.IPProviderConfig{
+				URL:    srv.URL + "/trace.txt",
+				Format: "json",
+				Fields: map[string]string{"ip": "ip"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LookupProvider(srv.Client(), tt.provider)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LookupProvider() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderChainReorder(t *testing.T) {
+	srv := newFixtureServer(t)
+	ResetProviderStats()
+	t.Cleanup(ResetProviderStats)
+
+	old := *config.GlobalConfig
+	t.Cleanup(func() { *config.GlobalConfig = old })
+	config.GlobalConfig.SubUrlsReTry = 1
+	config.GlobalConfig.IPProviders = []config.IPProviderConfig{
+		{Name: "broken", URL: srv.URL + "/fail", Format: "json", Fields: map[string]string{"ip": "ip", "country": "country_code"}},
+		{Name: "trace", URL: srv.URL + "/trace.txt", Format: "trace", Fields: map[string]string{"ip": "ip", "country": "loc"}},
+	}
+
+	if got := OrderedProviders()[0].Name; got != "broken" {
+		t.Fatalf("without samples the configured order should be kept, first = %s", got)
+	}
+
+	loc, ip := GetProxyCountry(srv.Client())
+	if loc != "SG" || ip != "2001:db8::1" {
+		t.Fatalf("GetProxyCountry() = %s, %s; want SG, 2001:db8::1", loc, ip)
+	}
+
+	if got := OrderedProviders()[0].Name; got != "trace" {
+		t.Errorf("the reliable provider should move first, first = %s", got)
+	}
+
+	stats := GetProviderStats()
+	if len(stats) != 2 || stats[0].Success != 1 || stats[1].Failure != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestGetProxyStack(t *testing.T) {
+	srv := newFixtureServer(t)
+
+	old := *config.GlobalConfig
+	t.Cleanup(func() { *config.GlobalConfig = old })
+	trace := config.IPProviderConfig{URL: srv.URL + "/trace.txt", Format: "trace", Fields: map[string]string{"ip": "ip", "country": "loc"}}
+	config.GlobalConfig.IPStack = config.IPStackConfig{Enabled: true, IPv4: trace, IPv6: trace}
+
+	// trace.txt 返回的是IPv6地址，IPv4探测应视为失败
+	s := GetProxyStack(srv.Client())
+	if s.IPv4.IP != "" {
+		t.Errorf("IPv4 probe should reject an IPv6 exit, got %s", s.IPv4.IP)
+	}
+	if s.IPv6.IP != "2001:db8::1" || s.IPv6.Country != "SG" {
+		t.Errorf("IPv6 = %+v", s.IPv6)
+	}
+	if got := s.Stack(); got != StackV6 {
+		t.Errorf("Stack() = %q, want %q", got, StackV6)
+	}
+
+	if got := (StackInfo{IPv4: IPInfo{IP: "203.0.113.7"}, IPv6: IPInfo{IP: "2001:db8::1"}}).Stack(); got != StackDual {
+		t.Errorf("Stack() = %q, want %q", got, StackDual)
+	}
+}
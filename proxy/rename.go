@@ -11,12 +11,21 @@ var (
 )
 
 func Rename(name string) string {
+	return RenameIndex(name, NextIndex(name))
+}
+
+// RenameIndex 使用已经取得的序号生成名称，不再递增计数器
+func RenameIndex(name string, index int) string {
+	return CountryCodeToFlag(name) + name + "_" + strconv.Itoa(index)
+}
+
+// NextIndex 返回指定国家的下一个序号，从 1 开始
+func NextIndex(name string) int {
 	counterLock.Lock()
 	defer counterLock.Unlock()
 
 	counter[name]++
-	return CountryCodeToFlag(name) + name + "_" + strconv.Itoa(counter[name])
-
+	return counter[name]
 }
 
 // ResetRenameCounter 将所有计数器重置为 0
@@ -0,0 +1,101 @@
+package proxies
+
+import (
+	"net/http"
+	u "net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubStatus 最近一次获取订阅的结果
+type SubStatus struct {
+	URL   string
+	Name  string // 订阅链接的 #标签，没有时为域名
+	Nodes int    // 解析出的节点数量
+	Error string // 获取或解析失败的原因
+	// 以下来自订阅响应的 subscription-userinfo 头，未提供时为零值
+	Upload   int64
+	Download int64
+	Total    int64
+	Expire   time.Time
+}
+
+var (
+	subStatusMu sync.Mutex
+	subStatuses map[string]*SubStatus
+)
+
+// SubStatuses 返回最近一次获取订阅的结果，按 URL 排序
+func SubStatuses() []SubStatus {
+	subStatusMu.Lock()
+	defer subStatusMu.Unlock()
+	list := make([]SubStatus, 0, len(subStatuses))
+	for _, s := range subStatuses {
+		list = append(list, *s)
+	}
+	slices.SortFunc(list, func(a, b SubStatus) int { return strings.Compare(a.URL, b.URL) })
+	return list
+}
+
+func resetSubStatuses() {
+	subStatusMu.Lock()
+	subStatuses = make(map[string]*SubStatus)
+	subStatusMu.Unlock()
+}
+
+// recordSubStatus 记录订阅的获取结果，err 不为空时表示获取或解析失败
+func recordSubStatus(url string, nodes int, header http.Header, err error) {
+	s := &SubStatus{URL: url, Nodes: nodes}
+	if d, perr := u.Parse(url); perr == nil {
+		s.Name = d.Fragment
+		if s.Name == "" {
+			s.Name = d.Hostname()
+		}
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if header != nil {
+		parseUserinfo(header.Get("subscription-userinfo"), s)
+	}
+	subStatusMu.Lock()
+	if subStatuses == nil {
+		subStatuses = make(map[string]*SubStatus)
+	}
+	subStatuses[url] = s
+	subStatusMu.Unlock()
+}
+
+// parseUserinfo 解析 subscription-userinfo 头，如 upload=1; download=2; total=3; expire=1700000000
+func parseUserinfo(v string, s *SubStatus) {
+	for _, part := range strings.Split(v, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "upload":
+			s.Upload = n
+		case "download":
+			s.Download = n
+		case "total":
+			s.Total = n
+		case "expire":
+			if n > 0 {
+				s.Expire = time.Unix(n, 0)
+			}
+		}
+	}
+}
+
+// Used 已用流量
+func (s SubStatus) Used() int64 {
+	return s.Upload + s.Download
+}
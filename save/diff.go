@@ -0,0 +1,214 @@
+package save
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	proxyutils "github.com/twj0/subcheck/proxy"
+)
+
+// speedChangePercent 速度变化超过该百分比才视为变快或变慢
+const speedChangePercent = 30
+
+// NodeState 一次检测中节点的摘要，用于与下一次检测比较
+type NodeState struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type,omitempty"`
+	Country string   `json:"country,omitempty"`
+	Speed   int      `json:"speed,omitempty"`   // KB/s
+	Latency int      `json:"latency,omitempty"` // 毫秒
+	Risk    *int     `json:"risk,omitempty"`    // IP风险分数，没有检测结果时为空
+	Unlocks []string `json:"unlocks,omitempty"`
+}
+
+// NodeChange 节点在两次检测之间的变化
+type NodeChange struct {
+	Fingerprint string   `json:"fingerprint"`
+	Name        string   `json:"name"`
+	OldName     string   `json:"oldName,omitempty"`
+	OldSpeed    int      `json:"oldSpeed,omitempty"`
+	Speed       int      `json:"speed,omitempty"`
+	OldRisk     int      `json:"oldRisk,omitempty"`
+	Risk        int      `json:"risk,omitempty"`
+	Platforms   []string `json:"platforms,omitempty"` // 新解锁或失去解锁的平台
+}
+
+// RunDiff 与上一次检测的差异，节点按指纹对应
+type RunDiff struct {
+	Added    []NodeChange `json:"added"`
+	Removed  []NodeChange `json:"removed"`
+	Renamed  []NodeChange `json:"renamed"`
+	Faster   []NodeChange `json:"faster"`
+	Slower   []NodeChange `json:"slower"`
+	Unlocked []NodeChange `json:"unlocked"`
+	Locked   []NodeChange `json:"locked"`
+	Riskier  []NodeChange `json:"riskier"` // IP风险分数升高到低风险阈值(auto-groups.low-risk-max)以上的节点
+}
+
+// Snapshot 按指纹汇总本次检测结果
+func Snapshot(results []check.Result) map[string]NodeState {
+	snap := make(map[string]NodeState, len(results))
+	for _, r := range results {
+		if r.Proxy == nil {
+			continue
+		}
+		fp := r.Fingerprint
+		if fp == "" {
+			fp = proxyutils.Fingerprint(r.Proxy)
+		}
+		snap[fp] = nodeState(r)
+	}
+	return snap
+}
+
+// TopNodes 按速度排序的前 n 个节点
+func TopNodes(results []check.Result, n int) []NodeState {
+	sorted := slices.Clone(results)
+	less, _ := ParseSort("speed")
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	var list []NodeState
+	for _, r := range sorted {
+		if len(list) >= n {
+			break
+		}
+		if r.Proxy != nil {
+			list = append(list, nodeState(r))
+		}
+	}
+	return list
+}
+
+func nodeState(r check.Result) NodeState {
+	s := NodeState{
+		Name:    proxyString(r, "name"),
+		Type:    proxyString(r, "type"),
+		Country: r.Country,
+		Speed:   r.SpeedKBps,
+		Latency: r.Latency,
+	}
+	if score := riskScore(r); score >= 0 {
+		s.Risk = &score
+	}
+	for _, p := range platformFields {
+		if truthy(filterFields[p](r)) {
+			s.Unlocks = append(s.Unlocks, p)
+		}
+	}
+	return s
+}
+
+// DiffSnapshots 比较两次检测的快照
+func DiffSnapshots(prev, cur map[string]NodeState) *RunDiff {
+	d := &RunDiff{}
+	lowRiskMax := config.GlobalConfig.AutoGroups.LowRiskMax
+	for fp, c := range cur {
+		p, ok := prev[fp]
+		if !ok {
+			d.Added = append(d.Added, NodeChange{Fingerprint: fp, Name: c.Name, Speed: c.Speed})
+			continue
+		}
+		if p.Name != c.Name {
+			d.Renamed = append(d.Renamed, NodeChange{Fingerprint: fp, Name: c.Name, OldName: p.Name})
+		}
+		// 未测速时速度为 0，不参与比较
+		if p.Speed > 0 && c.Speed > 0 {
+			change := NodeChange{Fingerprint: fp, Name: c.Name, OldSpeed: p.Speed, Speed: c.Speed}
+			switch delta := (c.Speed - p.Speed) * 100 / p.Speed; {
+			case delta >= speedChangePercent:
+				d.Faster = append(d.Faster, change)
+			case delta <= -speedChangePercent:
+				d.Slower = append(d.Slower, change)
+			}
+		}
+		if gained := missing(c.Unlocks, p.Unlocks); len(gained) > 0 {
+			d.Unlocked = append(d.Unlocked, NodeChange{Fingerprint: fp, Name: c.Name, Platforms: gained})
+		}
+		if lost := missing(p.Unlocks, c.Unlocks); len(lost) > 0 {
+			d.Locked = append(d.Locked, NodeChange{Fingerprint: fp, Name: c.Name, Platforms: lost})
+		}
+		if p.Risk != nil && c.Risk != nil && *p.Risk <= lowRiskMax && *c.Risk > lowRiskMax {
+			d.Riskier = append(d.Riskier, NodeChange{Fingerprint: fp, Name: c.Name, OldRisk: *p.Risk, Risk: *c.Risk})
+		}
+	}
+	for fp, p := range prev {
+		if _, ok := cur[fp]; !ok {
+			d.Removed = append(d.Removed, NodeChange{Fingerprint: fp, Name: p.Name, OldSpeed: p.Speed})
+		}
+	}
+	for _, list := range []*[]NodeChange{&d.Added, &d.Removed, &d.Renamed, &d.Faster, &d.Slower, &d.Unlocked, &d.Locked, &d.Riskier} {
+		slices.SortFunc(*list, func(a, b NodeChange) int { return strings.Compare(a.Name, b.Name) })
+	}
+	return d
+}
+
+// missing 返回在 a 中但不在 b 中的元素
+func missing(a, b []string) []string {
+	var out []string
+	for _, s := range a {
+		if !slices.Contains(b, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Empty 两次检测之间没有变化
+func (d *RunDiff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Renamed)+len(d.Faster)+len(d.Slower)+len(d.Unlocked)+len(d.Locked)+len(d.Riskier) == 0
+}
+
+// Summary 差异的简短文字摘要，用于通知
+func (d *RunDiff) Summary() string {
+	if d.Empty() {
+		return "与上次检测相比无变化"
+	}
+	var lines []string
+	if line := counts("➕ 新增 %d", len(d.Added), "➖ 移除 %d", len(d.Removed), "✏️ 改名 %d", len(d.Renamed)); line != "" {
+		lines = append(lines, line)
+	}
+	if line := counts("⚡ 变快 %d", len(d.Faster), "🐢 变慢 %d", len(d.Slower)); line != "" {
+		lines = append(lines, line)
+	}
+	if len(d.Unlocked) > 0 {
+		lines = append(lines, "🔓 新解锁 "+platformCounts(d.Unlocked))
+	}
+	if len(d.Locked) > 0 {
+		lines = append(lines, "🔒 失去解锁 "+platformCounts(d.Locked))
+	}
+	if len(d.Riskier) > 0 {
+		lines = append(lines, fmt.Sprintf("⚠️ IP风险升高 %d", len(d.Riskier)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// counts 按 格式, 数量 成对输入，只输出数量不为 0 的项
+func counts(pairs ...any) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if n := pairs[i+1].(int); n > 0 {
+			parts = append(parts, fmt.Sprintf(pairs[i].(string), n))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// platformCounts 统计每个平台涉及的节点数量，按 platformFields 的顺序输出
+func platformCounts(changes []NodeChange) string {
+	n := make(map[string]int)
+	for _, c := range changes {
+		for _, p := range c.Platforms {
+			n[p]++
+		}
+	}
+	var parts []string
+	for _, p := range platformFields {
+		if n[p] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", p, n[p]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,93 @@
+package save
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	proxyutils "github.com/twj0/subcheck/proxy"
+)
+
+func TestSnapshot(t *testing.T) {
+	snap := Snapshot([]check.Result{
+		{Proxy: map[string]any{"name": "a"}, Fingerprint: "fa", Country: "JP", SpeedKBps: 100, Netflix: true, Youtube: "JP", IPRisk: "0%"},
+		{Proxy: map[string]any{"name": "b", "server": "1.1.1.1"}},
+		{},
+	})
+	if len(snap) != 2 {
+		t.Fatalf("snapshot = %+v, want 2 nodes", snap)
+	}
+	zero := 0
+	want := NodeState{Name: "a", Country: "JP", Speed: 100, Risk: &zero, Unlocks: []string{"netflix", "youtube"}}
+	if !reflect.DeepEqual(snap["fa"], want) {
+		t.Errorf("snapshot[fa] = %+v, want %+v", snap["fa"], want)
+	}
+	b, ok := snap[proxyutils.Fingerprint(map[string]any{"server": "1.1.1.1"})]
+	if !ok || b.Name != "b" || b.Risk != nil {
+		t.Errorf("node without fingerprint = %+v, %v, want keyed by its connection fingerprint without risk", b, ok)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	old := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = old })
+	config.GlobalConfig = &config.Config{AutoGroups: config.AutoGroupsConfig{LowRiskMax: 30}}
+	risk := func(n int) *int { return &n }
+
+	prev := map[string]NodeState{
+		"kept":    {Name: "kept", Speed: 1000, Risk: risk(10), Unlocks: []string{"netflix"}},
+		"renamed": {Name: "old", Speed: 1000, Risk: risk(40)},
+		"slower":  {Name: "slower", Speed: 1000, Unlocks: []string{"openai", "netflix"}},
+		"gone":    {Name: "gone", Speed: 500},
+		"untimed": {Name: "untimed"},
+	}
+	cur := map[string]NodeState{
+		"kept":    {Name: "kept", Speed: 1200, Risk: risk(31), Unlocks: []string{"netflix"}},
+		"renamed": {Name: "new", Speed: 2000, Risk: risk(90), Unlocks: []string{"disney"}},
+		"slower":  {Name: "slower", Speed: 500, Unlocks: []string{"netflix"}},
+		"new":     {Name: "fresh", Speed: 300},
+		"untimed": {Name: "untimed", Speed: 800},
+	}
+	d := DiffSnapshots(prev, cur)
+
+	names := func(list []NodeChange) []string {
+		var out []string
+		for _, c := range list {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		got  []NodeChange
+		want []string
+	}{
+		{"added", d.Added, []string{"fresh"}},
+		{"removed", d.Removed, []string{"gone"}},
+		{"renamed", d.Renamed, []string{"new"}},
+		{"faster", d.Faster, []string{"new"}},
+		{"slower", d.Slower, []string{"slower"}},
+		{"unlocked", d.Unlocked, []string{"new"}},
+		{"locked", d.Locked, []string{"slower"}},
+		{"riskier", d.Riskier, []string{"kept"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(tt.got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+	if d.Renamed[0].OldName != "old" || !reflect.DeepEqual(d.Locked[0].Platforms, []string{"openai"}) {
+		t.Errorf("unexpected details: renamed %+v, locked %+v", d.Renamed[0], d.Locked[0])
+	}
+
+	want := "➕ 新增 1 ➖ 移除 1 ✏️ 改名 1\n⚡ 变快 1 🐢 变慢 1\n🔓 新解锁 disney 1\n🔒 失去解锁 openai 1\n⚠️ IP风险升高 1"
+	if got := d.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	if got := DiffSnapshots(cur, cur); !got.Empty() || got.Summary() != "与上次检测相比无变化" {
+		t.Errorf("identical snapshots diff = %+v", got)
+	}
+}
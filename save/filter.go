@@ -0,0 +1,463 @@
+package save
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/twj0/subcheck/check"
+)
+
+// Filter 输出分类的过滤函数
+type Filter func(result check.Result) bool
+
+// ParseFilter 解析输出分类的过滤表达式，空表达式匹配所有节点
+//
+// 支持的语法:
+//   - 字段: country ip ipv6 stack city asn isp speed latency risk type name tag
+//     openai openai-web netflix disney gemini google youtube tiktok
+//   - 比较: == != < <= > >= =~(正则) in ["a", "b"]，字符串比较不区分大小写
+//   - 逻辑: && || ! 与括号；单独的字段按真值判断，如 netflix、youtube
+//   - 没有结果的字段(如未检测风险的 risk)与任何值比较都不成立，用 risk == unknown 或
+//     risk != unknown 判断是否有结果
+//
+// 例如: country == "JP" && netflix && speed >= 1024 && risk < 30
+func ParseFilter(src string) (Filter, error) {
+	if strings.TrimSpace(src) == "" {
+		return func(check.Result) bool { return true }, nil
+	}
+	p := &filterParser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("过滤表达式 %q 在 %q 处无法解析", src, p.tokens[p.pos].text)
+	}
+	return func(r check.Result) bool { return truthy(n.eval(r)) }, nil
+}
+
+// filterFields 过滤表达式可用的字段
+var filterFields = map[string]func(r check.Result) any{
+	"country":    func(r check.Result) any { return r.Country },
+	"ip":         func(r check.Result) any { return r.IP },
+	"ipv6":       func(r check.Result) any { return r.IPv6 },
+	"stack":      func(r check.Result) any { return r.IPStack },
+	"city":       func(r check.Result) any { return r.City },
+	"asn":        func(r check.Result) any { return r.ASN },
+	"isp":        func(r check.Result) any { return r.ISP },
+	"speed":      func(r check.Result) any { return float64(r.SpeedKBps) },
+	"latency":    func(r check.Result) any { return float64(r.Latency) },
+	"risk":       riskField,
+	"type":       func(r check.Result) any { return proxyString(r, "type") },
+	"name":       func(r check.Result) any { return proxyString(r, "name") },
+	"tag":        func(r check.Result) any { return proxyString(r, "sub_tag") },
+	"openai":     func(r check.Result) any { return r.Openai },
+	"openai-web": func(r check.Result) any { return r.Openai || r.OpenaiWeb },
+	"netflix":    func(r check.Result) any { return r.Netflix },
+	"disney":     func(r check.Result) any { return r.Disney },
+	"gemini":     func(r check.Result) any { return r.Gemini },
+	"google":     func(r check.Result) any { return r.Google },
+	"youtube":    func(r check.Result) any { return r.Youtube },
+	"tiktok":     func(r check.Result) any { return r.TikTok },
+}
+
+// riskField 没有风险分数时返回 nil，比较时按未知处理
+func riskField(r check.Result) any {
+	if score := riskScore(r); score >= 0 {
+		return float64(score)
+	}
+	return nil
+}
+
+// riskScore 节点的IP风险分数，没有检测结果时为 -1
+func riskScore(r check.Result) int {
+	if r.Risk != nil {
+		return r.Risk.FraudScore
+	}
+	if s := strings.TrimSuffix(r.IPRisk, "%"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			return n
+		}
+	}
+	return -1
+}
+
+func proxyString(r check.Result, key string) string {
+	s, _ := r.Proxy[key].(string)
+	return s
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case []any:
+		return len(v) > 0
+	}
+	return false
+}
+
+type filterToken struct {
+	kind string // ident string number op
+	text string
+}
+
+type filterParser struct {
+	src    string
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for j < len(s) && rune(s[j]) != c {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+				j++
+			}
+			if j >= len(s) {
+				return fmt.Errorf("过滤表达式 %q 中的字符串没有结束", s)
+			}
+			p.tokens = append(p.tokens, filterToken{"string", b.String()})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, filterToken{"number", s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '-') {
+				j++
+			}
+			p.tokens = append(p.tokens, filterToken{"ident", s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("过滤表达式 %q 中有无法识别的字符 %q", s, c)
+			}
+			p.tokens = append(p.tokens, filterToken{"op", op})
+			i += len(op)
+		}
+	}
+	return nil
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return filterToken{}
+}
+
+func (p *filterParser) accept(kind, text string) bool {
+	t := p.peek()
+	if t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// filterNode 表达式树的节点
+type filterNode interface {
+	eval(r check.Result) any
+}
+
+type (
+	literalNode struct{ v any }
+	fieldNode   struct{ get func(check.Result) any }
+	notNode     struct{ n filterNode }
+	logicNode   struct {
+		and         bool
+		left, right filterNode
+	}
+	compareNode struct {
+		op          string
+		left, right filterNode
+		re          *regexp.Regexp
+	}
+)
+
+func (n literalNode) eval(check.Result) any { return n.v }
+func (n fieldNode) eval(r check.Result) any { return n.get(r) }
+func (n notNode) eval(r check.Result) any   { return !truthy(n.n.eval(r)) }
+func (n logicNode) eval(r check.Result) any {
+	if n.and {
+		return truthy(n.left.eval(r)) && truthy(n.right.eval(r))
+	}
+	return truthy(n.left.eval(r)) || truthy(n.right.eval(r))
+}
+
+func (n compareNode) eval(r check.Result) any {
+	l, rv := n.left.eval(r), n.right.eval(r)
+	if l == nil || rv == nil {
+		// 未知的值只能与 unknown 比较，其余比较都不成立
+		switch n.op {
+		case "==":
+			return l == nil && rv == nil
+		case "!=":
+			return l == nil && rv != nil && isUnknown(n.left) || rv == nil && l != nil && isUnknown(n.right)
+		}
+		return false
+	}
+	switch n.op {
+	case "=~":
+		return n.re.MatchString(fmt.Sprint(l))
+	case "in":
+		list, _ := rv.([]any)
+		for _, item := range list {
+			if equal(l, item) {
+				return true
+			}
+		}
+		return false
+	case "==":
+		return equal(l, rv)
+	case "!=":
+		return !equal(l, rv)
+	}
+	lf, lok := toNumber(l)
+	rf, rok := toNumber(rv)
+	if !lok || !rok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return lf < rf
+	case "<=":
+		return lf <= rf
+	case ">":
+		return lf > rf
+	case ">=":
+		return lf >= rf
+	}
+	return false
+}
+
+// isUnknown 判断节点是否为 unknown 字面量
+func isUnknown(n filterNode) bool {
+	lit, ok := n.(literalNode)
+	return ok && lit.v == nil
+}
+
+func equal(a, b any) bool {
+	if af, ok := toNumber(a); ok {
+		if bf, ok := toNumber(b); ok {
+			return af == bf
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		return ab == truthy(b)
+	}
+	return strings.EqualFold(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("op", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("op", "&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.accept("op", "!") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *filterParser) parseCompare() (filterNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == "ident" && t.text == "in":
+		p.pos++
+		right, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{op: "in", left: left, right: right}, nil
+	case t.kind == "op" && compareOps[t.text]:
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		n := compareNode{op: t.text, left: left, right: right}
+		if t.text == "=~" {
+			lit, ok := right.(literalNode)
+			if !ok {
+				return nil, fmt.Errorf("=~ 右侧必须是字符串")
+			}
+			re, err := regexp.Compile("(?i)" + fmt.Sprint(lit.v))
+			if err != nil {
+				return nil, fmt.Errorf("过滤表达式中的正则无效: %w", err)
+			}
+			n.re = re
+		}
+		return n, nil
+	}
+	return left, nil
+}
+
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true}
+
+func (p *filterParser) parseList() (filterNode, error) {
+	if !p.accept("op", "[") {
+		return nil, fmt.Errorf("in 后面需要 [...] 列表")
+	}
+	var list []any
+	for !p.accept("op", "]") {
+		if len(list) > 0 && !p.accept("op", ",") {
+			return nil, fmt.Errorf("列表元素之间需要逗号")
+		}
+		n, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := n.(literalNode)
+		if !ok {
+			return nil, fmt.Errorf("列表中只能是字符串或数字")
+		}
+		list = append(list, lit.v)
+	}
+	return literalNode{list}, nil
+}
+
+func (p *filterParser) parseOperand() (filterNode, error) {
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case "string":
+		return literalNode{t.text}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的数字 %q", t.text)
+		}
+		return literalNode{f}, nil
+	case "ident":
+		switch strings.ToLower(t.text) {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "unknown":
+			return literalNode{nil}, nil
+		}
+		get, ok := filterFields[strings.ToLower(t.text)]
+		if !ok {
+			return nil, fmt.Errorf("未知的字段 %q", t.text)
+		}
+		return fieldNode{get}, nil
+	case "op":
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept("op", ")") {
+				return nil, fmt.Errorf("括号没有闭合")
+			}
+			return n, nil
+		}
+	}
+	if t.kind == "" {
+		return nil, fmt.Errorf("过滤表达式 %q 不完整", p.src)
+	}
+	return nil, fmt.Errorf("过滤表达式 %q 在 %q 处无法解析", p.src, t.text)
+}
+
+// ParseSort 解析输出分类的排序方式: speed(速度从高到低)、latency(延迟从低到高)、risk(风险从低到高)
+// 为空时保持检测结果的顺序
+func ParseSort(key string) (func(a, b check.Result) bool, error) {
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "":
+		return nil, nil
+	case "speed":
+		return func(a, b check.Result) bool { return a.SpeedKBps > b.SpeedKBps }, nil
+	case "latency":
+		return func(a, b check.Result) bool { return a.Latency < b.Latency }, nil
+	case "risk":
+		// 没有风险分数的节点排在最后
+		return func(a, b check.Result) bool {
+			ra, rb := riskScore(a), riskScore(b)
+			if ra < 0 || rb < 0 {
+				return ra >= 0 && rb < 0
+			}
+			return ra < rb
+		}, nil
+	}
+	return nil, fmt.Errorf("未知的排序方式 %q", key)
+}
@@ -0,0 +1,193 @@
+package save
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/ipcheck"
+	"github.com/twj0/subcheck/save/method"
+)
+
+func TestParseFilter(t *testing.T) {
+	jp := check.Result{
+		Proxy:     map[string]any{"name": "JP 01", "type": "vless", "sub_tag": "free"},
+		Country:   "JP",
+		Netflix:   true,
+		Youtube:   "JP",
+		SpeedKBps: 2048,
+		Latency:   120,
+		Risk:      &ipcheck.Report{Core: ipcheck.Core{FraudScore: 12}},
+	}
+	us := check.Result{
+		Proxy:     map[string]any{"name": "US 01", "type": "ss"},
+		Country:   "US",
+		OpenaiWeb: true,
+		SpeedKBps: 512,
+		Latency:   300,
+		IPRisk:    "80%",
+	}
+	none := check.Result{Proxy: map[string]any{"name": "x", "type": "trojan"}}
+
+	tests := []struct {
+		expr string
+		want [3]bool // jp, us, none
+	}{
+		{``, [3]bool{true, true, true}},
+		{`country == "JP"`, [3]bool{true, false, false}},
+		{`country == 'jp'`, [3]bool{true, false, false}},
+		{`country != "JP"`, [3]bool{false, true, true}},
+		{`netflix`, [3]bool{true, false, false}},
+		{`!netflix`, [3]bool{false, true, true}},
+		{`youtube == "JP" && speed >= 1024`, [3]bool{true, false, false}},
+		{`speed > 500 || type == "trojan"`, [3]bool{true, true, true}},
+		{`risk < 30`, [3]bool{true, false, false}},
+		{`risk != 12`, [3]bool{false, true, false}},
+		{`!(risk >= 30)`, [3]bool{true, false, true}},
+		{`risk == unknown`, [3]bool{false, false, true}},
+		{`risk != unknown`, [3]bool{true, true, false}},
+		{`type in ["vless", "trojan"]`, [3]bool{true, false, true}},
+		{`name =~ "^(jp|us) "`, [3]bool{true, true, false}},
+		{`tag == "free"`, [3]bool{true, false, false}},
+		{`openai-web && !(latency < 200)`, [3]bool{false, true, false}},
+		{`netflix == true`, [3]bool{true, false, false}},
+	}
+	results := []check.Result{jp, us, none}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseFilter() error = %v", err)
+			}
+			for i, r := range results {
+				if got := f(r); got != tt.want[i] {
+					t.Errorf("%s: got %v, want %v", r.Proxy["name"], got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseFilterError(t *testing.T) {
+	for _, expr := range []string{
+		`country ==`,
+		`bandwidth == 1`,
+		`(netflix`,
+		`country == "JP`,
+		`type in "vless"`,
+		`name =~ "("`,
+		`netflix disney`,
+		`speed # 1`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseFilter(expr); err == nil {
+				t.Errorf("ParseFilter(%q) should fail", expr)
+			}
+		})
+	}
+}
+
+func TestCategorizeProxies(t *testing.T) {
+	results := []check.Result{
+		{Proxy: map[string]any{"name": "a"}, Country: "JP", SpeedKBps: 100, IPRisk: "40%"},
+		{Proxy: map[string]any{"name": "b"}, Country: "JP", SpeedKBps: 300},
+		{Proxy: map[string]any{"name": "c"}, Country: "US", SpeedKBps: 900, IPRisk: "5%"},
+		{Proxy: map[string]any{"name": "d"}, Country: "JP", SpeedKBps: 200, IPRisk: "10%"},
+	}
+	tests := []struct {
+		name   string
+		filter string
+		sort   string
+		limit  int
+		want   []string
+	}{
+		{"filter keeps order", `country == "JP"`, "", 0, []string{"a", "b", "d"}},
+		{"sort by speed with limit", `country == "JP"`, "speed", 2, []string{"b", "d"}},
+		{"risk puts unknown last", ``, "risk", 0, []string{"c", "d", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			less, err := ParseSort(tt.sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cs := &ConfigSaver{results: results, categories: []ProxyCategory{{Name: "x.yaml", Filter: filter, Less: less, Limit: tt.limit}}}
+			cs.categorizeProxies()
+			var got []string
+			for _, p := range cs.categories[0].Proxies {
+				got = append(got, p["name"].(string))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []config.OutputConfig
+		wantErr bool
+	}{
+		{"valid", []config.OutputConfig{{Name: "jp", Filter: `country == "JP"`}, {Name: "us.yaml", Sort: "speed"}}, false},
+		{"reserved all", []config.OutputConfig{{Name: "all"}}, true},
+		{"reserved mihomo", []config.OutputConfig{{Name: "mihomo.yaml"}}, true},
+		{"duplicate", []config.OutputConfig{{Name: "jp"}, {Name: "jp.yaml"}}, true},
+		// jp-mihomo.yaml 同时是 jp 的 mihomo 配置与 jp-mihomo 的 yaml
+		{"file collision", []config.OutputConfig{{Name: "jp"}, {Name: "jp-mihomo"}}, true},
+		{"path", []config.OutputConfig{{Name: "../jp"}}, true},
+		{"empty", []config.OutputConfig{{Name: " "}}, true},
+		{"invalid filter", []config.OutputConfig{{Name: "jp", Filter: "country =="}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateOutputs(tt.outputs); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOutputs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSaveCustomCategory(t *testing.T) {
+	old := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = old })
+	dir := t.TempDir()
+	config.GlobalConfig = &config.Config{OutputDir: dir}
+
+	saver, err := method.NewLocalSaver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := &ConfigSaver{saveMethods: []func([]byte, string) error{saver.Save}}
+	proxies := []map[string]any{{"name": "jp", "type": "ss", "server": "1.1.1.1", "port": 443, "cipher": "aes-128-gcm", "password": "x"}}
+	if err := cs.saveCustomCategory(ProxyCategory{Name: "jp.yaml", Proxies: proxies, Custom: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range categoryFiles("jp") {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Errorf("%s not written: %v", f, err)
+		}
+	}
+
+	// 没有匹配的节点时删除之前生成的文件，避免继续发布过期节点
+	if err := cs.saveCustomCategory(ProxyCategory{Name: "jp.yaml", Custom: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range categoryFiles("jp") {
+		if _, err := os.Stat(filepath.Join(dir, f)); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed, stat err = %v", f, err)
+		}
+	}
+}
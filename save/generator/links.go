@@ -0,0 +1,379 @@
+// Package generator 不依赖 sub-store，直接由 mihomo 节点生成各种订阅格式
+package generator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ShareLink 将 mihomo 节点转换为 V2Ray 风格的分享链接
+func ShareLink(p map[string]any) (string, error) {
+	typ := str(p, "type")
+	switch typ {
+	case "ss":
+		return ssLink(p)
+	case "ssr":
+		return ssrLink(p)
+	case "vmess":
+		return vmessLink(p)
+	case "vless":
+		return vlessLink(p)
+	case "trojan":
+		return trojanLink(p)
+	case "hysteria":
+		return hysteriaLink(p)
+	case "hysteria2":
+		return hysteria2Link(p)
+	case "tuic":
+		return tuicLink(p)
+	case "anytls":
+		return anytlsLink(p)
+	case "socks5":
+		return socksLink(p)
+	case "http":
+		return httpLink(p)
+	}
+	return "", fmt.Errorf("不支持生成 %s 节点的分享链接", typ)
+}
+
+// URIList 每行一个分享链接，不支持的节点跳过
+func URIList(proxies []map[string]any) []byte {
+	var b bytes.Buffer
+	for _, p := range proxies {
+		link, err := ShareLink(p)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("生成分享链接失败 %v: %v", p["name"], err))
+			continue
+		}
+		b.WriteString(link)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Base64 V2Ray 订阅格式，分享链接列表整体做 base64 编码
+func Base64(proxies []map[string]any) []byte {
+	list := URIList(proxies)
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(list)))
+	base64.StdEncoding.Encode(out, list)
+	return out
+}
+
+func str(m map[string]any, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func boolean(m map[string]any, key string) bool {
+	switch v := m[key].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+func sub(m map[string]any, key string) map[string]any {
+	v, _ := m[key].(map[string]any)
+	if v == nil {
+		return map[string]any{}
+	}
+	return v
+}
+
+// first 取字符串或字符串列表的第一个值，如 h2-opts.host、http-opts.path
+func first(m map[string]any, key string) string {
+	switch v := m[key].(type) {
+	case []any:
+		if len(v) > 0 {
+			return fmt.Sprint(v[0])
+		}
+		return ""
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	return str(m, key)
+}
+
+// join 字符串列表用逗号连接，如 alpn
+func join(m map[string]any, key string) string {
+	switch v := m[key].(type) {
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, s := range v {
+			parts = append(parts, fmt.Sprint(s))
+		}
+		return strings.Join(parts, ",")
+	case []string:
+		return strings.Join(v, ",")
+	}
+	return str(m, key)
+}
+
+// hostPort 拼接地址，IPv6 加方括号
+func hostPort(p map[string]any) string {
+	return net.JoinHostPort(str(p, "server"), str(p, "port"))
+}
+
+// fragment 节点名称作为链接的 #备注
+func fragment(p map[string]any) string {
+	return "#" + url.PathEscape(str(p, "name"))
+}
+
+// query 只保留非空的参数
+type query []string
+
+func (q *query) set(k, v string) {
+	if v != "" {
+		*q = append(*q, url.QueryEscape(k)+"="+url.QueryEscape(v))
+	}
+}
+
+func (q query) String() string {
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(q, "&")
+}
+
+// transport 写入 v2ray 系链接通用的传输层参数
+func transport(q *query, p map[string]any) {
+	network := str(p, "network")
+	if network == "" {
+		network = "tcp"
+	}
+	q.set("type", network)
+	switch network {
+	case "ws":
+		ws := sub(p, "ws-opts")
+		q.set("path", str(ws, "path"))
+		q.set("host", str(sub(ws, "headers"), "Host"))
+	case "http":
+		h := sub(p, "http-opts")
+		q.set("headerType", "http")
+		q.set("path", first(h, "path"))
+		q.set("host", first(sub(h, "headers"), "Host"))
+	case "h2":
+		h := sub(p, "h2-opts")
+		q.set("path", str(h, "path"))
+		q.set("host", first(h, "host"))
+	case "grpc":
+		q.set("serviceName", str(sub(p, "grpc-opts"), "grpc-service-name"))
+		q.set("mode", "gun")
+	case "httpupgrade", "xhttp":
+		h := sub(p, network+"-opts")
+		q.set("path", str(h, "path"))
+		q.set("host", str(h, "host"))
+	}
+}
+
+func ssLink(p map[string]any) (string, error) {
+	user := base64.RawURLEncoding.EncodeToString([]byte(str(p, "cipher") + ":" + str(p, "password")))
+	var q query
+	opts := sub(p, "plugin-opts")
+	switch str(p, "plugin") {
+	case "obfs":
+		q.set("plugin", "obfs-local;obfs="+str(opts, "mode")+";obfs-host="+str(opts, "host"))
+	case "v2ray-plugin":
+		plugin := "v2ray-plugin;mode=" + str(opts, "mode")
+		if boolean(opts, "tls") {
+			plugin += ";tls"
+		}
+		if h := str(opts, "host"); h != "" {
+			plugin += ";host=" + h
+		}
+		if path := str(opts, "path"); path != "" {
+			plugin += ";path=" + path
+		}
+		q.set("plugin", plugin)
+	case "":
+	default:
+		return "", fmt.Errorf("不支持 ss 插件 %s", str(p, "plugin"))
+	}
+	return "ss://" + user + "@" + hostPort(p) + q.String() + fragment(p), nil
+}
+
+func ssrLink(p map[string]any) (string, error) {
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	main := strings.Join([]string{
+		str(p, "server"), str(p, "port"), str(p, "protocol"), str(p, "cipher"), str(p, "obfs"), b64(str(p, "password")),
+	}, ":")
+	params := "obfsparam=" + b64(str(p, "obfs-param")) + "&protoparam=" + b64(str(p, "protocol-param")) + "&remarks=" + b64(str(p, "name"))
+	return "ssr://" + b64(main+"/?"+params), nil
+}
+
+func vmessLink(p map[string]any) (string, error) {
+	network := str(p, "network")
+	if network == "" {
+		network = "tcp"
+	}
+	v := map[string]string{
+		"v":    "2",
+		"ps":   str(p, "name"),
+		"add":  str(p, "server"),
+		"port": str(p, "port"),
+		"id":   str(p, "uuid"),
+		"aid":  str(p, "alterId"),
+		"scy":  str(p, "cipher"),
+		"net":  network,
+		"type": "none",
+		"sni":  str(p, "servername"),
+		"alpn": join(p, "alpn"),
+		"fp":   str(p, "client-fingerprint"),
+	}
+	if v["aid"] == "" {
+		v["aid"] = "0"
+	}
+	if boolean(p, "tls") {
+		v["tls"] = "tls"
+	}
+	switch network {
+	case "ws":
+		ws := sub(p, "ws-opts")
+		v["path"] = str(ws, "path")
+		v["host"] = str(sub(ws, "headers"), "Host")
+	case "http":
+		h := sub(p, "http-opts")
+		v["type"] = "http"
+		v["path"] = first(h, "path")
+		v["host"] = first(sub(h, "headers"), "Host")
+	case "h2":
+		h := sub(p, "h2-opts")
+		v["path"] = str(h, "path")
+		v["host"] = first(h, "host")
+	case "grpc":
+		v["path"] = str(sub(p, "grpc-opts"), "grpc-service-name")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func vlessLink(p map[string]any) (string, error) {
+	q := query{}
+	q.set("encryption", "none")
+	q.set("flow", str(p, "flow"))
+	reality := sub(p, "reality-opts")
+	switch {
+	case len(reality) > 0:
+		q.set("security", "reality")
+		q.set("pbk", str(reality, "public-key"))
+		q.set("sid", str(reality, "short-id"))
+	case boolean(p, "tls"):
+		q.set("security", "tls")
+	default:
+		q.set("security", "none")
+	}
+	q.set("sni", str(p, "servername"))
+	q.set("fp", str(p, "client-fingerprint"))
+	q.set("alpn", join(p, "alpn"))
+	if boolean(p, "skip-cert-verify") {
+		q.set("allowInsecure", "1")
+	}
+	transport(&q, p)
+	return "vless://" + url.User(str(p, "uuid")).String() + "@" + hostPort(p) + q.String() + fragment(p), nil
+}
+
+func trojanLink(p map[string]any) (string, error) {
+	q := query{}
+	q.set("security", "tls")
+	q.set("sni", str(p, "sni"))
+	q.set("fp", str(p, "client-fingerprint"))
+	q.set("alpn", join(p, "alpn"))
+	if boolean(p, "skip-cert-verify") {
+		q.set("allowInsecure", "1")
+	}
+	transport(&q, p)
+	return "trojan://" + url.User(str(p, "password")).String() + "@" + hostPort(p) + q.String() + fragment(p), nil
+}
+
+func hysteriaLink(p map[string]any) (string, error) {
+	q := query{}
+	q.set("protocol", str(p, "protocol"))
+	q.set("auth", str(p, "auth-str"))
+	q.set("peer", str(p, "sni"))
+	q.set("upmbps", str(p, "up"))
+	q.set("downmbps", str(p, "down"))
+	q.set("alpn", join(p, "alpn"))
+	q.set("obfs", str(p, "obfs"))
+	if boolean(p, "skip-cert-verify") {
+		q.set("insecure", "1")
+	}
+	return "hysteria://" + hostPort(p) + q.String() + fragment(p), nil
+}
+
+func hysteria2Link(p map[string]any) (string, error) {
+	q := query{}
+	q.set("sni", str(p, "sni"))
+	q.set("obfs", str(p, "obfs"))
+	q.set("obfs-password", str(p, "obfs-password"))
+	q.set("mport", str(p, "ports"))
+	q.set("alpn", join(p, "alpn"))
+	if boolean(p, "skip-cert-verify") {
+		q.set("insecure", "1")
+	}
+	return "hysteria2://" + url.User(str(p, "password")).String() + "@" + hostPort(p) + q.String() + fragment(p), nil
+}
+
+func tuicLink(p map[string]any) (string, error) {
+	q := query{}
+	q.set("congestion_control", str(p, "congestion-controller"))
+	q.set("udp_relay_mode", str(p, "udp-relay-mode"))
+	q.set("alpn", join(p, "alpn"))
+	q.set("sni", str(p, "sni"))
+	if boolean(p, "skip-cert-verify") {
+		q.set("allow_insecure", "1")
+	}
+	user := url.UserPassword(str(p, "uuid"), str(p, "password")).String()
+	return "tuic://" + user + "@" + hostPort(p) + q.String() + fragment(p), nil
+}
+
+func anytlsLink(p map[string]any) (string, error) {
+	q := query{}
+	q.set("sni", str(p, "sni"))
+	q.set("fp", str(p, "client-fingerprint"))
+	if boolean(p, "skip-cert-verify") {
+		q.set("insecure", "1")
+	}
+	return "anytls://" + url.User(str(p, "password")).String() + "@" + hostPort(p) + q.String() + fragment(p), nil
+}
+
+func socksLink(p map[string]any) (string, error) {
+	auth := ""
+	if u := str(p, "username"); u != "" {
+		auth = base64.RawURLEncoding.EncodeToString([]byte(u+":"+str(p, "password"))) + "@"
+	}
+	return "socks://" + auth + hostPort(p) + fragment(p), nil
+}
+
+func httpLink(p map[string]any) (string, error) {
+	scheme := "http"
+	if boolean(p, "tls") {
+		scheme = "https"
+	}
+	auth := ""
+	if u := str(p, "username"); u != "" {
+		auth = url.UserPassword(u, str(p, "password")).String() + "@"
+	}
+	return scheme + "://" + auth + hostPort(p) + fragment(p), nil
+}
@@ -0,0 +1,171 @@
+package generator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestShareLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy map[string]any
+		want  string
+	}{
+		{
+			name:  "ss",
+			proxy: map[string]any{"name": "香港 01", "type": "ss", "server": "1.2.3.4", "port": 8388, "cipher": "aes-128-gcm", "password": "pass"},
+			want:  "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-128-gcm:pass")) + "@1.2.3.4:8388#%E9%A6%99%E6%B8%AF%2001",
+		},
+		{
+			name: "ss obfs",
+			proxy: map[string]any{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 8388, "cipher": "aes-128-gcm", "password": "pass",
+				"plugin": "obfs", "plugin-opts": map[string]any{"mode": "http", "host": "bing.com"}},
+			want: "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-128-gcm:pass")) + "@1.2.3.4:8388?plugin=obfs-local%3Bobfs%3Dhttp%3Bobfs-host%3Dbing.com#a",
+		},
+		{
+			name: "vless reality",
+			proxy: map[string]any{"name": "a", "type": "vless", "server": "example.com", "port": 443, "uuid": "uuid-1",
+				"tls": true, "flow": "xtls-rprx-vision", "servername": "www.apple.com", "client-fingerprint": "chrome",
+				"reality-opts": map[string]any{"public-key": "pbk", "short-id": "ab"}},
+			want: "vless://uuid-1@example.com:443?encryption=none&flow=xtls-rprx-vision&security=reality&pbk=pbk&sid=ab&sni=www.apple.com&fp=chrome&type=tcp#a",
+		},
+		{
+			name: "vless ws tls",
+			proxy: map[string]any{"name": "a", "type": "vless", "server": "example.com", "port": 443, "uuid": "uuid-1", "tls": true,
+				"network": "ws", "ws-opts": map[string]any{"path": "/ws", "headers": map[string]any{"Host": "cdn.example.com"}}},
+			want: "vless://uuid-1@example.com:443?encryption=none&security=tls&type=ws&path=%2Fws&host=cdn.example.com#a",
+		},
+		{
+			name: "trojan grpc",
+			proxy: map[string]any{"name": "a", "type": "trojan", "server": "example.com", "port": 443, "password": "p@ss", "sni": "example.com",
+				"skip-cert-verify": true, "network": "grpc", "grpc-opts": map[string]any{"grpc-service-name": "svc"}},
+			want: "trojan://p%40ss@example.com:443?security=tls&sni=example.com&allowInsecure=1&type=grpc&serviceName=svc&mode=gun#a",
+		},
+		{
+			name:  "hysteria2 ipv6",
+			proxy: map[string]any{"name": "a", "type": "hysteria2", "server": "2001:db8::1", "port": 443, "password": "pw", "sni": "example.com"},
+			want:  "hysteria2://pw@[2001:db8::1]:443?sni=example.com#a",
+		},
+		{
+			name:  "tuic",
+			proxy: map[string]any{"name": "a", "type": "tuic", "server": "1.2.3.4", "port": 443, "uuid": "u", "password": "p", "congestion-controller": "bbr", "alpn": []any{"h3"}},
+			want:  "tuic://u:p@1.2.3.4:443?congestion_control=bbr&alpn=h3#a",
+		},
+		{
+			name:  "socks5",
+			proxy: map[string]any{"name": "a", "type": "socks5", "server": "1.2.3.4", "port": 1080, "username": "u", "password": "p"},
+			want:  "socks://" + base64.RawURLEncoding.EncodeToString([]byte("u:p")) + "@1.2.3.4:1080#a",
+		},
+		{
+			name:  "https",
+			proxy: map[string]any{"name": "a", "type": "http", "server": "1.2.3.4", "port": 443, "tls": true},
+			want:  "https://1.2.3.4:443#a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ShareLink(tt.proxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ShareLink() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShareLinkVmess(t *testing.T) {
+	link, err := ShareLink(map[string]any{"name": "a", "type": "vmess", "server": "1.2.3.4", "port": 443, "uuid": "u",
+		"alterId": 0, "cipher": "auto", "tls": true, "network": "ws", "ws-opts": map[string]any{"path": "/ws"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(link, "vmess://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]string
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"ps": "a", "add": "1.2.3.4", "port": "443", "id": "u", "aid": "0", "net": "ws", "path": "/ws", "tls": "tls"}
+	for k, w := range want {
+		if v[k] != w {
+			t.Errorf("vmess %s = %q, want %q", k, v[k], w)
+		}
+	}
+}
+
+func TestBase64(t *testing.T) {
+	proxies := []map[string]any{
+		{"name": "a", "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p"},
+		{"name": "b", "type": "wireguard", "server": "1.2.3.4", "port": 51820},
+		{"name": "c", "type": "hysteria2", "server": "1.2.3.4", "port": 443, "password": "p"},
+	}
+	data, err := base64.StdEncoding.DecodeString(string(Base64(proxies)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d links, want 2 (unsupported types skipped): %q", len(lines), lines)
+	}
+	if !strings.HasPrefix(lines[0], "trojan://") || !strings.HasPrefix(lines[1], "hysteria2://") {
+		t.Errorf("unexpected links: %q", lines)
+	}
+}
+
+func TestMihomoProfile(t *testing.T) {
+	template := []byte(`mixed-port: 7890
+proxies:
+proxy-groups:
+  - name: PROXY
+    type: select
+    include-all: true
+  - name: Auto
+    type: url-test
+    proxies: []
+  - name: OpenAI
+    type: select
+    proxies: [PROXY, DIRECT]
+rules:
+  - MATCH,PROXY
+`)
+	proxies := []map[string]any{
+		{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 8388, "cipher": "aes-128-gcm", "password": "p"},
+		{"name": "b", "type": "ss", "server": "1.2.3.5", "port": 8388, "cipher": "aes-128-gcm", "password": "p"},
+	}
+	data, err := MihomoProfile(template, proxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile struct {
+		MixedPort int              `yaml:"mixed-port"`
+		Proxies   []map[string]any `yaml:"proxies"`
+		Groups    []struct {
+			Name    string   `yaml:"name"`
+			Proxies []string `yaml:"proxies"`
+		} `yaml:"proxy-groups"`
+		Rules []string `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.MixedPort != 7890 || len(profile.Rules) != 1 {
+		t.Errorf("template settings not preserved: %s", data)
+	}
+	if len(profile.Proxies) != 2 {
+		t.Fatalf("got %d proxies, want 2", len(profile.Proxies))
+	}
+	want := map[string]string{"PROXY": "", "Auto": "a,b", "OpenAI": "PROXY,DIRECT"}
+	for _, g := range profile.Groups {
+		if got := strings.Join(g.Proxies, ","); got != want[g.Name] {
+			t.Errorf("group %s proxies = %q, want %q", g.Name, got, want[g.Name])
+		}
+	}
+}
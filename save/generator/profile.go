@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MihomoProfile 基于 clash 模板生成完整的 mihomo 配置
+// 模板中的 proxies 会被替换为检测通过的节点，没有 include-all/use 且 proxies
+// 为空的策略组会注入全部节点名称
+func MihomoProfile(template []byte, proxies []map[string]any) ([]byte, error) {
+	var profile map[string]any
+	if err := yaml.Unmarshal(template, &profile); err != nil {
+		return nil, fmt.Errorf("解析 clash 模板失败: %w", err)
+	}
+	if profile == nil {
+		profile = map[string]any{}
+	}
+
+	names := make([]any, 0, len(proxies))
+	for _, p := range proxies {
+		names = append(names, p["name"])
+	}
+	profile["proxies"] = proxies
+
+	groups, _ := profile["proxy-groups"].([]any)
+	for _, g := range groups {
+		group, ok := g.(map[string]any)
+		if !ok || boolean(group, "include-all") || boolean(group, "include-all-proxies") || group["use"] != nil {
+			continue
+		}
+		if list, _ := group["proxies"].([]any); len(list) > 0 {
+			continue
+		}
+		group["proxies"] = names
+	}
+
+	return yaml.Marshal(profile)
+}
+
+// MergeGroups 将分组合并到 mihomo 配置的 proxy-groups 中
+// 只保留配置中存在的节点，与已有节点或策略组重名的分组跳过，
+// 新分组追加到已有 select 组可选项的末尾，不改变这些组的默认选择；
+// proxies 为空的 select 组(依赖 include-all/use)不追加，否则新分组会排在最前面成为默认选择
+func MergeGroups(profile []byte, groups []Group) ([]byte, error) {
+	var config map[string]any
+	if err := yaml.Unmarshal(profile, &config); err != nil {
+		return nil, fmt.Errorf("解析 mihomo 配置失败: %w", err)
+	}
+	if config == nil {
+		return nil, fmt.Errorf("mihomo 配置为空")
+	}
+
+	proxies := make(map[string]bool)
+	taken := make(map[string]bool)
+	list, _ := config["proxies"].([]any)
+	for _, p := range list {
+		if proxy, ok := p.(map[string]any); ok {
+			proxies[str(proxy, "name")] = true
+			taken[str(proxy, "name")] = true
+		}
+	}
+	existing, _ := config["proxy-groups"].([]any)
+	for _, g := range existing {
+		if group, ok := g.(map[string]any); ok {
+			taken[str(group, "name")] = true
+		}
+	}
+
+	var added []any
+	var names []any
+	for _, g := range groups {
+		var members []any
+		for _, m := range g.Members {
+			if proxies[m] {
+				members = append(members, m)
+			}
+		}
+		if len(members) == 0 || taken[g.Tag] {
+			continue
+		}
+		taken[g.Tag] = true
+		group := map[string]any{"name": g.Tag, "type": "select", "proxies": members}
+		if g.Type == GroupURLTest {
+			group["type"] = "url-test"
+			group["url"] = "http://www.gstatic.com/generate_204"
+			group["interval"] = 300
+			group["tolerance"] = 50
+		}
+		added = append(added, group)
+		names = append(names, g.Tag)
+	}
+	if len(added) == 0 {
+		return profile, nil
+	}
+
+	for _, g := range existing {
+		group, ok := g.(map[string]any)
+		if !ok || str(group, "type") != "select" {
+			continue
+		}
+		current, _ := group["proxies"].([]any)
+		if len(current) == 0 {
+			continue
+		}
+		group["proxies"] = append(append([]any{}, current...), names...)
+	}
+	config["proxy-groups"] = append(existing, added...)
+
+	return yaml.Marshal(config)
+}
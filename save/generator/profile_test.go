@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeGroups(t *testing.T) {
+	profile := []byte(`proxies:
+  - {name: a, type: ss, server: 1.2.3.4, port: 8388, cipher: aes-128-gcm, password: p}
+  - {name: b, type: ss, server: 1.2.3.5, port: 8388, cipher: aes-128-gcm, password: p}
+proxy-groups:
+  - name: PROXY
+    type: select
+    include-all: true
+    proxies: [Auto, DIRECT]
+  - name: Fallback
+    type: select
+    include-all: true
+  - name: Auto
+    type: url-test
+    include-all: true
+`)
+	groups := []Group{
+		{Tag: "JP", Type: GroupURLTest, Members: []string{"a", "missing"}},
+		{Tag: "Netflix", Type: GroupSelector, Members: []string{"b"}},
+		{Tag: "Empty", Type: GroupSelector, Members: []string{"missing"}},
+		{Tag: "Auto", Type: GroupSelector, Members: []string{"a"}},
+	}
+	data, err := MergeGroups(profile, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Groups []struct {
+			Name    string   `yaml:"name"`
+			Type    string   `yaml:"type"`
+			Proxies []string `yaml:"proxies"`
+		} `yaml:"proxy-groups"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	// 追加到已有可选项之后，默认选择不变；没有 proxies 的组不追加
+	want := []string{"PROXY select Auto,DIRECT,JP,Netflix", "Fallback select ", "Auto url-test ", "JP url-test a", "Netflix select b"}
+	var got []string
+	for _, g := range config.Groups {
+		got = append(got, g.Name+" "+g.Type+" "+strings.Join(g.Proxies, ","))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("proxy-groups =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,302 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// 出站分组类型
+const (
+	GroupSelector = "selector"
+	GroupURLTest  = "urltest"
+)
+
+// reservedTags 固定生成的出站名称，分组不能与其重名
+var reservedTags = map[string]bool{"proxy": true, "auto": true, "direct": true}
+
+// Group sing-box 的 selector/urltest 出站，Members 为节点名称
+type Group struct {
+	Tag     string
+	Type    string
+	Members []string
+}
+
+// SingBox 生成 sing-box 配置，每个节点转换为一个出站，
+// 另外生成 proxy(selector)、auto(urltest) 与传入的分组，不支持的节点跳过
+func SingBox(proxies []map[string]any, groups []Group) ([]byte, error) {
+	tags := make([]string, 0, len(proxies))
+	seen := make(map[string]bool, len(proxies))
+	var nodes []map[string]any
+	for _, p := range proxies {
+		out, err := SingBoxOutbound(p)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("转换 sing-box 出站失败 %v: %v", p["name"], err))
+			continue
+		}
+		tag := str(p, "name")
+		if seen[tag] {
+			slog.Debug(fmt.Sprintf("sing-box 出站名称重复，跳过: %s", tag))
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		nodes = append(nodes, out)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("没有可转换为 sing-box 出站的节点")
+	}
+
+	var groupOutbounds []map[string]any
+	groupTags := []string{"auto"}
+	for _, g := range groups {
+		members := make([]string, 0, len(g.Members))
+		for _, m := range g.Members {
+			if seen[m] {
+				members = append(members, m)
+			}
+		}
+		if len(members) == 0 || seen[g.Tag] || reservedTags[g.Tag] {
+			continue
+		}
+		groupOutbounds = append(groupOutbounds, groupOutbound(g.Tag, g.Type, members))
+		groupTags = append(groupTags, g.Tag)
+	}
+
+	outbounds := []map[string]any{
+		groupOutbound("proxy", GroupSelector, append(groupTags, tags...)),
+		groupOutbound("auto", GroupURLTest, tags),
+	}
+	outbounds = append(outbounds, groupOutbounds...)
+	outbounds = append(outbounds, nodes...)
+	outbounds = append(outbounds, map[string]any{"type": "direct", "tag": "direct"})
+
+	return json.MarshalIndent(map[string]any{
+		"log": map[string]any{"level": "warn"},
+		"inbounds": []map[string]any{
+			{"type": "mixed", "tag": "mixed-in", "listen": "127.0.0.1", "listen_port": 2080},
+		},
+		"outbounds": outbounds,
+		"route": map[string]any{
+			"final":                 "proxy",
+			"auto_detect_interface": true,
+		},
+	}, "", "  ")
+}
+
+func groupOutbound(tag, typ string, members []string) map[string]any {
+	out := map[string]any{"type": typ, "tag": tag, "outbounds": members}
+	if typ == GroupURLTest {
+		out["url"] = "https://www.gstatic.com/generate_204"
+		out["interval"] = "5m"
+	}
+	return out
+}
+
+// SingBoxOutbound 将 mihomo 节点转换为 sing-box 出站
+func SingBoxOutbound(p map[string]any) (map[string]any, error) {
+	port, err := strconv.Atoi(str(p, "port"))
+	if err != nil {
+		return nil, fmt.Errorf("端口无效: %v", p["port"])
+	}
+	out := map[string]any{
+		"tag":         str(p, "name"),
+		"server":      str(p, "server"),
+		"server_port": port,
+	}
+
+	switch typ := str(p, "type"); typ {
+	case "vmess":
+		out["type"] = "vmess"
+		out["uuid"] = str(p, "uuid")
+		out["alter_id"] = atoi(str(p, "alterId"))
+		out["security"] = defaultStr(str(p, "cipher"), "auto")
+		if boolean(p, "tls") {
+			out["tls"] = singBoxTLS(p, str(p, "servername"))
+		}
+		setTransport(out, p)
+	case "vless":
+		out["type"] = "vless"
+		out["uuid"] = str(p, "uuid")
+		if flow := str(p, "flow"); flow != "" {
+			out["flow"] = flow
+		}
+		if boolean(p, "tls") || len(sub(p, "reality-opts")) > 0 {
+			out["tls"] = singBoxTLS(p, str(p, "servername"))
+		}
+		setTransport(out, p)
+	case "trojan":
+		out["type"] = "trojan"
+		out["password"] = str(p, "password")
+		out["tls"] = singBoxTLS(p, str(p, "sni"))
+		setTransport(out, p)
+	case "ss":
+		out["type"] = "shadowsocks"
+		out["method"] = str(p, "cipher")
+		out["password"] = str(p, "password")
+		opts := sub(p, "plugin-opts")
+		switch str(p, "plugin") {
+		case "obfs":
+			out["plugin"] = "obfs-local"
+			out["plugin_opts"] = "obfs=" + str(opts, "mode") + ";obfs-host=" + str(opts, "host")
+		case "v2ray-plugin":
+			pluginOpts := "mode=" + str(opts, "mode")
+			if boolean(opts, "tls") {
+				pluginOpts += ";tls"
+			}
+			if h := str(opts, "host"); h != "" {
+				pluginOpts += ";host=" + h
+			}
+			if path := str(opts, "path"); path != "" {
+				pluginOpts += ";path=" + path
+			}
+			out["plugin"] = "v2ray-plugin"
+			out["plugin_opts"] = pluginOpts
+		case "":
+		default:
+			return nil, fmt.Errorf("不支持 ss 插件 %s", str(p, "plugin"))
+		}
+	case "hysteria2":
+		out["type"] = "hysteria2"
+		out["password"] = str(p, "password")
+		if obfs := str(p, "obfs"); obfs != "" {
+			out["obfs"] = map[string]any{"type": obfs, "password": str(p, "obfs-password")}
+		}
+		if up := atoi(str(p, "up")); up > 0 {
+			out["up_mbps"] = up
+		}
+		if down := atoi(str(p, "down")); down > 0 {
+			out["down_mbps"] = down
+		}
+		out["tls"] = singBoxTLS(p, str(p, "sni"))
+	case "tuic":
+		out["type"] = "tuic"
+		out["uuid"] = str(p, "uuid")
+		out["password"] = str(p, "password")
+		if cc := str(p, "congestion-controller"); cc != "" {
+			out["congestion_control"] = cc
+		}
+		if mode := str(p, "udp-relay-mode"); mode != "" {
+			out["udp_relay_mode"] = mode
+		}
+		out["tls"] = singBoxTLS(p, str(p, "sni"))
+	case "wireguard":
+		out["type"] = "wireguard"
+		out["private_key"] = str(p, "private-key")
+		out["peer_public_key"] = str(p, "public-key")
+		if psk := str(p, "pre-shared-key"); psk != "" {
+			out["pre_shared_key"] = psk
+		}
+		var local []string
+		for _, key := range []string{"ip", "ipv6"} {
+			if prefix := toPrefix(str(p, key)); prefix != "" {
+				local = append(local, prefix)
+			}
+		}
+		if len(local) == 0 {
+			return nil, fmt.Errorf("wireguard 节点缺少本地地址")
+		}
+		out["local_address"] = local
+		if reserved, ok := p["reserved"].([]any); ok && len(reserved) > 0 {
+			out["reserved"] = reserved
+		}
+		if mtu := atoi(str(p, "mtu")); mtu > 0 {
+			out["mtu"] = mtu
+		}
+	default:
+		return nil, fmt.Errorf("不支持转换 %s 节点", typ)
+	}
+	return out, nil
+}
+
+// singBoxTLS 转换 tls、utls 与 reality 参数
+func singBoxTLS(p map[string]any, serverName string) map[string]any {
+	tls := map[string]any{"enabled": true}
+	if serverName != "" {
+		tls["server_name"] = serverName
+	}
+	if boolean(p, "skip-cert-verify") {
+		tls["insecure"] = true
+	}
+	if alpn := join(p, "alpn"); alpn != "" {
+		tls["alpn"] = strings.Split(alpn, ",")
+	}
+	if fp := str(p, "client-fingerprint"); fp != "" {
+		tls["utls"] = map[string]any{"enabled": true, "fingerprint": fp}
+	}
+	if reality := sub(p, "reality-opts"); len(reality) > 0 {
+		tls["reality"] = map[string]any{
+			"enabled":    true,
+			"public_key": str(reality, "public-key"),
+			"short_id":   str(reality, "short-id"),
+		}
+		// reality 需要 utls
+		if _, ok := tls["utls"]; !ok {
+			tls["utls"] = map[string]any{"enabled": true, "fingerprint": "chrome"}
+		}
+	}
+	return tls
+}
+
+// setTransport 转换 v2ray 系节点的传输层
+func setTransport(out, p map[string]any) {
+	switch str(p, "network") {
+	case "ws":
+		ws := sub(p, "ws-opts")
+		t := map[string]any{"type": "ws", "path": defaultStr(str(ws, "path"), "/")}
+		if h := str(sub(ws, "headers"), "Host"); h != "" {
+			t["headers"] = map[string]any{"Host": h}
+		}
+		out["transport"] = t
+	case "grpc":
+		out["transport"] = map[string]any{"type": "grpc", "service_name": str(sub(p, "grpc-opts"), "grpc-service-name")}
+	case "http", "h2":
+		opts := sub(p, "h2-opts")
+		host := first(opts, "host")
+		path := str(opts, "path")
+		if str(p, "network") == "http" {
+			opts = sub(p, "http-opts")
+			host = first(sub(opts, "headers"), "Host")
+			path = first(opts, "path")
+		}
+		t := map[string]any{"type": "http", "path": defaultStr(path, "/")}
+		if host != "" {
+			t["host"] = []string{host}
+		}
+		out["transport"] = t
+	case "httpupgrade":
+		opts := sub(p, "httpupgrade-opts")
+		out["transport"] = map[string]any{"type": "httpupgrade", "path": defaultStr(str(opts, "path"), "/"), "host": str(opts, "host")}
+	}
+}
+
+// toPrefix 为没有前缀长度的地址补上 /32 或 /128
+func toPrefix(s string) string {
+	if s == "" {
+		return ""
+	}
+	if strings.Contains(s, "/") {
+		return s
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return ""
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()).String()
+}
+
+// atoi 解析 "100" 或 "100 Mbps" 这类数值，无法解析时为 0
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(strings.ToLower(s)), "mbps")))
+	return n
+}
+
+func defaultStr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSingBoxOutbound(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy map[string]any
+		want  map[string]any
+	}{
+		{
+			name: "vless reality",
+			proxy: map[string]any{"name": "a", "type": "vless", "server": "example.com", "port": 443, "uuid": "u",
+				"flow": "xtls-rprx-vision", "tls": true, "servername": "www.apple.com",
+				"reality-opts": map[string]any{"public-key": "pbk", "short-id": "ab"}},
+			want: map[string]any{"type": "vless", "tag": "a", "server": "example.com", "server_port": 443, "uuid": "u",
+				"flow": "xtls-rprx-vision",
+				"tls": map[string]any{"enabled": true, "server_name": "www.apple.com",
+					"utls":    map[string]any{"enabled": true, "fingerprint": "chrome"},
+					"reality": map[string]any{"enabled": true, "public_key": "pbk", "short_id": "ab"}}},
+		},
+		{
+			name: "vmess ws",
+			proxy: map[string]any{"name": "a", "type": "vmess", "server": "1.2.3.4", "port": "80", "uuid": "u", "alterId": 0,
+				"cipher": "auto", "network": "ws", "ws-opts": map[string]any{"path": "/ws", "headers": map[string]any{"Host": "h.com"}}},
+			want: map[string]any{"type": "vmess", "tag": "a", "server": "1.2.3.4", "server_port": 80, "uuid": "u",
+				"alter_id": 0, "security": "auto",
+				"transport": map[string]any{"type": "ws", "path": "/ws", "headers": map[string]any{"Host": "h.com"}}},
+		},
+		{
+			name: "trojan",
+			proxy: map[string]any{"name": "a", "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p",
+				"sni": "example.com", "skip-cert-verify": true},
+			want: map[string]any{"type": "trojan", "tag": "a", "server": "1.2.3.4", "server_port": 443, "password": "p",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com", "insecure": true}},
+		},
+		{
+			name:  "ss",
+			proxy: map[string]any{"name": "a", "type": "ss", "server": "1.2.3.4", "port": 8388, "cipher": "aes-128-gcm", "password": "p"},
+			want:  map[string]any{"type": "shadowsocks", "tag": "a", "server": "1.2.3.4", "server_port": 8388, "method": "aes-128-gcm", "password": "p"},
+		},
+		{
+			name: "hysteria2",
+			proxy: map[string]any{"name": "a", "type": "hysteria2", "server": "1.2.3.4", "port": 443, "password": "p",
+				"obfs": "salamander", "obfs-password": "o", "up": "50 Mbps", "sni": "example.com"},
+			want: map[string]any{"type": "hysteria2", "tag": "a", "server": "1.2.3.4", "server_port": 443, "password": "p",
+				"obfs": map[string]any{"type": "salamander", "password": "o"}, "up_mbps": 50,
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"}},
+		},
+		{
+			name: "tuic",
+			proxy: map[string]any{"name": "a", "type": "tuic", "server": "1.2.3.4", "port": 443, "uuid": "u", "password": "p",
+				"congestion-controller": "bbr", "alpn": []any{"h3"}, "sni": "example.com"},
+			want: map[string]any{"type": "tuic", "tag": "a", "server": "1.2.3.4", "server_port": 443, "uuid": "u", "password": "p",
+				"congestion_control": "bbr",
+				"tls":                map[string]any{"enabled": true, "server_name": "example.com", "alpn": []string{"h3"}}},
+		},
+		{
+			name: "wireguard",
+			proxy: map[string]any{"name": "a", "type": "wireguard", "server": "1.2.3.4", "port": 51820, "ip": "172.16.0.2",
+				"ipv6": "2606:4700::2", "private-key": "priv", "public-key": "pub", "mtu": 1280},
+			want: map[string]any{"type": "wireguard", "tag": "a", "server": "1.2.3.4", "server_port": 51820,
+				"local_address": []string{"172.16.0.2/32", "2606:4700::2/128"}, "private_key": "priv", "peer_public_key": "pub", "mtu": 1280},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SingBoxOutbound(tt.proxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SingBoxOutbound() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSingBoxOutboundUnsupported(t *testing.T) {
+	if _, err := SingBoxOutbound(map[string]any{"name": "a", "type": "snell", "server": "1.2.3.4", "port": 443}); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+}
+
+func TestSingBox(t *testing.T) {
+	proxies := []map[string]any{
+		{"name": "jp", "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p"},
+		{"name": "us", "type": "trojan", "server": "1.2.3.5", "port": 443, "password": "p"},
+		{"name": "bad", "type": "snell", "server": "1.2.3.6", "port": 443},
+	}
+	groups := []Group{
+		{Tag: "JP", Type: GroupURLTest, Members: []string{"jp"}},
+		{Tag: "Netflix", Type: GroupSelector, Members: []string{"us", "bad"}},
+		{Tag: "Gemini", Type: GroupSelector},
+		{Tag: "auto", Type: GroupSelector, Members: []string{"jp"}},
+	}
+	data, err := SingBox(proxies, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Outbounds []struct {
+			Type      string   `json:"type"`
+			Tag       string   `json:"tag"`
+			Outbounds []string `json:"outbounds"`
+		} `json:"outbounds"`
+		Route struct {
+			Final string `json:"final"`
+		} `json:"route"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	var tags []string
+	for _, o := range config.Outbounds {
+		tags = append(tags, o.Tag)
+		got[o.Tag] = o.Outbounds
+	}
+	wantTags := []string{"proxy", "auto", "JP", "Netflix", "jp", "us", "direct"}
+	if !reflect.DeepEqual(tags, wantTags) {
+		t.Errorf("outbound tags = %v, want %v", tags, wantTags)
+	}
+	want := map[string][]string{
+		"proxy":   {"auto", "JP", "Netflix", "jp", "us"},
+		"auto":    {"jp", "us"},
+		"JP":      {"jp"},
+		"Netflix": {"us"},
+	}
+	for tag, w := range want {
+		if !reflect.DeepEqual(got[tag], w) {
+			t.Errorf("%s outbounds = %v, want %v", tag, got[tag], w)
+		}
+	}
+	if config.Route.Final != "proxy" {
+		t.Errorf("route.final = %q, want proxy", config.Route.Final)
+	}
+}
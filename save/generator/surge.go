@@ -0,0 +1,184 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// surgeName Surge 配置以逗号和等号分隔，名称中的这两个字符替换为空格
+var surgeName = strings.NewReplacer(",", " ", "=", " ")
+
+// Surge 生成 Surge 配置，不支持的节点(如 vless)跳过
+func Surge(proxies []map[string]any, groups []Group) ([]byte, error) {
+	var lines []string
+	var names []string
+	seen := make(map[string]bool, len(proxies))
+	for _, p := range proxies {
+		line, err := SurgeProxy(p)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("转换 Surge 节点失败 %v: %v", p["name"], err))
+			continue
+		}
+		name := surgeName.Replace(str(p, "name"))
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		lines = append(lines, line)
+		names = append(names, name)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("没有可转换为 Surge 节点的节点")
+	}
+
+	var groupLines []string
+	groupNames := []string{"Auto"}
+	for _, g := range groups {
+		tag := surgeName.Replace(g.Tag)
+		var members []string
+		for _, m := range g.Members {
+			if m = surgeName.Replace(m); seen[m] {
+				members = append(members, m)
+			}
+		}
+		if len(members) == 0 || seen[tag] || tag == "PROXY" || tag == "Auto" {
+			continue
+		}
+		groupLines = append(groupLines, surgeGroup(tag, g.Type, members))
+		groupNames = append(groupNames, tag)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("[General]\n")
+	b.WriteString("loglevel = notify\n")
+	b.WriteString("skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, localhost, *.local\n")
+	b.WriteString("dns-server = system, 223.5.5.5, 119.29.29.29\n\n")
+	b.WriteString("[Proxy]\n")
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n[Proxy Group]\n")
+	b.WriteString(surgeGroup("PROXY", GroupSelector, append(groupNames, names...)) + "\n")
+	b.WriteString(surgeGroup("Auto", GroupURLTest, names) + "\n")
+	for _, line := range groupLines {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n[Rule]\n")
+	b.WriteString("GEOIP,CN,DIRECT\n")
+	b.WriteString("FINAL,PROXY\n")
+	return b.Bytes(), nil
+}
+
+func surgeGroup(name, typ string, members []string) string {
+	if typ == GroupURLTest {
+		return name + " = url-test, " + strings.Join(members, ", ") + ", url=http://www.gstatic.com/generate_204, interval=300, tolerance=50"
+	}
+	return name + " = select, " + strings.Join(members, ", ")
+}
+
+// SurgeProxy 将 mihomo 节点转换为 Surge 的 [Proxy] 行
+func SurgeProxy(p map[string]any) (string, error) {
+	server, port := str(p, "server"), str(p, "port")
+	var parts []string
+	switch typ := str(p, "type"); typ {
+	case "ss":
+		parts = []string{"ss", server, port, "encrypt-method=" + str(p, "cipher"), "password=" + str(p, "password")}
+		switch str(p, "plugin") {
+		case "obfs":
+			opts := sub(p, "plugin-opts")
+			parts = append(parts, "obfs="+str(opts, "mode"))
+			if h := str(opts, "host"); h != "" {
+				parts = append(parts, "obfs-host="+h)
+			}
+		case "":
+		default:
+			return "", fmt.Errorf("Surge 不支持 ss 插件 %s", str(p, "plugin"))
+		}
+	case "vmess":
+		parts = []string{"vmess", server, port, "username=" + str(p, "uuid")}
+		if atoi(str(p, "alterId")) == 0 {
+			parts = append(parts, "vmess-aead=true")
+		}
+		if boolean(p, "tls") {
+			parts = append(parts, "tls=true")
+			parts = surgeTLS(parts, p, str(p, "servername"))
+		}
+		var err error
+		if parts, err = surgeTransport(parts, p); err != nil {
+			return "", err
+		}
+	case "trojan":
+		parts = []string{"trojan", server, port, "password=" + str(p, "password")}
+		parts = surgeTLS(parts, p, str(p, "sni"))
+		var err error
+		if parts, err = surgeTransport(parts, p); err != nil {
+			return "", err
+		}
+	case "hysteria2":
+		parts = []string{"hysteria2", server, port, "password=" + str(p, "password")}
+		if down := atoi(str(p, "down")); down > 0 {
+			parts = append(parts, fmt.Sprintf("download-bandwidth=%d", down))
+		}
+		parts = surgeTLS(parts, p, str(p, "sni"))
+	case "tuic":
+		parts = []string{"tuic-v5", server, port, "password=" + str(p, "password"), "uuid=" + str(p, "uuid")}
+		if alpn := join(p, "alpn"); alpn != "" {
+			parts = append(parts, "alpn="+strings.Split(alpn, ",")[0])
+		}
+		parts = surgeTLS(parts, p, str(p, "sni"))
+	case "snell":
+		parts = []string{"snell", server, port, "psk=" + str(p, "psk")}
+		if v := str(p, "version"); v != "" {
+			parts = append(parts, "version="+v)
+		}
+		if opts := sub(p, "obfs-opts"); str(opts, "mode") != "" {
+			parts = append(parts, "obfs="+str(opts, "mode"))
+			if h := str(opts, "host"); h != "" {
+				parts = append(parts, "obfs-host="+h)
+			}
+		}
+	case "socks5", "http":
+		scheme := typ
+		if boolean(p, "tls") {
+			scheme = map[string]string{"socks5": "socks5-tls", "http": "https"}[typ]
+		}
+		parts = []string{scheme, server, port}
+		if u := str(p, "username"); u != "" {
+			parts = append(parts, u, str(p, "password"))
+		}
+		if boolean(p, "tls") {
+			parts = surgeTLS(parts, p, str(p, "sni"))
+		}
+	default:
+		return "", fmt.Errorf("Surge 不支持 %s 节点", typ)
+	}
+	return surgeName.Replace(str(p, "name")) + " = " + strings.Join(parts, ", "), nil
+}
+
+func surgeTLS(parts []string, p map[string]any, sni string) []string {
+	if sni != "" {
+		parts = append(parts, "sni="+sni)
+	}
+	if boolean(p, "skip-cert-verify") {
+		parts = append(parts, "skip-cert-verify=true")
+	}
+	return parts
+}
+
+// surgeTransport Surge 只支持 tcp 与 websocket 传输
+func surgeTransport(parts []string, p map[string]any) ([]string, error) {
+	switch network := str(p, "network"); network {
+	case "", "tcp":
+	case "ws":
+		ws := sub(p, "ws-opts")
+		parts = append(parts, "ws=true", "ws-path="+defaultStr(str(ws, "path"), "/"))
+		if h := str(sub(ws, "headers"), "Host"); h != "" {
+			parts = append(parts, "ws-headers=Host:"+h)
+		}
+	default:
+		return nil, fmt.Errorf("Surge 不支持 %s 传输", network)
+	}
+	return parts, nil
+}
@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSurgeProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxy   map[string]any
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "ss obfs",
+			proxy: map[string]any{"name": "a,b", "type": "ss", "server": "1.2.3.4", "port": 8388, "cipher": "aes-128-gcm", "password": "p", "plugin": "obfs", "plugin-opts": map[string]any{"mode": "http", "host": "bing.com"}},
+			want:  "a b = ss, 1.2.3.4, 8388, encrypt-method=aes-128-gcm, password=p, obfs=http, obfs-host=bing.com",
+		},
+		{
+			name:  "vmess ws tls",
+			proxy: map[string]any{"name": "a", "type": "vmess", "server": "1.2.3.4", "port": 443, "uuid": "u", "alterId": 0, "tls": true, "servername": "h.com", "network": "ws", "ws-opts": map[string]any{"path": "/ws"}},
+			want:  "a = vmess, 1.2.3.4, 443, username=u, vmess-aead=true, tls=true, sni=h.com, ws=true, ws-path=/ws",
+		},
+		{
+			name:  "trojan",
+			proxy: map[string]any{"name": "a", "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p", "sni": "h.com", "skip-cert-verify": true},
+			want:  "a = trojan, 1.2.3.4, 443, password=p, sni=h.com, skip-cert-verify=true",
+		},
+		{
+			name:  "tuic",
+			proxy: map[string]any{"name": "a", "type": "tuic", "server": "1.2.3.4", "port": 443, "uuid": "u", "password": "p", "alpn": []any{"h3"}},
+			want:  "a = tuic-v5, 1.2.3.4, 443, password=p, uuid=u, alpn=h3",
+		},
+		{
+			name:  "https",
+			proxy: map[string]any{"name": "a", "type": "http", "server": "1.2.3.4", "port": 443, "tls": true, "username": "u", "password": "p"},
+			want:  "a = https, 1.2.3.4, 443, u, p",
+		},
+		{
+			name:    "vless unsupported",
+			proxy:   map[string]any{"name": "a", "type": "vless", "server": "1.2.3.4", "port": 443, "uuid": "u"},
+			wantErr: true,
+		},
+		{
+			name:    "grpc unsupported",
+			proxy:   map[string]any{"name": "a", "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p", "network": "grpc"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SurgeProxy(tt.proxy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SurgeProxy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SurgeProxy() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSurge(t *testing.T) {
+	proxies := []map[string]any{
+		{"name": "a", "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p"},
+		{"name": "b", "type": "vless", "server": "1.2.3.4", "port": 443, "uuid": "u"},
+	}
+	data, err := Surge(proxies, []Group{{Tag: "JP", Type: GroupURLTest, Members: []string{"a", "b"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"[Proxy]\na = trojan, 1.2.3.4, 443, password=p\n",
+		"PROXY = select, Auto, JP, a\n",
+		"JP = url-test, a, url=",
+		"FINAL,PROXY",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Surge() missing %q in\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package save
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	proxyutils "github.com/twj0/subcheck/proxy"
+	"github.com/twj0/subcheck/save/generator"
+)
+
+// lowRiskGroup 低风险 IP 分组的名称
+const lowRiskGroup = "🛡️ 低风险IP"
+
+// resultGroups 根据检测结果生成分组: 每个国家一个 url-test 组、
+// 每个解锁平台一个 select 组，以及一个低风险 IP 的 url-test 组
+func resultGroups(results []check.Result) []generator.Group {
+	byCountry := make(map[string][]string)
+	for _, r := range results {
+		if country := strings.ToUpper(r.Country); len(country) == 2 {
+			byCountry[country] = append(byCountry[country], fmt.Sprint(r.Proxy["name"]))
+		}
+	}
+	countries := make([]string, 0, len(byCountry))
+	for c := range byCountry {
+		countries = append(countries, c)
+	}
+	sort.Strings(countries)
+
+	groups := make([]generator.Group, 0, len(countries)+len(groupPlatforms)+1)
+	for _, c := range countries {
+		groups = append(groups, generator.Group{Tag: proxyutils.CountryCodeToFlag(c) + " " + c, Type: generator.GroupURLTest, Members: byCountry[c]})
+	}
+	for _, platform := range groupPlatforms {
+		var members []string
+		for _, r := range results {
+			if platform.unlock(r) {
+				members = append(members, fmt.Sprint(r.Proxy["name"]))
+			}
+		}
+		groups = append(groups, generator.Group{Tag: "📺 " + platform.tag, Type: generator.GroupSelector, Members: members})
+	}
+
+	var lowRisk []string
+	for _, r := range results {
+		if score := riskScore(r); score >= 0 && score <= config.GlobalConfig.AutoGroups.LowRiskMax {
+			lowRisk = append(lowRisk, fmt.Sprint(r.Proxy["name"]))
+		}
+	}
+	groups = append(groups, generator.Group{Tag: lowRiskGroup, Type: generator.GroupURLTest, Members: lowRisk})
+	return groups
+}
+
+// withGroups 将根据检测结果生成的分组合并到 mihomo 配置中，未开启或失败时原样返回
+func (cs *ConfigSaver) withGroups(data []byte) []byte {
+	if !config.GlobalConfig.AutoGroups.Enabled {
+		return data
+	}
+	merged, err := generator.MergeGroups(data, resultGroups(cs.results))
+	if err != nil {
+		slog.Debug("合并自动生成的策略组失败，保持原配置", "error", err)
+		return data
+	}
+	return merged
+}
@@ -0,0 +1,52 @@
+package save
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/save/generator"
+)
+
+func TestResultGroups(t *testing.T) {
+	results := []check.Result{
+		{Proxy: map[string]any{"name": "a"}, Country: "jp", Netflix: true, IPRisk: "10%"},
+		{Proxy: map[string]any{"name": "b"}, Country: "US", Openai: true, Youtube: "US", IPRisk: "80%"},
+		{Proxy: map[string]any{"name": "c"}, Country: "JP", Netflix: true, Disney: true},
+		{Proxy: map[string]any{"name": "d"}},
+	}
+	got := make(map[string]generator.Group)
+	var tags []string
+	for _, g := range resultGroups(results) {
+		got[g.Tag] = g
+		tags = append(tags, g.Tag)
+	}
+	if tags[0] != "🇯🇵 JP" || tags[1] != "🇺🇸 US" {
+		t.Errorf("country groups should come first in order, got %v", tags)
+	}
+	tests := []struct {
+		tag     string
+		typ     string
+		members []string
+	}{
+		{"🇯🇵 JP", generator.GroupURLTest, []string{"a", "c"}},
+		{"🇺🇸 US", generator.GroupURLTest, []string{"b"}},
+		{"📺 Netflix", generator.GroupSelector, []string{"a", "c"}},
+		{"📺 Disney+", generator.GroupSelector, []string{"c"}},
+		{"📺 OpenAI", generator.GroupSelector, []string{"b"}},
+		{"📺 YouTube", generator.GroupSelector, []string{"b"}},
+		{"📺 Gemini", generator.GroupSelector, nil},
+		{lowRiskGroup, generator.GroupURLTest, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			g, ok := got[tt.tag]
+			if !ok {
+				t.Fatalf("group %s missing", tt.tag)
+			}
+			if g.Type != tt.typ || !reflect.DeepEqual(g.Members, tt.members) {
+				t.Errorf("group %s = %s %v, want %s %v", tt.tag, g.Type, g.Members, tt.typ, tt.members)
+			}
+		})
+	}
+}
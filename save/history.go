@@ -0,0 +1,100 @@
+package save
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/save/method"
+)
+
+// OutputFile 本次发布的订阅文件
+type OutputFile struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// checkDrop 与上一个历史版本比较，节点数量下降超过 max-drop-percent 时拒绝发布
+func (cs *ConfigSaver) checkDrop() error {
+	maxDrop := config.GlobalConfig.MaxDropPercent
+	if maxDrop <= 0 || len(cs.results) == 0 {
+		return nil
+	}
+	saver, err := method.NewLocalSaver()
+	if err != nil {
+		return nil
+	}
+	list, err := saver.ListGenerations()
+	if err != nil || len(list) == 0 || list[0].Nodes == 0 {
+		return nil
+	}
+	prev, cur := list[0].Nodes, len(cs.results)
+	if drop := (prev - cur) * 100 / prev; drop > maxDrop {
+		return fmt.Errorf("节点数量从 %d 降到 %d，下降 %d%% 超过 max-drop-percent(%d%%)，拒绝发布，保留上一版本 %s", prev, cur, drop, maxDrop, list[0].ID)
+	}
+	return nil
+}
+
+// saveGeneration 将本次写入的文件保存为一个历史版本
+func (cs *ConfigSaver) saveGeneration() {
+	keep := config.GlobalConfig.OutputHistory
+	if keep <= 0 || len(cs.written) == 0 {
+		return
+	}
+	saver, err := method.NewLocalSaver()
+	if err != nil {
+		slog.Error(fmt.Sprintf("保存历史版本失败: %v", err))
+		return
+	}
+	names := make([]string, 0, len(cs.written))
+	for _, f := range cs.written {
+		names = append(names, f.Name)
+	}
+	g, err := saver.SaveGeneration(names, len(cs.results), keep)
+	if err != nil {
+		slog.Error(fmt.Sprintf("保存历史版本失败: %v", err))
+		return
+	}
+	slog.Info(fmt.Sprintf("已保存历史版本 %s，节点数量: %d", g.ID, g.Nodes))
+}
+
+// ListGenerations 列出本地输出的历史版本，最新的在前
+func ListGenerations() ([]method.Generation, error) {
+	saver, err := method.NewLocalSaver()
+	if err != nil {
+		return nil, err
+	}
+	return saver.ListGenerations()
+}
+
+// Rollback 将历史版本的文件重新发布到所有保存方法，并记录为一个新的历史版本
+func Rollback(id string) (*method.Generation, error) {
+	saver, err := method.NewLocalSaver()
+	if err != nil {
+		return nil, err
+	}
+	g, files, err := saver.LoadGeneration(id)
+	if err != nil {
+		return nil, err
+	}
+	cs := &ConfigSaver{saveMethods: chooseSaveMethods()}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		cs.write(files[name], name)
+	}
+	slog.Info(fmt.Sprintf("已回滚到历史版本 %s，节点数量: %d", g.ID, g.Nodes))
+
+	// 历史版本列表的第一个始终是当前发布的文件，之后的 max-drop-percent 以它为准
+	if keep := config.GlobalConfig.OutputHistory; keep > 0 {
+		if _, err := saver.SaveGeneration(names, g.Nodes, keep); err != nil {
+			slog.Error(fmt.Sprintf("保存历史版本失败: %v", err))
+		}
+	}
+	return g, nil
+}
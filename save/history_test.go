@@ -0,0 +1,90 @@
+package save
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/save/method"
+)
+
+func TestCheckDrop(t *testing.T) {
+	old := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = old })
+	config.GlobalConfig = &config.Config{OutputDir: t.TempDir()}
+
+	saver, err := method.NewLocalSaver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saver.Save([]byte("proxies: []"), "all.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saver.SaveGeneration([]string{"all.yaml"}, 100, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		maxDrop int
+		nodes   int
+		wantErr bool
+	}{
+		{"disabled", 0, 1, false},
+		{"within limit", 50, 50, false},
+		{"over limit", 50, 49, true},
+		{"growth", 50, 150, false},
+		{"no results", 50, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.GlobalConfig.MaxDropPercent = tt.maxDrop
+			cs := &ConfigSaver{results: make([]check.Result, tt.nodes)}
+			if err := cs.checkDrop(); (err != nil) != tt.wantErr {
+				t.Errorf("checkDrop() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	old := config.GlobalConfig
+	t.Cleanup(func() { config.GlobalConfig = old })
+	config.GlobalConfig = &config.Config{OutputDir: t.TempDir(), OutputHistory: 5, SaveMethod: "local"}
+
+	saver, err := method.NewLocalSaver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i, data := range []string{"proxies: [a]", "proxies: [b]"} {
+		if err := saver.Save([]byte(data), "all.yaml"); err != nil {
+			t.Fatal(err)
+		}
+		g, err := saver.SaveGeneration([]string{"all.yaml"}, i+1, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, g.ID)
+		// 版本ID精确到毫秒
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if _, err := Rollback(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	// 回滚后的文件记录为最新的历史版本
+	list, err := ListGenerations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Nodes != 1 || slices.Contains(ids, list[0].ID) {
+		t.Fatalf("generations after rollback = %+v", list)
+	}
+	_, files, err := saver.LoadGeneration(list[0].ID)
+	if err != nil || string(files["all.yaml"]) != "proxies: [a]" {
+		t.Errorf("latest generation = %q, %v", files["all.yaml"], err)
+	}
+}
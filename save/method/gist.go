@@ -51,10 +51,10 @@ func NewGistUploader() *GistUploader {
 	}
 }
 
-// UploadToGist 上传数据到 Gist 的入口函数（仅上传 mihomo.yaml）
+// UploadToGist 上传数据到 Gist 的入口函数（仅上传 mihomo.yaml 与 sing-box.json）
 func UploadToGist(yamlData []byte, filename string) error {
-	// 只上传 mihomo.yaml 到远程 Gist
-	if filename != "mihomo.yaml" {
+	// 只上传 mihomo.yaml 与 sing-box.json 到远程 Gist
+	if !remoteFiles[filename] {
 		return nil
 	}
 	uploader := NewGistUploader()
@@ -0,0 +1,126 @@
+package method
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// HistoryDirName 输出目录下保存历史版本的目录，不通过 /sub/ 对外提供
+const HistoryDirName = "history"
+
+const generationMetaFile = "generation.json"
+
+// Generation 一次发布的输出文件快照
+type Generation struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Nodes int       `json:"nodes"` // 本次发布的节点数量
+	Files []string  `json:"files"`
+}
+
+// HistoryPath 历史版本目录
+func (ls *LocalSaver) HistoryPath() string {
+	return filepath.Join(ls.OutputPath, HistoryDirName)
+}
+
+// SaveGeneration 将本次写入输出目录的文件复制到 history/<id>/，只保留最近 keep 个版本
+func (ls *LocalSaver) SaveGeneration(files []string, nodes, keep int) (*Generation, error) {
+	now := time.Now()
+	g := &Generation{ID: now.Format("20060102-150405.000"), Time: now, Nodes: nodes, Files: files}
+	dir := filepath.Join(ls.HistoryPath(), g.ID)
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, fmt.Errorf("创建历史版本目录失败: %w", err)
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(ls.OutputPath, name))
+		if err != nil {
+			return nil, fmt.Errorf("读取输出文件失败 [%s]: %w", name, err)
+		}
+		if err := writeFileAtomic(filepath.Join(dir, name), data); err != nil {
+			return nil, fmt.Errorf("写入历史版本失败 [%s]: %w", name, err)
+		}
+	}
+	meta, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// 元数据最后写入，没有元数据的目录视为不完整的版本
+	if err := writeFileAtomic(filepath.Join(dir, generationMetaFile), meta); err != nil {
+		return nil, fmt.Errorf("写入历史版本元数据失败: %w", err)
+	}
+	return g, ls.pruneGenerations(keep)
+}
+
+// ListGenerations 列出所有完整的历史版本，最新的在前
+func (ls *LocalSaver) ListGenerations() ([]Generation, error) {
+	entries, err := os.ReadDir(ls.HistoryPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Generation
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(ls.HistoryPath(), e.Name(), generationMetaFile))
+		if err != nil {
+			continue
+		}
+		var g Generation
+		if err := json.Unmarshal(data, &g); err != nil || g.ID != e.Name() {
+			continue
+		}
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+// LoadGeneration 读取历史版本中的所有文件
+func (ls *LocalSaver) LoadGeneration(id string) (*Generation, map[string][]byte, error) {
+	if filepath.Base(id) != id || id == "." || id == ".." {
+		return nil, nil, fmt.Errorf("无效的版本: %s", id)
+	}
+	dir := filepath.Join(ls.HistoryPath(), id)
+	data, err := os.ReadFile(filepath.Join(dir, generationMetaFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("历史版本 %s 不存在", id)
+	}
+	var g Generation
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, nil, fmt.Errorf("解析历史版本 %s 失败: %w", id, err)
+	}
+	files := make(map[string][]byte, len(g.Files))
+	for _, name := range g.Files {
+		if filepath.Base(name) != name {
+			return nil, nil, fmt.Errorf("历史版本 %s 包含非法文件名: %s", id, name)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取历史版本文件失败 [%s]: %w", name, err)
+		}
+		files[name] = data
+	}
+	return &g, files, nil
+}
+
+// pruneGenerations 删除超出保留数量的旧版本
+func (ls *LocalSaver) pruneGenerations(keep int) error {
+	list, err := ls.ListGenerations()
+	if err != nil || len(list) <= keep {
+		return err
+	}
+	for _, g := range list[keep:] {
+		if err := os.RemoveAll(filepath.Join(ls.HistoryPath(), g.ID)); err != nil {
+			return fmt.Errorf("删除旧的历史版本失败 [%s]: %w", g.ID, err)
+		}
+	}
+	return nil
+}
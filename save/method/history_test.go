@@ -0,0 +1,85 @@
+package method
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerations(t *testing.T) {
+	ls := &LocalSaver{OutputPath: t.TempDir()}
+
+	var ids []string
+	for i, content := range []string{"v1", "v2", "v3"} {
+		if err := ls.Save([]byte(content), "mihomo.yaml"); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		g, err := ls.SaveGeneration([]string{"mihomo.yaml"}, i+1, 2)
+		if err != nil {
+			t.Fatalf("SaveGeneration: %v", err)
+		}
+		ids = append(ids, g.ID)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	list, err := ls.ListGenerations()
+	if err != nil {
+		t.Fatalf("ListGenerations: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != ids[2] || list[1].ID != ids[1] {
+		t.Fatalf("generations = %+v, want newest two of %v", list, ids)
+	}
+	if list[0].Nodes != 3 {
+		t.Errorf("nodes = %d, want 3", list[0].Nodes)
+	}
+
+	g, files, err := ls.LoadGeneration(ids[1])
+	if err != nil {
+		t.Fatalf("LoadGeneration: %v", err)
+	}
+	if g.Nodes != 2 || string(files["mihomo.yaml"]) != "v2" {
+		t.Errorf("generation %s = %+v %q", ids[1], g, files["mihomo.yaml"])
+	}
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"pruned", ids[0]},
+		{"path traversal", "../output"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ls.LoadGeneration(tt.id); err == nil {
+				t.Errorf("LoadGeneration(%q) succeeded", tt.id)
+			}
+		})
+	}
+
+	// 没有元数据的目录视为不完整的版本
+	if err := os.MkdirAll(filepath.Join(ls.HistoryPath(), "99999999-999999.999"), dirMode); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := ls.ListGenerations(); len(list) != 2 {
+		t.Errorf("incomplete generation listed: %+v", list)
+	}
+}
+
+func TestSaveAtomic(t *testing.T) {
+	ls := &LocalSaver{OutputPath: t.TempDir()}
+	for _, content := range []string{"old", "new"} {
+		if err := ls.Save([]byte(content), "all.yaml"); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(ls.OutputPath, "all.yaml"))
+	if err != nil || string(data) != "new" {
+		t.Fatalf("all.yaml = %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(ls.OutputPath)
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
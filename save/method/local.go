@@ -67,7 +67,7 @@ func (ls *LocalSaver) Save(yamlData []byte, filename string) error {
 	// 构建文件路径并保存
 	filepath := filepath.Join(ls.OutputPath, filename)
 
-	if err := os.WriteFile(filepath, yamlData, fileMode); err != nil {
+	if err := writeFileAtomic(filepath, yamlData); err != nil {
 		return fmt.Errorf("写入文件失败 [%s]: %w", filename, err)
 	}
 	slog.Info("保存本地成功", "filepath", filepath)
@@ -75,6 +75,43 @@ func (ls *LocalSaver) Save(yamlData []byte, filename string) error {
 	return nil
 }
 
+// writeFileAtomic 先写入同目录下的临时文件再重命名，避免中途崩溃留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// 重命名成功后临时文件已不存在，删除失败可以忽略
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Remove 删除输出目录中的文件，文件不存在时忽略
+func (ls *LocalSaver) Remove(filename string) error {
+	if filename == "" || filepath.Base(filename) != filename {
+		return fmt.Errorf("filename包含非法字符: %s", filename)
+	}
+	if err := os.Remove(filepath.Join(ls.OutputPath, filename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // ensureOutputDir 确保输出目录存在
 func (ls *LocalSaver) ensureOutputDir() error {
 	if _, err := os.Stat(ls.OutputPath); os.IsNotExist(err) {
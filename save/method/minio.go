@@ -31,8 +31,8 @@ func ValiS3Config() error {
 // UploadToS3 uploads data to a MinIO bucket.
 // The 'filename' parameter will be used as the object name in the bucket.
 func UploadToS3(data []byte, filename string) error {
-	// 只上传 mihomo.yaml 到远程存储
-	if filename != "mihomo.yaml" {
+	// 只上传 mihomo.yaml 与 sing-box.json 到远程存储
+	if !remoteFiles[filename] {
 		return nil
 	}
 	
@@ -0,0 +1,7 @@
+package method
+
+// remoteFiles 上传到远程存储的文件，其余格式只保存在本地
+var remoteFiles = map[string]bool{
+	"mihomo.yaml":   true,
+	"sing-box.json": true,
+}
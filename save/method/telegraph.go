@@ -42,8 +42,12 @@ type TelegraphPayload struct {
 
 // UploadToTelegraph 上传数据到 Telegraph
 func UploadToTelegraph(data []byte, filename string) error {
-	// 只上传 mihomo.yaml 到远程存储
-	if filename != "mihomo.yaml" {
+	// 只上传 mihomo.yaml 与 sing-box.json 到远程存储
+	if !remoteFiles[filename] {
+		return nil
+	}
+	// 配置了固定页面时只有一个页面可编辑，只上传 mihomo.yaml
+	if config.GlobalConfig.TelegraphPath != "" && filename != "mihomo.yaml" {
 		return nil
 	}
 	
@@ -37,8 +37,8 @@ func NewWebDAVUploader() *WebDAVUploader {
 
 // UploadToWebDAV 上传数据到 WebDAV 的入口函数
 func UploadToWebDAV(yamlData []byte, filename string) error {
-	// 只上传 mihomo.yaml 到远程存储
-	if filename != "mihomo.yaml" {
+	// 只上传 mihomo.yaml 与 sing-box.json 到远程存储
+	if !remoteFiles[filename] {
 		return nil
 	}
 	
@@ -1,13 +1,22 @@
 package save
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/twj0/subcheck/assets"
 	"github.com/twj0/subcheck/check"
 	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/save/generator"
 	"github.com/twj0/subcheck/save/method"
 	"github.com/twj0/subcheck/utils"
 	"gopkg.in/yaml.v3"
@@ -18,6 +27,9 @@ type ProxyCategory struct {
 	Name    string                     // 分类名称
 	Proxies []map[string]any           // 该分类下的代理列表
 	Filter  func(result check.Result) bool // 用于过滤代理的函数
+	Less    func(a, b check.Result) bool   // 排序函数，为 nil 时保持检测顺序
+	Limit   int                            // 最多保留的节点数量，0 为不限制
+	Custom  bool                           // 是否为 outputs 配置的自定义输出分类
 }
 
 // ConfigSaver 处理配置保存的结构体
@@ -25,6 +37,7 @@ type ConfigSaver struct {
 	results     []check.Result         // 检查结果列表
 	categories  []ProxyCategory        // 代理分类列表
 	saveMethods []func([]byte, string) error // 保存方法列表
+	written     []OutputFile                   // 本次写入的文件，用于保存历史版本与 webhook
 }
 
 // NewConfigSaver 创建新的配置保存器
@@ -40,7 +53,7 @@ type ConfigSaver struct {
 // 返回值:
 //   - *ConfigSaver: 指向新创建的 ConfigSaver 实例的指针
 func NewConfigSaver(results []check.Result) *ConfigSaver {
-	return &ConfigSaver{
+	cs := &ConfigSaver{
 		results:     results, // 将传入的检查结果赋值给 ConfigSaver 的 results 字段
 		saveMethods: chooseSaveMethods(), // 调用 chooseSaveMethods 函数选择保存方法
 		categories: []ProxyCategory{ // 初始化代理分类切片，包含三个默认分类
@@ -59,19 +72,116 @@ func NewConfigSaver(results []check.Result) *ConfigSaver {
 				Proxies: make([]map[string]any, 0), // 初始化空代理列表
 				Filter:  func(result check.Result) bool { return true }, // 过滤函数，接受所有代理
 			},
+			{
+				Name:    "links.txt", // 分类名称，表示每行一个分享链接的列表
+				Proxies: make([]map[string]any, 0), // 初始化空代理列表
+				Filter:  func(result check.Result) bool { return true }, // 过滤函数，接受所有代理
+			},
+			{
+				Name:    "sing-box.json", // 分类名称，表示 sing-box 的配置文件
+				Proxies: make([]map[string]any, 0), // 初始化空代理列表
+				Filter:  func(result check.Result) bool { return true }, // 过滤函数，接受所有代理
+			},
 		},
 	}
+	cs.categories = append(cs.categories, outputCategories()...)
+	return cs
+}
+
+// builtinOutputs 内置的订阅文件，自定义输出分类生成的文件不能与之重名
+var builtinOutputs = []string{"all.yaml", "mihomo.yaml", "base64.txt", "links.txt", "sing-box.json", "clash_template.yaml"}
+
+// categoryFiles 自定义输出分类生成的所有文件
+func categoryFiles(name string) []string {
+	return []string{name + ".yaml", name + "-mihomo.yaml", name + "-base64.txt", name + "-links.txt", name + "-sing-box.json"}
+}
+
+// outputSet 记录已经被占用的文件名
+type outputSet map[string]string
+
+func newOutputSet() outputSet {
+	used := make(outputSet)
+	for _, name := range builtinOutputs {
+		used[name] = "内置订阅"
+	}
+	return used
+}
+
+// add 检查一个自定义输出分类，通过时记录它生成的文件并返回分类名称
+func (used outputSet) add(o config.OutputConfig) (string, error) {
+	name := strings.TrimSuffix(strings.TrimSpace(o.Name), ".yaml")
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("outputs 中的名称无效: %q", o.Name)
+	}
+	files := categoryFiles(name)
+	for _, f := range files {
+		if owner, ok := used[f]; ok {
+			return "", fmt.Errorf("outputs %s 生成的 %s 与%s重名", name, f, owner)
+		}
+	}
+	if _, err := ParseFilter(o.Filter); err != nil {
+		return "", fmt.Errorf("outputs %s 的过滤表达式无效: %w", name, err)
+	}
+	if _, err := ParseSort(o.Sort); err != nil {
+		return "", fmt.Errorf("outputs %s 的排序方式无效: %w", name, err)
+	}
+	for _, f := range files {
+		used[f] = fmt.Sprintf("输出分类 %s", name)
+	}
+	return name, nil
+}
+
+// ValidateOutputs 检查 outputs 配置，名称不能为空或包含路径，
+// 生成的文件不能与内置订阅或其他分类的文件重名，过滤表达式与排序方式必须有效
+func ValidateOutputs(outputs []config.OutputConfig) error {
+	used := newOutputSet()
+	var errs []error
+	for _, o := range outputs {
+		if _, err := used.add(o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// outputCategories 根据 outputs 配置生成自定义输出分类，配置错误的分类跳过
+func outputCategories() []ProxyCategory {
+	var categories []ProxyCategory
+	used := newOutputSet()
+	for _, o := range config.GlobalConfig.Outputs {
+		name, err := used.add(o)
+		if err != nil {
+			slog.Error(fmt.Sprintf("%v，跳过", err))
+			continue
+		}
+		filter, _ := ParseFilter(o.Filter)
+		less, _ := ParseSort(o.Sort)
+		categories = append(categories, ProxyCategory{
+			Name:    name + ".yaml",
+			Proxies: make([]map[string]any, 0),
+			Filter:  filter,
+			Less:    less,
+			Limit:   o.Limit,
+			Custom:  true,
+		})
+	}
+	return categories
 }
 
 // SaveConfig 保存配置的入口函数
 //
 // 参数:
 //   - results: 检查结果列表
-func SaveConfig(results []check.Result) {
+//
+// 返回值:
+//   - []OutputFile: 本次写入的订阅文件，拒绝发布时为空
+func SaveConfig(results []check.Result) ([]OutputFile, error) {
 	saver := NewConfigSaver(results)
 	if err := saver.Save(); err != nil {
 		slog.Error(fmt.Sprintf("保存配置失败: %v", err))
+		return nil, err
 	}
+	return saver.written, nil
 }
 
 // Save 执行保存操作
@@ -82,6 +192,11 @@ func SaveConfig(results []check.Result) {
 // 返回值:
 //   - error: 保存过程中可能发生的错误
 func (cs *ConfigSaver) Save() error {
+	// 节点数量骤降时拒绝发布，保留上一版本
+	if err := cs.checkDrop(); err != nil {
+		return err
+	}
+
 	// 分类处理代理
 	cs.categorizeProxies()
 
@@ -93,6 +208,9 @@ func (cs *ConfigSaver) Save() error {
 		}
 	}
 
+	// 保存本次发布的历史版本
+	cs.saveGeneration()
+
 	return nil
 }
 
@@ -206,16 +324,26 @@ func (cs *ConfigSaver) injectIPQualityToMihomo(data []byte) []byte {
 // categorizeProxies 方法用于将代理分类到不同的类别中
 // 它遍历所有结果，并根据每个类别的过滤器将代理添加到相应的类别中
 func (cs *ConfigSaver) categorizeProxies() {
-    // 遍历所有结果
-	for _, result := range cs.results {
-        // 遍历所有类别
-		for i := range cs.categories {
-            // 使用类别的过滤器检查结果是否符合该类别
-			if cs.categories[i].Filter(result) {
-                // 如果符合，则将代理添加到该类别的代理列表中
-				cs.categories[i].Proxies = append(cs.categories[i].Proxies, result.Proxy)
+	// 遍历所有类别
+	for i := range cs.categories {
+		category := &cs.categories[i]
+		// 使用类别的过滤器筛选结果
+		var matched []check.Result
+		for _, result := range cs.results {
+			if category.Filter(result) {
+				matched = append(matched, result)
 			}
 		}
+		if category.Less != nil {
+			sort.SliceStable(matched, func(a, b int) bool { return category.Less(matched[a], matched[b]) })
+		}
+		if category.Limit > 0 && len(matched) > category.Limit {
+			matched = matched[:category.Limit]
+		}
+		// 将符合的代理添加到该类别的代理列表中
+		for _, result := range matched {
+			category.Proxies = append(category.Proxies, result.Proxy)
+		}
 	}
 }
 
@@ -233,6 +361,10 @@ func (cs *ConfigSaver) categorizeProxies() {
  * @return error: 错误信息，保存成功返回 nil
  */
 func (cs *ConfigSaver) saveCategory(category ProxyCategory) error {
+	if category.Custom {
+		return cs.saveCustomCategory(category)
+	}
+
 	// 检查代理列表是否为空，为空则跳过保存并记录警告日志
 	if len(category.Proxies) == 0 {
 		slog.Warn(fmt.Sprintf("yaml节点为空，跳过保存: %s", category.Name))
@@ -255,7 +387,7 @@ func (cs *ConfigSaver) saveCategory(category ProxyCategory) error {
 		if config.GlobalConfig.SubStorePort != "" {
 			utils.UpdateSubStore(data)
 		}
-	} else if category.Name == "mihomo.yaml" && config.GlobalConfig.SubStorePort != "" {
+	} else if category.Name == "mihomo.yaml" && useSubStore() {
 		resp, err := http.Get(fmt.Sprintf("%s/api/file/%s", utils.BaseURL, utils.MihomoName))
 		if err != nil {
 			return fmt.Errorf("获取mihomo file请求失败: %w", err)
@@ -270,7 +402,12 @@ func (cs *ConfigSaver) saveCategory(category ProxyCategory) error {
 		}
 		// 基于最新检测结果，为 mihomo.yaml 中的节点注入 IP 纯净度相关信息
 		data = cs.injectIPQualityToMihomo(data)
-	} else if category.Name == "base64.txt" && config.GlobalConfig.SubStorePort != "" {
+		data = cs.withGroups(data)
+	} else if category.Name == "mihomo.yaml" {
+		if data, err = cs.nativeMihomo(category.Proxies); err != nil {
+			return fmt.Errorf("生成mihomo.yaml失败: %w", err)
+		}
+	} else if category.Name == "base64.txt" && useSubStore() {
 		resp, err := http.Get(fmt.Sprintf("%s/download/%s?target=V2Ray", utils.BaseURL, utils.SubName))
 		if err != nil {
 			return fmt.Errorf("获取base64.txt请求失败: %w", err)
@@ -283,20 +420,117 @@ func (cs *ConfigSaver) saveCategory(category ProxyCategory) error {
 		if resp.StatusCode != http.StatusOK {
 			return fmt.Errorf("获取base64.txt失败，状态码: %d, 错误信息: %s", resp.StatusCode, data)
 		}
+	} else if category.Name == "base64.txt" {
+		data = generator.Base64(category.Proxies)
+	} else if category.Name == "links.txt" {
+		data = generator.URIList(category.Proxies)
+	} else if category.Name == "sing-box.json" {
+		if data, err = generator.SingBox(category.Proxies, singBoxGroups(cs.results)); err != nil {
+			return fmt.Errorf("生成sing-box.json失败: %w", err)
+		}
 	} else {
 		return nil
 	}
 
-	// 远程存储只保存 mihomo.yaml，本地保存所有格式
-	for _, saveMethod := range cs.saveMethods {
-		if err := saveMethod(data, category.Name); err != nil {
-			slog.Error(fmt.Sprintf("保存 %s 失败: %v", category.Name, err))
+	// 远程存储只保存 mihomo.yaml 与 sing-box.json，本地保存所有格式
+	cs.write(data, category.Name)
+
+	return nil
+}
+
+// saveCustomCategory 保存自定义输出分类，与内置订阅一样生成所有格式
+// 没有匹配的节点时删除本地之前生成的文件，避免继续提供过期的节点
+func (cs *ConfigSaver) saveCustomCategory(category ProxyCategory) error {
+	name := strings.TrimSuffix(category.Name, ".yaml")
+	if len(category.Proxies) == 0 {
+		slog.Warn(fmt.Sprintf("输出分类 %s 没有匹配的节点，删除之前生成的文件", name))
+		saver, err := method.NewLocalSaver()
+		if err != nil {
+			return err
+		}
+		for _, f := range categoryFiles(name) {
+			if err := saver.Remove(f); err != nil {
+				slog.Error(fmt.Sprintf("删除 %s 失败: %v", f, err))
+			}
 		}
+		return nil
+	}
+
+	// 与 all.yaml 格式相同
+	data, err := yaml.Marshal(map[string]any{
+		"proxies": category.Proxies,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化yaml %s 失败: %w", category.Name, err)
 	}
+	cs.write(data, category.Name)
 
+	if profile, err := cs.nativeMihomo(category.Proxies); err != nil {
+		slog.Error(fmt.Sprintf("生成 %s-mihomo.yaml 失败: %v", name, err))
+	} else {
+		cs.write(profile, name+"-mihomo.yaml")
+	}
+	cs.write(generator.Base64(category.Proxies), name+"-base64.txt")
+	cs.write(generator.URIList(category.Proxies), name+"-links.txt")
+	if box, err := generator.SingBox(category.Proxies, singBoxGroups(cs.results)); err != nil {
+		slog.Error(fmt.Sprintf("生成 %s-sing-box.json 失败: %v", name, err))
+	} else {
+		cs.write(box, name+"-sing-box.json")
+	}
 	return nil
 }
 
+// write 使用所有保存方法保存文件
+func (cs *ConfigSaver) write(data []byte, name string) {
+	sum := sha256.Sum256(data)
+	cs.written = append(cs.written, OutputFile{Name: name, Size: len(data), SHA256: hex.EncodeToString(sum[:])})
+	for _, saveMethod := range cs.saveMethods {
+		if err := saveMethod(data, name); err != nil {
+			slog.Error(fmt.Sprintf("保存 %s 失败: %v", name, err))
+		}
+	}
+}
+
+// useSubStore 判断 mihomo.yaml 与 base64.txt 是否由 sub-store 生成
+func useSubStore() bool {
+	switch strings.ToLower(config.GlobalConfig.OutputBackend) {
+	case "native":
+		return false
+	case "sub-store":
+		if config.GlobalConfig.SubStorePort == "" {
+			slog.Warn("output-backend 为 sub-store 但未配置 sub-store-port，改为直接生成")
+			return false
+		}
+		return true
+	default:
+		return config.GlobalConfig.SubStorePort != ""
+	}
+}
+
+// nativeMihomo 不经过 sub-store，基于 clash_template.yaml 直接生成 mihomo 配置
+func (cs *ConfigSaver) nativeMihomo(proxies []map[string]any) ([]byte, error) {
+	data, err := generator.MihomoProfile(clashTemplate(), proxies)
+	if err != nil {
+		return nil, err
+	}
+	return cs.withGroups(cs.injectIPQualityToMihomo(data)), nil
+}
+
+// clashTemplate 优先使用输出目录下用户修改过的模板，不存在时使用内置模板
+func clashTemplate() []byte {
+	saver, err := method.NewLocalSaver()
+	if err == nil {
+		dir := saver.OutputPath
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(saver.BasePath, dir)
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "clash_template.yaml")); err == nil {
+			return data
+		}
+	}
+	return assets.EmbeddedClashTemplate
+}
+
 // chooseSaveMethods 根据配置选择保存方法（支持多个）
 //
 // 返回值:
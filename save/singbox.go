@@ -0,0 +1,53 @@
+package save
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/save/generator"
+)
+
+// groupPlatforms 按解锁平台生成的分组，sing-box 与 mihomo 共用
+var groupPlatforms = []struct {
+	tag    string
+	unlock func(r check.Result) bool
+}{
+	{"OpenAI", func(r check.Result) bool { return r.Openai }},
+	{"Netflix", func(r check.Result) bool { return r.Netflix }},
+	{"Disney+", func(r check.Result) bool { return r.Disney }},
+	{"Gemini", func(r check.Result) bool { return r.Gemini }},
+	{"YouTube", func(r check.Result) bool { return r.Youtube != "" }},
+	{"TikTok", func(r check.Result) bool { return r.TikTok != "" }},
+}
+
+// singBoxGroups 根据检测结果生成按国家的 urltest 分组与按解锁平台的 selector 分组
+func singBoxGroups(results []check.Result) []generator.Group {
+	byCountry := make(map[string][]string)
+	for _, r := range results {
+		if country := strings.ToUpper(r.Country); country != "" {
+			byCountry[country] = append(byCountry[country], fmt.Sprint(r.Proxy["name"]))
+		}
+	}
+	countries := make([]string, 0, len(byCountry))
+	for c := range byCountry {
+		countries = append(countries, c)
+	}
+	sort.Strings(countries)
+
+	groups := make([]generator.Group, 0, len(countries)+len(groupPlatforms))
+	for _, c := range countries {
+		groups = append(groups, generator.Group{Tag: c, Type: generator.GroupURLTest, Members: byCountry[c]})
+	}
+	for _, platform := range groupPlatforms {
+		var members []string
+		for _, r := range results {
+			if platform.unlock(r) {
+				members = append(members, fmt.Sprint(r.Proxy["name"]))
+			}
+		}
+		groups = append(groups, generator.Group{Tag: platform.tag, Type: generator.GroupSelector, Members: members})
+	}
+	return groups
+}
@@ -0,0 +1,96 @@
+package save
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/save/generator"
+)
+
+// ErrNoProxies 没有符合条件的节点
+var ErrNoProxies = errors.New("没有符合条件的节点")
+
+// SubQuery 动态订阅的筛选与输出参数
+type SubQuery struct {
+	Target    string   // clash(默认)、sing-box、v2ray、surge
+	Countries []string // 国家代码，匹配任意一个即可
+	Platforms []string // 需要同时解锁的平台，与过滤表达式的字段相同，如 netflix、openai
+	MinSpeed  int      // 最低速度(KB/s)，0 为不限制
+	MaxRisk   int      // 最高IP风险分数，<0 为不限制；限制时没有风险结果的节点被排除
+	Types     []string // 协议类型，如 vless、hysteria2
+	Limit     int      // 最多返回的节点数量，0 为不限制
+	Sort      string   // speed、latency、risk
+}
+
+// Render 按参数筛选检测结果并转换为目标格式，返回内容与 Content-Type
+func Render(results []check.Result, q SubQuery) ([]byte, string, error) {
+	for _, p := range q.Platforms {
+		if !slices.Contains(platformFields, p) {
+			return nil, "", fmt.Errorf("未知的平台 %q", p)
+		}
+	}
+	less, err := ParseSort(q.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cs := &ConfigSaver{
+		results: results,
+		categories: []ProxyCategory{{
+			Name:   "sub",
+			Filter: q.match,
+			Less:   less,
+			Limit:  q.Limit,
+		}},
+	}
+	cs.categorizeProxies()
+	proxies := cs.categories[0].Proxies
+	if len(proxies) == 0 {
+		return nil, "", ErrNoProxies
+	}
+
+	var data []byte
+	switch strings.ToLower(q.Target) {
+	case "", "clash", "mihomo":
+		data, err = cs.nativeMihomo(proxies)
+		return data, "text/yaml; charset=utf-8", err
+	case "sing-box", "singbox":
+		data, err = generator.SingBox(proxies, singBoxGroups(results))
+		return data, "application/json; charset=utf-8", err
+	case "v2ray", "base64":
+		return generator.Base64(proxies), "text/plain; charset=utf-8", nil
+	case "surge":
+		data, err = generator.Surge(proxies, resultGroups(results))
+		return data, "text/plain; charset=utf-8", err
+	}
+	return nil, "", fmt.Errorf("未知的订阅格式 %q", q.Target)
+}
+
+// platformFields 可用于 platform 参数的解锁字段
+var platformFields = []string{"openai", "openai-web", "netflix", "disney", "gemini", "google", "youtube", "tiktok"}
+
+func (q SubQuery) match(r check.Result) bool {
+	if len(q.Countries) > 0 && !slices.ContainsFunc(q.Countries, func(c string) bool { return strings.EqualFold(c, r.Country) }) {
+		return false
+	}
+	for _, p := range q.Platforms {
+		if !truthy(filterFields[p](r)) {
+			return false
+		}
+	}
+	if q.MinSpeed > 0 && r.SpeedKBps < q.MinSpeed {
+		return false
+	}
+	if q.MaxRisk >= 0 {
+		if score := riskScore(r); score < 0 || score > q.MaxRisk {
+			return false
+		}
+	}
+	if len(q.Types) > 0 && !slices.ContainsFunc(q.Types, func(t string) bool { return strings.EqualFold(t, proxyString(r, "type")) }) {
+		return false
+	}
+	return true
+}
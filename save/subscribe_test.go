@@ -0,0 +1,108 @@
+package save
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/twj0/subcheck/check"
+)
+
+func TestRender(t *testing.T) {
+	trojan := func(name string) map[string]any {
+		return map[string]any{"name": name, "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p"}
+	}
+	vless := func(name string) map[string]any {
+		return map[string]any{"name": name, "type": "vless", "server": "1.2.3.4", "port": 443, "uuid": "u"}
+	}
+	results := []check.Result{
+		{Proxy: trojan("a"), Country: "JP", SpeedKBps: 500, Netflix: true, IPRisk: "10%"},
+		{Proxy: vless("b"), Country: "JP", SpeedKBps: 2000, Netflix: true, Openai: true},
+		{Proxy: trojan("c"), Country: "US", SpeedKBps: 3000, IPRisk: "60%"},
+		{Proxy: trojan("d"), Country: "us", SpeedKBps: 100, Openai: true, IPRisk: "5%"},
+	}
+	tests := []struct {
+		name    string
+		query   SubQuery
+		want    []string
+		wantErr error
+	}{
+		{"country", SubQuery{Target: "v2ray", Countries: []string{"US"}, MaxRisk: -1}, []string{"c", "d"}, nil},
+		{"platforms all required", SubQuery{Target: "v2ray", Platforms: []string{"netflix", "openai"}, MaxRisk: -1}, []string{"b"}, nil},
+		{"min speed sorted with limit", SubQuery{Target: "v2ray", MinSpeed: 400, Sort: "speed", Limit: 2, MaxRisk: -1}, []string{"c", "b"}, nil},
+		{"max risk excludes unknown", SubQuery{Target: "v2ray", MaxRisk: 30}, []string{"a", "d"}, nil},
+		{"type", SubQuery{Target: "v2ray", Types: []string{"VLESS"}, MaxRisk: -1}, []string{"b"}, nil},
+		{"no match", SubQuery{Target: "v2ray", Countries: []string{"DE"}, MaxRisk: -1}, nil, ErrNoProxies},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _, err := Render(results, tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Render() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(string(decodeBase64(t, data))), "\n") {
+				got = append(got, line[strings.LastIndex(line, "#")+1:])
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Render() nodes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderInvalid(t *testing.T) {
+	results := []check.Result{{Proxy: map[string]any{"name": "a", "type": "trojan", "server": "1.2.3.4", "port": 443}}}
+	tests := []struct {
+		name  string
+		query SubQuery
+	}{
+		{"unknown target", SubQuery{Target: "quantumult", MaxRisk: -1}},
+		{"unknown platform", SubQuery{Platforms: []string{"hbo"}, MaxRisk: -1}},
+		{"unknown sort", SubQuery{Sort: "name", MaxRisk: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Render(results, tt.query); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestRenderTargets(t *testing.T) {
+	results := []check.Result{{Proxy: map[string]any{"name": "a", "type": "trojan", "server": "1.2.3.4", "port": 443, "password": "p"}, Country: "JP"}}
+	tests := []struct {
+		target      string
+		contentType string
+		contains    string
+	}{
+		{"", "text/yaml; charset=utf-8", "proxy-groups:"},
+		{"sing-box", "application/json; charset=utf-8", `"type": "trojan"`},
+		{"surge", "text/plain; charset=utf-8", "a = trojan, 1.2.3.4, 443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			data, contentType, err := Render(results, SubQuery{Target: tt.target, MaxRisk: -1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != tt.contentType || !strings.Contains(string(data), tt.contains) {
+				t.Errorf("Render(%q) = %s %q, want %s containing %q", tt.target, contentType, data, tt.contentType, tt.contains)
+			}
+		})
+	}
+}
+
+func decodeBase64(t *testing.T, data []byte) []byte {
+	t.Helper()
+	out, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -86,6 +86,64 @@ func Migrate() error {
 			test_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (subscription_id) REFERENCES subscriptions(id)
 		);`,
+		`CREATE TABLE IF NOT EXISTS ip_quality_provider_results (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			result_id INTEGER NOT NULL,
+			provider VARCHAR(50) NOT NULL,
+			score INTEGER,
+			risk_level VARCHAR(50),
+			country_code VARCHAR(10),
+			is_proxy BOOLEAN,
+			is_vpn BOOLEAN,
+			is_tor BOOLEAN,
+			is_datacenter BOOLEAN,
+			FOREIGN KEY (result_id) REFERENCES ip_quality_results(id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_ip_quality_provider_results_result ON ip_quality_provider_results(result_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_ip_quality_results_ip ON ip_quality_results(ip_address, test_time);`,
+		`CREATE TABLE IF NOT EXISTS kept_proxies (
+			fingerprint VARCHAR(32) PRIMARY KEY,
+			node_name VARCHAR(255),
+			proxy_json TEXT NOT NULL,
+			success_count INTEGER DEFAULT 1,
+			missed_runs INTEGER DEFAULT 0,
+			first_success TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_success TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS share_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(255) NOT NULL,
+			token VARCHAR(64) NOT NULL UNIQUE,
+			outputs TEXT,
+			ip_allowlist TEXT,
+			expires_at TIMESTAMP,
+			request_count INTEGER DEFAULT 0,
+			last_access TIMESTAMP,
+			last_ip VARCHAR(45),
+			last_user_agent TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			started_at TIMESTAMP,
+			finished_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			total INTEGER DEFAULT 0,
+			available INTEGER DEFAULT 0,
+			snapshot TEXT,
+			diff TEXT
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			delivery_id VARCHAR(32) NOT NULL,
+			run_id INTEGER,
+			event VARCHAR(32) NOT NULL,
+			url TEXT NOT NULL,
+			success BOOLEAN DEFAULT false,
+			attempts INTEGER DEFAULT 0,
+			status_code INTEGER,
+			error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
 		`CREATE TABLE IF NOT EXISTS system_config (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			speed_test_interval INTEGER DEFAULT 86400,
@@ -99,6 +157,21 @@ func Migrate() error {
 		}
 	}
 	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN proxy_json TEXT`)
+	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN country_code VARCHAR(10)`)
+	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN ipv6_address VARCHAR(45)`)
+	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN ipv6_country VARCHAR(10)`)
+	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN ip_stack VARCHAR(10)`)
+	_, _ = DB.Exec(`ALTER TABLE ip_quality_results ADD COLUMN node_name VARCHAR(255)`)
+	_, _ = DB.Exec(`ALTER TABLE ip_quality_results ADD COLUMN report_json TEXT`)
+	_, _ = DB.Exec(`ALTER TABLE ip_quality_results ADD COLUMN lookup_kind VARCHAR(20)`)
+	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN fingerprint VARCHAR(32)`)
+	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN result_json TEXT`)
+	_, _ = DB.Exec(`ALTER TABLE speed_test_results ADD COLUMN reused BOOLEAN NOT NULL DEFAULT 0`)
+	_, _ = DB.Exec(`ALTER TABLE runs ADD COLUMN status VARCHAR(16)`)
+	// 依赖上面新增的列，放在 ALTER TABLE 之后
+	if _, err := DB.Exec(`CREATE INDEX IF NOT EXISTS idx_speed_test_results_fingerprint ON speed_test_results(fingerprint, test_time)`); err != nil {
+		return err
+	}
 	return nil
 }
 
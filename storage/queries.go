@@ -67,6 +67,19 @@ type SpeedResult struct {
 	IPAddress      sql.NullString
 	ProxyJSON      sql.NullString
 	TestTime       time.Time
+	CountryCode    sql.NullString
+	IPv6Address    sql.NullString
+	IPv6Country    sql.NullString
+	IPStack        sql.NullString
+}
+
+// ExitInfo 节点出口信息，开启双栈检测时 IP/Country 为IPv4出口
+type ExitInfo struct {
+	IP          string
+	Country     string
+	IPv6        string
+	IPv6Country string
+	Stack       string
 }
 
 type IPQualityResult struct {
@@ -80,6 +93,10 @@ type IPQualityResult struct {
 	IsTor          sql.NullBool
 	CountryCode    sql.NullString
 	TestTime       time.Time
+	NodeName       sql.NullString
+	LookupKind     sql.NullString // 查询方式，见 ipcheck.KindChain 等
+	ReportJSON     sql.NullString // 列表查询不返回完整报告，使用 HasReport 判断
+	HasReport      bool
 }
 
 func CreateSubscription(ctx context.Context, name, url string, enabled bool) (int64, error) {
@@ -128,11 +145,47 @@ func ListSubscriptions(ctx context.Context, page, pageSize int) ([]Subscription,
 	return list, total, nil
 }
 
-func SaveSpeedResult(ctx context.Context, subscriptionID sql.NullInt64, nodeName string, delay sql.NullInt64, download float64, upload sql.NullFloat64, ipAddr sql.NullString, proxyJSON sql.NullString) error {
-	_, err := DB.ExecContext(ctx, `INSERT INTO speed_test_results (subscription_id, node_name, delay, download_speed, upload_speed, ip_address, proxy_json) VALUES (?,?,?,?,?,?,?)`, subscriptionID, nodeName, delay, download, upload, ipAddr, proxyJSON)
+func SaveSpeedResult(ctx context.Context, subscriptionID sql.NullInt64, nodeName string, delay sql.NullInt64, download float64, upload sql.NullFloat64, exit ExitInfo, proxyJSON sql.NullString) (int64, error) {
+	res, err := DB.ExecContext(ctx, `INSERT INTO speed_test_results (subscription_id, node_name, delay, download_speed, upload_speed, ip_address, proxy_json, country_code, ipv6_address, ipv6_country, ip_stack) VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
+		subscriptionID, nodeName, delay, download, upload, nullString(exit.IP), proxyJSON, nullString(exit.Country), nullString(exit.IPv6), nullString(exit.IPv6Country), nullString(exit.Stack))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// SaveSpeedResultFingerprint 保存节点指纹与完整检测结果，供增量检测复用
+// reused 为 true 表示结果复用自之前的完整检测，不计入增量检测的有效期
+func SaveSpeedResultFingerprint(ctx context.Context, id int64, fingerprint, resultJSON string, reused bool) error {
+	_, err := DB.ExecContext(ctx, `UPDATE speed_test_results SET fingerprint=?, result_json=?, reused=? WHERE id=?`, nullString(fingerprint), nullString(resultJSON), reused, id)
 	return err
 }
 
+// QueryRecentResultJSON 查询指纹在 hours 小时内最近一次完整检测的结果，复用的结果不算，没有结果时返回空字符串
+func QueryRecentResultJSON(ctx context.Context, fingerprint string, hours int) (string, error) {
+	var js string
+	err := DB.QueryRowContext(ctx, `SELECT result_json FROM speed_test_results WHERE fingerprint=? AND result_json IS NOT NULL AND reused=0 AND test_time >= datetime('now', ?) ORDER BY id DESC LIMIT 1`,
+		fingerprint, fmt.Sprintf("-%d hour", hours)).Scan(&js)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return js, err
+}
+
+// QueryLatestResultJSON 查询指纹最近一次的检测结果(包括复用的结果)，不限制时间，没有结果时返回空字符串
+func QueryLatestResultJSON(ctx context.Context, fingerprint string) (string, error) {
+	var js string
+	err := DB.QueryRowContext(ctx, `SELECT result_json FROM speed_test_results WHERE fingerprint=? AND result_json IS NOT NULL ORDER BY id DESC LIMIT 1`, fingerprint).Scan(&js)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return js, err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func QuerySpeedResults(ctx context.Context, page, pageSize int, nodeLike string, minSpeed, maxSpeed *float64, sortBy, sortDir string) ([]SpeedResult, int64, error) {
 	if page < 1 {
 		page = 1
@@ -171,7 +224,7 @@ func QuerySpeedResults(ctx context.Context, page, pageSize int, nodeLike string,
 		return nil, 0, err
 	}
 	offset := (page - 1) * pageSize
-	rows, err := DB.QueryContext(ctx, `SELECT id,subscription_id,node_name,delay,download_speed,upload_speed,ip_address,proxy_json,test_time FROM speed_test_results`+queryWhere+` ORDER BY `+sortBy+` `+sortDir+` LIMIT ? OFFSET ?`, append(args, pageSize, offset)...)
+	rows, err := DB.QueryContext(ctx, `SELECT id,subscription_id,node_name,delay,download_speed,upload_speed,ip_address,proxy_json,test_time,country_code,ipv6_address,ipv6_country,ip_stack FROM speed_test_results`+queryWhere+` ORDER BY `+sortBy+` `+sortDir+` LIMIT ? OFFSET ?`, append(args, pageSize, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -179,7 +232,7 @@ func QuerySpeedResults(ctx context.Context, page, pageSize int, nodeLike string,
 	var list []SpeedResult
 	for rows.Next() {
 		var r SpeedResult
-		if err := rows.Scan(&r.ID, &r.SubscriptionID, &r.NodeName, &r.Delay, &r.DownloadSpeed, &r.UploadSpeed, &r.IPAddress, &r.ProxyJSON, &r.TestTime); err != nil {
+		if err := rows.Scan(&r.ID, &r.SubscriptionID, &r.NodeName, &r.Delay, &r.DownloadSpeed, &r.UploadSpeed, &r.IPAddress, &r.ProxyJSON, &r.TestTime, &r.CountryCode, &r.IPv6Address, &r.IPv6Country, &r.IPStack); err != nil {
 			return nil, 0, err
 		}
 		list = append(list, r)
@@ -225,7 +278,7 @@ func QueryIPQualityResults(ctx context.Context, page, pageSize int, ip, country,
 		return nil, 0, err
 	}
 	offset := (page - 1) * pageSize
-	rows, err := DB.QueryContext(ctx, `SELECT id,subscription_id,ip_address,fraud_score,risk_level,is_proxy,is_vpn,is_tor,country_code,test_time FROM ip_quality_results`+queryWhere+` ORDER BY `+sortBy+` `+sortDir+` LIMIT ? OFFSET ?`, append(args, pageSize, offset)...)
+	rows, err := DB.QueryContext(ctx, `SELECT id,subscription_id,ip_address,fraud_score,risk_level,is_proxy,is_vpn,is_tor,country_code,test_time,node_name,report_json IS NOT NULL FROM ip_quality_results`+queryWhere+` ORDER BY `+sortBy+` `+sortDir+` LIMIT ? OFFSET ?`, append(args, pageSize, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -233,7 +286,7 @@ func QueryIPQualityResults(ctx context.Context, page, pageSize int, ip, country,
 	var list []IPQualityResult
 	for rows.Next() {
 		var r IPQualityResult
-		if err := rows.Scan(&r.ID, &r.SubscriptionID, &r.IPAddress, &r.FraudScore, &r.RiskLevel, &r.IsProxy, &r.IsVPN, &r.IsTor, &r.CountryCode, &r.TestTime); err != nil {
+		if err := rows.Scan(&r.ID, &r.SubscriptionID, &r.IPAddress, &r.FraudScore, &r.RiskLevel, &r.IsProxy, &r.IsVPN, &r.IsTor, &r.CountryCode, &r.TestTime, &r.NodeName, &r.HasReport); err != nil {
 			return nil, 0, err
 		}
 		list = append(list, r)
@@ -303,8 +356,468 @@ func QueryTopNSpeedIPs(ctx context.Context, n int) ([]string, error) {
 	return out, nil
 }
 
-func SaveIPQualityResult(ctx context.Context, subscriptionID sql.NullInt64, ipAddr string, fraudScore sql.NullInt64, riskLevel sql.NullString, isProxy, isVPN, isTor sql.NullBool, countryCode sql.NullString) error {
-	_, err := DB.ExecContext(ctx, `INSERT INTO ip_quality_results (subscription_id, ip_address, fraud_score, risk_level, is_proxy, is_vpn, is_tor, country_code) VALUES (?,?,?,?,?,?,?,?)`,
+func SaveIPQualityResult(ctx context.Context, subscriptionID sql.NullInt64, ipAddr string, fraudScore sql.NullInt64, riskLevel sql.NullString, isProxy, isVPN, isTor sql.NullBool, countryCode sql.NullString) (int64, error) {
+	res, err := DB.ExecContext(ctx, `INSERT INTO ip_quality_results (subscription_id, ip_address, fraud_score, risk_level, is_proxy, is_vpn, is_tor, country_code) VALUES (?,?,?,?,?,?,?,?)`,
 		subscriptionID, ipAddr, fraudScore, riskLevel, isProxy, isVPN, isTor, countryCode)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// SaveIPQualityReport 保存检测所用的节点名称、查询方式与完整报告
+func SaveIPQualityReport(ctx context.Context, id int64, nodeName, kind, reportJSON string) error {
+	_, err := DB.ExecContext(ctx, `UPDATE ip_quality_results SET node_name=?, lookup_kind=?, report_json=? WHERE id=?`, nullString(nodeName), nullString(kind), nullString(reportJSON), id)
+	return err
+}
+
+// GetIPQualityResult 按ID查询检测结果，包含完整报告，不存在时返回 nil
+func GetIPQualityResult(ctx context.Context, id int64) (*IPQualityResult, error) {
+	var r IPQualityResult
+	err := DB.QueryRowContext(ctx, `SELECT id,subscription_id,ip_address,fraud_score,risk_level,is_proxy,is_vpn,is_tor,country_code,test_time,node_name,lookup_kind,report_json FROM ip_quality_results WHERE id=?`,
+		id).Scan(&r.ID, &r.SubscriptionID, &r.IPAddress, &r.FraudScore, &r.RiskLevel, &r.IsProxy, &r.IsVPN, &r.IsTor, &r.CountryCode, &r.TestTime, &r.NodeName, &r.LookupKind, &r.ReportJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.HasReport = r.ReportJSON.Valid
+	return &r, nil
+}
+
+// QueryRecentIPQuality 查询IP最近 hours 小时内最新的检测结果，没有结果时返回 nil
+// kinds 不为空时只返回这些查询方式的结果，scored 为 true 时跳过没有风险分数的结果
+func QueryRecentIPQuality(ctx context.Context, ip string, kinds []string, scored bool, hours int) (*IPQualityResult, error) {
+	query := `SELECT id,subscription_id,ip_address,fraud_score,risk_level,is_proxy,is_vpn,is_tor,country_code,test_time,node_name,lookup_kind,report_json FROM ip_quality_results WHERE ip_address=? AND test_time >= datetime('now', ?)`
+	args := []any{ip, fmt.Sprintf("-%d hour", hours)}
+	if len(kinds) > 0 {
+		query += ` AND lookup_kind IN (?` + strings.Repeat(`,?`, len(kinds)-1) + `)`
+		for _, k := range kinds {
+			args = append(args, k)
+		}
+	}
+	if scored {
+		query += ` AND fraud_score IS NOT NULL`
+	}
+	var r IPQualityResult
+	err := DB.QueryRowContext(ctx, query+` ORDER BY id DESC LIMIT 1`, args...).Scan(&r.ID, &r.SubscriptionID, &r.IPAddress, &r.FraudScore, &r.RiskLevel, &r.IsProxy, &r.IsVPN, &r.IsTor, &r.CountryCode, &r.TestTime, &r.NodeName, &r.LookupKind, &r.ReportJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// IPQualityProviderResult 单个检测接口的结果，Score 为 -1 时表示接口没有给出分数
+type IPQualityProviderResult struct {
+	ID           int64
+	ResultID     int64
+	Provider     string
+	Score        int
+	RiskLevel    string
+	CountryCode  string
+	IsProxy      bool
+	IsVPN        bool
+	IsTor        bool
+	IsDatacenter bool
+}
+
+// SaveIPQualityProviderResults 保存一次IP质量检测中每个接口的结果
+func SaveIPQualityProviderResults(ctx context.Context, resultID int64, list []IPQualityProviderResult) error {
+	for _, r := range list {
+		score := sql.NullInt64{Int64: int64(r.Score), Valid: r.Score >= 0}
+		if _, err := DB.ExecContext(ctx, `INSERT INTO ip_quality_provider_results (result_id, provider, score, risk_level, country_code, is_proxy, is_vpn, is_tor, is_datacenter) VALUES (?,?,?,?,?,?,?,?,?)`,
+			resultID, r.Provider, score, nullString(r.RiskLevel), nullString(r.CountryCode), r.IsProxy, r.IsVPN, r.IsTor, r.IsDatacenter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryIPQualityProviderResults 查询一次IP质量检测中每个接口的结果
+func QueryIPQualityProviderResults(ctx context.Context, resultID int64) ([]IPQualityProviderResult, error) {
+	rows, err := DB.QueryContext(ctx, `SELECT id,result_id,provider,score,risk_level,country_code,is_proxy,is_vpn,is_tor,is_datacenter FROM ip_quality_provider_results WHERE result_id=? ORDER BY id`, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []IPQualityProviderResult
+	for rows.Next() {
+		var (
+			r            IPQualityProviderResult
+			score        sql.NullInt64
+			level, cc    sql.NullString
+			proxy, vpn   sql.NullBool
+			tor, hosting sql.NullBool
+		)
+		if err := rows.Scan(&r.ID, &r.ResultID, &r.Provider, &score, &level, &cc, &proxy, &vpn, &tor, &hosting); err != nil {
+			return nil, err
+		}
+		r.Score = -1
+		if score.Valid {
+			r.Score = int(score.Int64)
+		}
+		r.RiskLevel, r.CountryCode = level.String, cc.String
+		r.IsProxy, r.IsVPN, r.IsTor, r.IsDatacenter = proxy.Bool, vpn.Bool, tor.Bool, hosting.Bool
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+// KeptProxy keep-success-proxies 保留的节点
+type KeptProxy struct {
+	Fingerprint  string
+	NodeName     string
+	ProxyJSON    string
+	SuccessCount int
+	MissedRuns   int // 连续多少次检测未通过
+	FirstSuccess time.Time
+	LastSuccess  time.Time
+}
+
+// SaveKeptProxies 记录一次检测后保留的节点
+// 本次通过的节点重置未通过次数，其余节点未通过次数加一，达到 maxMissed 的节点被删除(maxMissed 为 0 时不删除)
+// 返回删除的节点数量
+func SaveKeptProxies(ctx context.Context, passed []KeptProxy, maxMissed int) (int64, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE kept_proxies SET missed_runs = missed_runs + 1`); err != nil {
+		return 0, err
+	}
+	for _, p := range passed {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO kept_proxies (fingerprint, node_name, proxy_json) VALUES (?,?,?)
+			ON CONFLICT(fingerprint) DO UPDATE SET node_name=excluded.node_name, proxy_json=excluded.proxy_json,
+			success_count=success_count+1, missed_runs=0, last_success=CURRENT_TIMESTAMP`,
+			p.Fingerprint, nullString(p.NodeName), p.ProxyJSON); err != nil {
+			return 0, err
+		}
+	}
+	var dropped int64
+	if maxMissed > 0 {
+		res, err := tx.ExecContext(ctx, `DELETE FROM kept_proxies WHERE missed_runs >= ?`, maxMissed)
+		if err != nil {
+			return 0, err
+		}
+		dropped, _ = res.RowsAffected()
+	}
+	return dropped, tx.Commit()
+}
+
+// ListKeptProxies 查询所有保留的节点，最近通过的在前
+func ListKeptProxies(ctx context.Context) ([]KeptProxy, error) {
+	rows, err := DB.QueryContext(ctx, `SELECT fingerprint,node_name,proxy_json,success_count,missed_runs,first_success,last_success FROM kept_proxies ORDER BY last_success DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []KeptProxy
+	for rows.Next() {
+		var (
+			p    KeptProxy
+			name sql.NullString
+		)
+		if err := rows.Scan(&p.Fingerprint, &name, &p.ProxyJSON, &p.SuccessCount, &p.MissedRuns, &p.FirstSuccess, &p.LastSuccess); err != nil {
+			return nil, err
+		}
+		p.NodeName = name.String
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// DeleteKeptProxy 删除一个保留的节点
+func DeleteKeptProxy(ctx context.Context, fingerprint string) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM kept_proxies WHERE fingerprint=?`, fingerprint)
+	return err
+}
+
+// PurgeKeptProxies 清空保留的节点
+func PurgeKeptProxies(ctx context.Context) (int64, error) {
+	res, err := DB.ExecContext(ctx, `DELETE FROM kept_proxies`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ShareToken 订阅分享令牌
+type ShareToken struct {
+	ID            int64
+	Name          string
+	Token         string
+	Outputs       []string     // 允许访问的输出，如 mihomo.yaml、sub(动态订阅)，为空时允许全部
+	IPAllowlist   []string     // 允许访问的 IP 或 CIDR，为空时不限制
+	ExpiresAt     sql.NullTime // 为空时永不过期
+	RequestCount  int64
+	LastAccess    sql.NullTime
+	LastIP        string
+	LastUserAgent string
+	CreatedAt     time.Time
+}
+
+const shareTokenColumns = `id,name,token,outputs,ip_allowlist,expires_at,request_count,last_access,last_ip,last_user_agent,created_at`
+
+// CreateShareToken 创建分享令牌
+func CreateShareToken(ctx context.Context, t ShareToken) (int64, error) {
+	res, err := DB.ExecContext(ctx, `INSERT INTO share_tokens (name, token, outputs, ip_allowlist, expires_at) VALUES (?,?,?,?,?)`,
+		t.Name, t.Token, nullString(strings.Join(t.Outputs, ",")), nullString(strings.Join(t.IPAllowlist, ",")), t.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// CountShareTokens 分享令牌的数量
+func CountShareTokens(ctx context.Context) (int, error) {
+	var n int
+	err := DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM share_tokens`).Scan(&n)
+	return n, err
+}
+
+// ListShareTokens 查询所有分享令牌，最新创建的在前
+func ListShareTokens(ctx context.Context) ([]ShareToken, error) {
+	rows, err := DB.QueryContext(ctx, `SELECT `+shareTokenColumns+` FROM share_tokens ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ShareToken
+	for rows.Next() {
+		t, err := scanShareToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// GetShareToken 按令牌查询，不存在时返回 nil
+func GetShareToken(ctx context.Context, token string) (*ShareToken, error) {
+	t, err := scanShareToken(DB.QueryRowContext(ctx, `SELECT `+shareTokenColumns+` FROM share_tokens WHERE token=?`, token))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// DeleteShareToken 吊销分享令牌
+func DeleteShareToken(ctx context.Context, id int64) error {
+	_, err := DB.ExecContext(ctx, `DELETE FROM share_tokens WHERE id=?`, id)
+	return err
+}
+
+// RecordShareTokenAccess 记录一次访问: 请求次数加一，更新最近访问时间、IP 与 User-Agent
+func RecordShareTokenAccess(ctx context.Context, id int64, ip, userAgent string) error {
+	_, err := DB.ExecContext(ctx, `UPDATE share_tokens SET request_count=request_count+1, last_access=?, last_ip=?, last_user_agent=? WHERE id=?`,
+		time.Now().UTC(), nullString(ip), nullString(userAgent), id)
+	return err
+}
+
+func scanShareToken(row interface{ Scan(...any) error }) (*ShareToken, error) {
+	var (
+		t                     ShareToken
+		outputs, allow        sql.NullString
+		lastIP, lastUserAgent sql.NullString
+	)
+	if err := row.Scan(&t.ID, &t.Name, &t.Token, &outputs, &allow, &t.ExpiresAt, &t.RequestCount, &t.LastAccess, &lastIP, &lastUserAgent, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	t.Outputs = splitList(outputs.String)
+	t.IPAllowlist = splitList(allow.String)
+	t.LastIP, t.LastUserAgent = lastIP.String, lastUserAgent.String
+	return &t, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// Run 一次检测的记录
+type Run struct {
+	ID         int64
+	Status     string // RunRunning RunFinished RunVetoed，旧版本的记录为空
+	StartedAt  time.Time
+	FinishedAt time.Time // 检测未完成时为零值
+	Total      int       // 参与检测的节点数量
+	Available  int       // 可用节点数量
+	Snapshot   string    // 节点摘要 JSON，只有最近一次检测保留
+	Diff       string    // 与上一次检测的差异 JSON，首次检测为空
+}
+
+// 检测记录的状态
+const (
+	RunRunning  = "running"
+	RunFinished = "finished"
+	RunVetoed   = "vetoed" // 被 pre-check 脚本否决
+)
+
+// StartRun 记录检测开始，返回检测记录 ID
+func StartRun(ctx context.Context, started time.Time) (int64, error) {
+	res, err := DB.ExecContext(ctx, `INSERT INTO runs (started_at, finished_at, status) VALUES (?, NULL, ?)`, started.UTC(), RunRunning)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// SaveRun 保存检测结果，ID 为 0 时新建记录；清除更早记录的快照，并只保留最近 keep 条记录
+func SaveRun(ctx context.Context, r Run, keep int) (int64, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id := r.ID
+	if id == 0 {
+		res, err := tx.ExecContext(ctx, `INSERT INTO runs (started_at) VALUES (?)`, r.StartedAt.UTC())
+		if err != nil {
+			return 0, err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+	}
+	status := r.Status
+	if status == "" {
+		status = RunFinished
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE runs SET status=?, finished_at=?, total=?, available=?, snapshot=?, diff=? WHERE id=?`,
+		status, r.FinishedAt.UTC(), r.Total, r.Available, nullString(r.Snapshot), nullString(r.Diff), id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE runs SET snapshot=NULL WHERE id<? AND snapshot IS NOT NULL`, id); err != nil {
+		return 0, err
+	}
+	if keep > 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM runs WHERE id NOT IN (SELECT id FROM runs ORDER BY id DESC LIMIT ?)`, keep); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// FinishRun 结束没有检测结果的记录，如被否决的检测，不影响快照
+func FinishRun(ctx context.Context, id int64, status string, finished time.Time) error {
+	_, err := DB.ExecContext(ctx, `UPDATE runs SET status=?, finished_at=? WHERE id=?`, status, finished.UTC(), id)
 	return err
 }
+
+// LatestRun 查询最近一次保存了快照的检测记录，没有时返回 nil
+func LatestRun(ctx context.Context) (*Run, error) {
+	r, err := scanRun(DB.QueryRowContext(ctx, `SELECT id,status,started_at,finished_at,total,available,snapshot,diff FROM runs WHERE snapshot IS NOT NULL ORDER BY id DESC LIMIT 1`))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// GetRun 按 ID 查询检测记录，不存在时返回 nil
+func GetRun(ctx context.Context, id int64) (*Run, error) {
+	r, err := scanRun(DB.QueryRowContext(ctx, `SELECT id,status,started_at,finished_at,total,available,snapshot,diff FROM runs WHERE id=?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// ListRuns 查询最近的检测记录，不含快照与差异
+func ListRuns(ctx context.Context, limit int) ([]Run, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := DB.QueryContext(ctx, `SELECT id,status,started_at,finished_at,total,available,NULL,NULL FROM runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Run
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *r)
+	}
+	return list, rows.Err()
+}
+
+func scanRun(row interface{ Scan(...any) error }) (*Run, error) {
+	var (
+		r                 Run
+		status            sql.NullString
+		started, finished sql.NullTime
+		total, available  sql.NullInt64
+		snapshot, diff    sql.NullString
+	)
+	if err := row.Scan(&r.ID, &status, &started, &finished, &total, &available, &snapshot, &diff); err != nil {
+		return nil, err
+	}
+	r.Status = status.String
+	r.StartedAt, r.FinishedAt = started.Time, finished.Time
+	r.Total, r.Available = int(total.Int64), int(available.Int64)
+	r.Snapshot, r.Diff = snapshot.String, diff.String
+	return &r, nil
+}
+
+// WebhookDelivery 一次 webhook 投递的结果
+type WebhookDelivery struct {
+	ID         int64
+	DeliveryID string // 请求头 X-Subcheck-Delivery，重试时不变
+	RunID      int64
+	Event      string
+	URL        string
+	Success    bool
+	Attempts   int
+	StatusCode int // 最后一次请求的状态码，请求失败时为 0
+	Error      string
+	CreatedAt  time.Time
+}
+
+// SaveWebhookDelivery 记录 webhook 投递结果，只保留最近 keep 条
+func SaveWebhookDelivery(ctx context.Context, d WebhookDelivery, keep int) error {
+	_, err := DB.ExecContext(ctx, `INSERT INTO webhook_deliveries (delivery_id, run_id, event, url, success, attempts, status_code, error) VALUES (?,?,?,?,?,?,?,?)`,
+		d.DeliveryID, sql.NullInt64{Int64: d.RunID, Valid: d.RunID > 0}, d.Event, d.URL, d.Success, d.Attempts, d.StatusCode, nullString(d.Error))
+	if err != nil || keep <= 0 {
+		return err
+	}
+	_, err = DB.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE id NOT IN (SELECT id FROM webhook_deliveries ORDER BY id DESC LIMIT ?)`, keep)
+	return err
+}
+
+// ListWebhookDeliveries 查询最近的 webhook 投递记录
+func ListWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := DB.QueryContext(ctx, `SELECT id,delivery_id,run_id,event,url,success,attempts,status_code,error,created_at FROM webhook_deliveries ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []WebhookDelivery
+	for rows.Next() {
+		var (
+			d          WebhookDelivery
+			runID      sql.NullInt64
+			statusCode sql.NullInt64
+			errText    sql.NullString
+		)
+		if err := rows.Scan(&d.ID, &d.DeliveryID, &runID, &d.Event, &d.URL, &d.Success, &d.Attempts, &statusCode, &errText, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.RunID, d.StatusCode, d.Error = runID.Int64, int(statusCode.Int64), errText.String
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveKeptProxies(t *testing.T) {
+	if err := Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		DB = nil
+	})
+	ctx := context.Background()
+	a := KeptProxy{Fingerprint: "a", NodeName: "A", ProxyJSON: `{"name":"A"}`}
+	b := KeptProxy{Fingerprint: "b", NodeName: "B", ProxyJSON: `{"name":"B"}`}
+
+	runs := []struct {
+		passed  []KeptProxy
+		dropped int64
+		want    map[string]int // fingerprint -> missed runs
+	}{
+		{[]KeptProxy{a, b}, 0, map[string]int{"a": 0, "b": 0}},
+		{[]KeptProxy{a}, 0, map[string]int{"a": 0, "b": 1}},
+		{[]KeptProxy{a}, 1, map[string]int{"a": 0}},
+		{nil, 0, map[string]int{"a": 1}},
+		{[]KeptProxy{a}, 0, map[string]int{"a": 0}},
+	}
+	for i, run := range runs {
+		dropped, err := SaveKeptProxies(ctx, run.passed, 2)
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if dropped != run.dropped {
+			t.Errorf("run %d: dropped = %d, want %d", i, dropped, run.dropped)
+		}
+		list, err := ListKeptProxies(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]int, len(list))
+		for _, p := range list {
+			got[p.Fingerprint] = p.MissedRuns
+		}
+		if len(got) != len(run.want) {
+			t.Fatalf("run %d: kept = %v, want %v", i, got, run.want)
+		}
+		for fp, missed := range run.want {
+			if got[fp] != missed {
+				t.Errorf("run %d: %s missed = %d, want %d", i, fp, got[fp], missed)
+			}
+		}
+	}
+
+	list, _ := ListKeptProxies(ctx)
+	if list[0].SuccessCount != 4 || list[0].LastSuccess.IsZero() {
+		t.Errorf("a = %+v, want 4 successes", list[0])
+	}
+	if n, err := PurgeKeptProxies(ctx); err != nil || n != 1 {
+		t.Errorf("PurgeKeptProxies() = %d, %v", n, err)
+	}
+}
+
+func TestShareTokens(t *testing.T) {
+	if err := Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		DB = nil
+	})
+	ctx := context.Background()
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	id, err := CreateShareToken(ctx, ShareToken{
+		Name:        "phone",
+		Token:       "abc",
+		Outputs:     []string{"mihomo.yaml", "sub"},
+		IPAllowlist: []string{"10.0.0.0/8"},
+		ExpiresAt:   sql.NullTime{Time: expires, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateShareToken(ctx, ShareToken{Name: "dup", Token: "abc"}); err == nil {
+		t.Error("duplicate token should be rejected")
+	}
+	if n, err := CountShareTokens(ctx); err != nil || n != 1 {
+		t.Errorf("CountShareTokens() = %d, %v, want 1", n, err)
+	}
+	if err := RecordShareTokenAccess(ctx, id, "10.0.0.1", "clash.meta"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordShareTokenAccess(ctx, id, "10.0.0.2", "sing-box"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetShareToken(ctx, "abc")
+	if err != nil || got == nil {
+		t.Fatalf("GetShareToken() = %v, %v", got, err)
+	}
+	if got.Name != "phone" || strings.Join(got.Outputs, ",") != "mihomo.yaml,sub" || strings.Join(got.IPAllowlist, ",") != "10.0.0.0/8" {
+		t.Errorf("unexpected token %+v", got)
+	}
+	if !got.ExpiresAt.Valid || !got.ExpiresAt.Time.Equal(expires) {
+		t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, expires)
+	}
+	if got.RequestCount != 2 || got.LastIP != "10.0.0.2" || got.LastUserAgent != "sing-box" || !got.LastAccess.Valid {
+		t.Errorf("access not recorded: %+v", got)
+	}
+
+	if err := DeleteShareToken(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetShareToken(ctx, "abc"); err != nil || got != nil {
+		t.Errorf("revoked token still found: %v, %v", got, err)
+	}
+	if list, err := ListShareTokens(ctx); err != nil || len(list) != 0 {
+		t.Errorf("ListShareTokens() = %v, %v", list, err)
+	}
+	if n, err := CountShareTokens(ctx); err != nil || n != 0 {
+		t.Errorf("CountShareTokens() after revoke = %d, %v, want 0", n, err)
+	}
+}
+
+func TestRuns(t *testing.T) {
+	if err := Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		DB = nil
+	})
+	ctx := context.Background()
+	if r, err := LatestRun(ctx); err != nil || r != nil {
+		t.Fatalf("LatestRun() on empty table = %v, %v", r, err)
+	}
+
+	var ids []int64
+	for i := 1; i <= 3; i++ {
+		now := time.Now()
+		id, err := SaveRun(ctx, Run{StartedAt: now.Add(-time.Minute), FinishedAt: now, Total: 10, Available: i, Snapshot: `{"n":1}`, Diff: `{"added":[]}`}, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// 进行中的检测没有快照，不作为比较的基准
+	started, err := StartRun(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := GetRun(ctx, started); err != nil || r == nil || !r.FinishedAt.IsZero() || r.Status != RunRunning {
+		t.Errorf("started run = %+v, %v", r, err)
+	}
+
+	latest, err := LatestRun(ctx)
+	if err != nil || latest == nil || latest.ID != ids[2] || latest.Snapshot == "" || latest.Available != 3 {
+		t.Fatalf("LatestRun() = %+v, %v", latest, err)
+	}
+	prev, err := GetRun(ctx, ids[1])
+	if err != nil || prev == nil || prev.Snapshot != "" || prev.Diff == "" || prev.StartedAt.IsZero() {
+		t.Errorf("older run should keep its diff but not its snapshot: %+v, %v", prev, err)
+	}
+	if r, err := GetRun(ctx, ids[0]); err != nil || r != nil {
+		t.Errorf("pruned run still found: %+v, %v", r, err)
+	}
+
+	if _, err := SaveRun(ctx, Run{ID: started, FinishedAt: time.Now(), Total: 10, Available: 9, Snapshot: `{"n":2}`}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := LatestRun(ctx); err != nil || r.ID != started || r.Available != 9 || r.StartedAt.IsZero() || r.Status != RunFinished {
+		t.Errorf("finished run = %+v, %v", r, err)
+	}
+	if list, err := ListRuns(ctx, 0); err != nil || len(list) != 2 || list[0].ID != started || list[1].ID != ids[2] {
+		t.Errorf("ListRuns() = %+v, %v", list, err)
+	}
+
+	// 被否决的检测结束记录，但不作为比较的基准
+	vetoed, err := StartRun(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FinishRun(ctx, vetoed, RunVetoed, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := GetRun(ctx, vetoed); err != nil || r == nil || r.Status != RunVetoed || r.FinishedAt.IsZero() {
+		t.Errorf("vetoed run = %+v, %v", r, err)
+	}
+	if r, err := LatestRun(ctx); err != nil || r.ID != started {
+		t.Errorf("LatestRun() after veto = %+v, %v", r, err)
+	}
+}
+
+func TestQueryLatestResultJSON(t *testing.T) {
+	if err := Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		DB = nil
+	})
+	ctx := context.Background()
+	if js, err := QueryLatestResultJSON(ctx, "a"); err != nil || js != "" {
+		t.Fatalf("QueryLatestResultJSON() on empty table = %q, %v", js, err)
+	}
+	for _, js := range []string{`{"n":1}`, `{"n":2}`} {
+		id, err := SaveSpeedResult(ctx, sql.NullInt64{}, "A", sql.NullInt64{}, 100, sql.NullFloat64{}, ExitInfo{}, sql.NullString{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveSpeedResultFingerprint(ctx, id, "a", js, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 超过增量检测的时间窗口也能读取，重启后恢复发布的节点
+	if _, err := DB.ExecContext(ctx, `UPDATE speed_test_results SET test_time=datetime('now','-48 hour')`); err != nil {
+		t.Fatal(err)
+	}
+	if js, err := QueryRecentResultJSON(ctx, "a", 24); err != nil || js != "" {
+		t.Errorf("QueryRecentResultJSON() = %q, %v, want empty", js, err)
+	}
+	if js, err := QueryLatestResultJSON(ctx, "a"); err != nil || js != `{"n":2}` {
+		t.Errorf("QueryLatestResultJSON() = %q, %v", js, err)
+	}
+	// 复用的结果入库但不延长增量检测的有效期
+	id, err := SaveSpeedResult(ctx, sql.NullInt64{}, "A", sql.NullInt64{}, 100, sql.NullFloat64{}, ExitInfo{}, sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSpeedResultFingerprint(ctx, id, "a", `{"n":3}`, true); err != nil {
+		t.Fatal(err)
+	}
+	if js, err := QueryRecentResultJSON(ctx, "a", 24); err != nil || js != "" {
+		t.Errorf("reused row extended the TTL: QueryRecentResultJSON() = %q, %v", js, err)
+	}
+	if js, err := QueryLatestResultJSON(ctx, "a"); err != nil || js != `{"n":3}` {
+		t.Errorf("QueryLatestResultJSON() after reuse = %q, %v", js, err)
+	}
+}
@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twj0/subcheck/check"
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/notify"
+	"github.com/twj0/subcheck/save"
+	"github.com/twj0/subcheck/storage"
+)
+
+// webhook 事件
+const (
+	RunStart = "run-start" // 检测开始
+	RunEnd   = "run-end"   // 检测结束
+	Saved    = "save"      // 订阅文件已保存，包括健康监控移除节点后的重新生成
+)
+
+const (
+	EventHeader    = "X-Subcheck-Event"
+	DeliveryHeader = "X-Subcheck-Delivery"
+)
+
+// maxDeliveries 数据库中保留的投递记录数量
+const maxDeliveries = 500
+
+// Payload 投递的 JSON 内容
+type Payload struct {
+	Event         string           `json:"event"`
+	Time          time.Time        `json:"time"`
+	RunID         int64            `json:"runId,omitempty"`
+	Total         int              `json:"total,omitempty"` // 参与检测的节点数量
+	Available     int              `json:"available,omitempty"`
+	Duration      float64          `json:"durationSeconds,omitempty"`
+	Error         string           `json:"error,omitempty"` // 检测失败的原因
+	Subscriptions []Subscription   `json:"subscriptions,omitempty"`
+	Files         []File           `json:"files,omitempty"`
+	TopNodes      []save.NodeState `json:"topNodes,omitempty"`
+}
+
+// Subscription 订阅在本次检测中的统计，不包含订阅地址，避免泄露订阅令牌
+type Subscription struct {
+	Name    string     `json:"name"`
+	Nodes   int        `json:"nodes"`   // 解析出的节点数量
+	Checked int        `json:"checked"` // 去重后参与检测的节点数量
+	Passed  int        `json:"passed"`
+	Error   string     `json:"error,omitempty"`
+	Expire  *time.Time `json:"expire,omitempty"`
+}
+
+// File 本次写入的订阅文件
+type File struct {
+	save.OutputFile
+	URL string `json:"url"`
+}
+
+var (
+	httpClient = &http.Client{Timeout: 15 * time.Second}
+	// wait 重试前的等待，测试中替换
+	wait    = time.Sleep
+	pending sync.WaitGroup
+)
+
+// Subscriptions 转换检测中的订阅统计
+func Subscriptions(subs []check.SubResult) []Subscription {
+	list := make([]Subscription, 0, len(subs))
+	for _, s := range subs {
+		item := Subscription{Name: s.Name, Nodes: s.Nodes, Checked: s.Checked, Passed: s.Passed, Error: s.Error}
+		if !s.Expire.IsZero() {
+			expire := s.Expire
+			item.Expire = &expire
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// Files 为订阅文件生成访问地址，未配置 webhooks.public-url 时为相对路径
+func Files(outputs []save.OutputFile) []File {
+	base := strings.TrimSuffix(config.GlobalConfig.Webhooks.PublicURL, "/")
+	list := make([]File, 0, len(outputs))
+	for _, f := range outputs {
+		list = append(list, File{OutputFile: f, URL: base + "/sub/" + f.Name})
+	}
+	return list
+}
+
+// Send 异步投递到订阅了该事件的地址
+func Send(p Payload) {
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+	for _, t := range config.GlobalConfig.Webhooks.Targets {
+		if t.URL == "" || (len(t.Events) > 0 && !slices.Contains(t.Events, p.Event)) {
+			continue
+		}
+		pending.Add(1)
+		go func(t config.WebhookTarget) {
+			defer pending.Done()
+			deliver(t, p)
+		}(t)
+	}
+}
+
+// Wait 等待进行中的投递完成
+func Wait() {
+	pending.Wait()
+}
+
+// deliver 投递并重试，结果写入投递记录
+func deliver(t config.WebhookTarget, p Payload) storage.WebhookDelivery {
+	cfg := config.GlobalConfig.Webhooks
+	d := storage.WebhookDelivery{DeliveryID: newDeliveryID(), RunID: p.RunID, Event: p.Event, URL: t.URL}
+	body, err := json.Marshal(p)
+	if err != nil {
+		d.Error = err.Error()
+		record(d)
+		return d
+	}
+	backoff := time.Duration(cfg.Backoff) * time.Second
+	for i := 0; i <= max(cfg.Retry, 0); i++ {
+		if i > 0 {
+			wait(backoff << (i - 1))
+		}
+		d.Attempts++
+		d.StatusCode, err = post(t, d.DeliveryID, p.Event, body)
+		if err == nil {
+			d.Success, d.Error = true, ""
+			break
+		}
+		d.Error = err.Error()
+	}
+	if d.Success {
+		slog.Debug(fmt.Sprintf("webhook 投递成功 [%s] %s", p.Event, t.URL))
+	} else {
+		slog.Error(fmt.Sprintf("webhook 投递失败 [%s] %s: %s", p.Event, t.URL, d.Error))
+	}
+	record(d)
+	return d
+}
+
+func post(t config.WebhookTarget, deliveryID, event string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "subcheck-webhook")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	if t.Secret != "" {
+		req.Header.Set(notify.SignatureHeader, notify.Sign(t.Secret, body))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("状态码: %d, 响应: %s", resp.StatusCode, string(data))
+	}
+	return resp.StatusCode, nil
+}
+
+func record(d storage.WebhookDelivery) {
+	if storage.DB == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := storage.SaveWebhookDelivery(ctx, d, maxDeliveries); err != nil {
+		slog.Debug(fmt.Sprintf("保存 webhook 投递记录失败: %v", err))
+	}
+}
+
+func newDeliveryID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
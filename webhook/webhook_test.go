@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twj0/subcheck/config"
+	"github.com/twj0/subcheck/notify"
+	"github.com/twj0/subcheck/save"
+	"github.com/twj0/subcheck/storage"
+)
+
+func setup(t *testing.T, cfg config.WebhooksConfig) {
+	t.Helper()
+	if err := storage.Init(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	old, oldWait := config.GlobalConfig, wait
+	t.Cleanup(func() {
+		storage.Close()
+		storage.DB = nil
+		config.GlobalConfig, wait = old, oldWait
+	})
+	config.GlobalConfig = &config.Config{Webhooks: cfg}
+	wait = func(time.Duration) {}
+}
+
+func TestSend(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	var (
+		mu       sync.Mutex
+		received []request
+		failures = 2
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, request{r.Header, body})
+		if r.URL.Path == "/flaky" && failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	setup(t, config.WebhooksConfig{
+		PublicURL: "https://example.com/",
+		Retry:     2,
+		Targets: []config.WebhookTarget{
+			{URL: srv.URL + "/flaky", Secret: "s3cret", Events: []string{RunEnd}},
+			{URL: srv.URL + "/start-only", Events: []string{RunStart}},
+		},
+	})
+
+	Send(Payload{
+		Event:     RunEnd,
+		RunID:     7,
+		Available: 1,
+		Files:     Files([]save.OutputFile{{Name: "mihomo.yaml", Size: 3, SHA256: "abc"}}),
+		TopNodes:  []save.NodeState{{Name: "jp", Speed: 100}},
+	})
+	Wait()
+
+	if len(received) != 3 {
+		t.Fatalf("received %d requests, want 3 attempts to /flaky", len(received))
+	}
+	last := received[2]
+	if id := last.header.Get(DeliveryHeader); id == "" || id != received[0].header.Get(DeliveryHeader) {
+		t.Errorf("delivery id should be stable across retries, got %q and %q", received[0].header.Get(DeliveryHeader), id)
+	}
+	if last.header.Get(EventHeader) != RunEnd || last.header.Get(notify.SignatureHeader) != notify.Sign("s3cret", last.body) {
+		t.Errorf("headers = %v", last.header)
+	}
+	var got struct {
+		Event    string `json:"event"`
+		RunID    int64  `json:"runId"`
+		Files    []File `json:"files"`
+		TopNodes []save.NodeState
+	}
+	if err := json.Unmarshal(last.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Event != RunEnd || got.RunID != 7 || len(got.Files) != 1 || got.Files[0].URL != "https://example.com/sub/mihomo.yaml" || got.Files[0].SHA256 != "abc" {
+		t.Errorf("payload = %s", last.body)
+	}
+
+	list, err := storage.ListWebhookDeliveries(context.Background(), 0)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("deliveries = %+v, %v", list, err)
+	}
+	if d := list[0]; !d.Success || d.Attempts != 3 || d.StatusCode != http.StatusOK || d.RunID != 7 || d.Event != RunEnd {
+		t.Errorf("delivery = %+v", d)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	setup(t, config.WebhooksConfig{Retry: 2, Backoff: 1})
+	wait = func(d time.Duration) { waits = append(waits, d) }
+
+	d := deliver(config.WebhookTarget{URL: srv.URL}, Payload{Event: Saved})
+	if d.Success || d.Attempts != 3 || attempts != 3 || d.StatusCode != http.StatusInternalServerError || d.Error == "" {
+		t.Errorf("delivery = %+v, server attempts %d", d, attempts)
+	}
+	if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+		t.Errorf("waits = %v, want [1s 2s]", waits)
+	}
+}